@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+)
+
+// ackTopicSuffix is appended to the topic of a message to get the topic its
+// acknowledgment is published on.
+const ackTopicSuffix = "/ack"
+
+// MQTTAck acknowledges an MQTT message: its status is stored with the ID of
+// the stored measurement, or error with the reason it was not stored.
+type MQTTAck struct {
+	Status string `json:"status"`
+	ID     string `json:"id,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// isAckTopic reports whether topic is one acknowledgments are published on,
+// so that they are not taken for measurements where the subscription
+// covers them, e.g. sensors/# and sensors/a/ack.
+func isAckTopic(topic string) bool {
+	return strings.HasSuffix(topic, ackTopicSuffix)
+}
+
+// publishAck publishes the outcome of handling a message received on topic
+// to <topic>/ack when MQTT_PUBLISH_ACK is on: the stored measurement, or the
+// error that kept it from being stored. Like measurements, acks are
+// published in the background.
+func publishAck(ctx context.Context, topic string, stored Measurement, err error) {
+	client := currentMQTTClient()
+	if !cfg().MQTTPublishAck || client == nil {
+		return
+	}
+
+	ack := MQTTAck{Status: "stored", ID: stored.ID.Hex()}
+	if err != nil {
+		ack = MQTTAck{Status: "error", Error: err.Error()}
+	}
+	payload, err := json.Marshal(ack)
+	if err != nil {
+		logf(ctx, "Error encoding ack: %s\n", err)
+		return
+	}
+
+	qos := byte(cfg().MQTTPublishQoS)
+	go func() {
+		if err := client.Publish(topic+ackTopicSuffix, qos, false, payload); err != nil {
+			logf(ctx, "Error publishing ack: %s\n", err)
+		}
+	}()
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requireAdmin only lets through requests carrying the ADMIN_API_KEY, in
+// the X-API-Key header or as a bearer token. Admin endpoints are disabled
+// while no key is configured.
+func requireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := cfg().AdminAPIKey
+		if key == "" {
+			respondError(c, &APIError{http.StatusForbidden, codeForbidden,
+				"Admin API is disabled, set ADMIN_API_KEY to enable it", nil})
+			return
+		}
+
+		given := c.GetHeader("X-API-Key")
+		if bearer := c.GetHeader("Authorization"); given == "" && strings.HasPrefix(bearer, "Bearer ") {
+			given = strings.TrimPrefix(bearer, "Bearer ")
+		}
+		if subtle.ConstantTimeCompare([]byte(given), []byte(key)) != 1 {
+			respondError(c, &APIError{http.StatusUnauthorized, codeUnauthorized, "Invalid API key", nil})
+			return
+		}
+		c.Next()
+	}
+}
+
+// ReloadResult lists the settings that changed on reload.
+type ReloadResult struct {
+	Applied         []string `json:"applied"`
+	RequiresRestart []string `json:"requires_restart"`
+}
+
+// @Summary Reload the configuration
+// @Description Re-reads the config file and environment and applies the hot-reloadable settings. Changed settings that need a restart are reported but not applied.
+// @Tags Admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} ReloadResult
+// @Failure 400 {object} ErrorResponse "Invalid configuration"
+// @Failure 401 {object} ErrorResponse "Invalid API key"
+// @Failure 403 {object} ErrorResponse "Admin API disabled"
+// @Router /admin/reload [post]
+func reloadConfig(c *gin.Context) {
+	next, err := loadConfig()
+	if err != nil {
+		respondError(c, validationError(fmt.Errorf("invalid configuration: %w", err)))
+		return
+	}
+
+	// Settings kept until a restart can conflict with reloaded ones, e.g. an
+	// MQTT_PUBLISH_TOPIC that the running MQTT_TOPIC matches.
+	merged, applied, restart := mergeReload(*cfg(), next)
+	if err := merged.validate(); err != nil {
+		respondError(c, validationError(fmt.Errorf("invalid configuration with the settings that need a restart: %w", err)))
+		return
+	}
+	liveConfig.Store(&merged)
+	if len(applied) > 0 {
+		log.Println("Configuration reloaded, applied:", strings.Join(applied, ", "))
+	}
+
+	c.JSON(http.StatusOK, ReloadResult{
+		Applied:         append([]string{}, applied...),
+		RequiresRestart: append([]string{}, restart...),
+	})
+}
+
+// @Summary Get the effective configuration
+// @Description Returns every setting as currently in effect, after the config file, the environment and any reload, by its config file name. The admin key and the passwords in MONGO_URI and MQTT_BROKER_URL are redacted.
+// @Tags Admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} ErrorResponse "Invalid API key"
+// @Failure 403 {object} ErrorResponse "Admin API disabled"
+// @Router /admin/config [get]
+func getConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, redactedConfig(*cfg()))
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestReloadConfig(t *testing.T) {
+	tests := []struct {
+		name         string
+		publishTopic string
+		wantStatus   int
+		wantPublish  string
+	}{
+		// The running MQTT_TOPIC is kept, so it must not match the reloaded
+		// publish topic, although the reloaded MQTT_TOPIC does not.
+		{name: "conflict with a setting kept", publishTopic: "sensors/self", wantStatus: http.StatusBadRequest, wantPublish: ""},
+		{name: "no conflict", publishTopic: "self/web-1", wantStatus: http.StatusOK, wantPublish: "self/web-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.MQTTTopic = "sensors/#"
+			useConfig(t, config)
+			t.Setenv("CONFIG_FILE", "")
+			t.Setenv("MQTT_TOPIC", "metrics/#")
+			t.Setenv("MQTT_PUBLISH_TOPIC", tt.publishTopic)
+
+			router := gin.New()
+			router.POST("/admin/reload", reloadConfig)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("POST", "/admin/reload", nil))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if cfg().MQTTTopic != "sensors/#" || cfg().MQTTPublishTopic != tt.wantPublish {
+				t.Errorf("running MQTT_TOPIC %q, MQTT_PUBLISH_TOPIC %q, want sensors/# and %q",
+					cfg().MQTTTopic, cfg().MQTTPublishTopic, tt.wantPublish)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var result ReloadResult
+			if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+				t.Fatal(err)
+			}
+			if !contains(result.Applied, "mqtt_publish_topic") || !contains(result.RequiresRestart, "mqtt_topic") {
+				t.Errorf("result = %+v, want mqtt_publish_topic applied and mqtt_topic requiring a restart", result)
+			}
+		})
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// parseFieldAliases maps the fields named by FIELD_ALIASES entries of the
+// form <field>=<alias> to their alias.
+func parseFieldAliases(entries []string) map[string]string {
+	aliases := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		if field, alias, ok := strings.Cut(entry, "="); ok {
+			aliases[field] = alias
+		}
+	}
+	return aliases
+}
+
+// validFieldAliases reports whether every FIELD_ALIASES entry has the form
+// <field>=<alias> and renames a different field of a measurement, and
+// whether the fields still have distinct names once renamed.
+func validFieldAliases(entries []string) bool {
+	for _, entry := range entries {
+		field, alias, ok := strings.Cut(entry, "=")
+		if _, known := measurementFields[field]; !ok || !known || alias == "" {
+			return false
+		}
+	}
+	aliases := parseFieldAliases(entries)
+	if len(aliases) != len(entries) {
+		return false
+	}
+	names := make(map[string]bool, len(measurementFields))
+	for field := range measurementFields {
+		name := field
+		if alias, ok := aliases[field]; ok {
+			name = alias
+		}
+		if names[name] {
+			return false
+		}
+		names[name] = true
+	}
+	return true
+}
+
+// responseMeasurement is a measurement as the API returns it, with its
+// fields renamed according to FIELD_ALIASES. Stored, buffered and published
+// measurements keep the field names, as do request bodies.
+type responseMeasurement Measurement
+
+func (m responseMeasurement) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(Measurement(m))
+	if err != nil || len(cfg().FieldAliases) == 0 {
+		return data, err
+	}
+	return renameFields(data, parseFieldAliases(cfg().FieldAliases))
+}
+
+// responseMeasurements converts measurements for a response.
+func responseMeasurements(measurements []Measurement) []responseMeasurement {
+	converted := make([]responseMeasurement, len(measurements))
+	for i, m := range measurements {
+		converted[i] = responseMeasurement(m)
+	}
+	return converted
+}
+
+// renameFields renames the top-level keys of the JSON object data found in
+// aliases, keeping their order.
+func renameFields(data []byte, aliases map[string]string) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	out.WriteByte('{')
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, _ := token.(string)
+		if alias, ok := aliases[key]; ok {
+			key = alias
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		if out.Len() > 1 {
+			out.WriteByte(',')
+		}
+		name, _ := json.Marshal(key)
+		out.Write(name)
+		out.WriteByte(':')
+		out.Write(value)
+	}
+	out.WriteByte('}')
+	return out.Bytes(), nil
+}
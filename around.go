@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultAround = 5
+	maxAround     = 100
+)
+
+// @Summary Measurements around a moment
+// @Description Returns the measurements immediately before and after a timestamp, oldest first, to give context around a flagged event. A measurement taken exactly at ts counts as after it.
+// @Tags Measurements
+// @Produce json
+// @Param ts query string true "RFC3339 timestamp to look around"
+// @Param before query int false "Number of measurements before ts (default 5, max 100)"
+// @Param after query int false "Number of measurements at or after ts (default 5, max 100)"
+// @Param host query string false "Only measurements from this host"
+// @Success 200 {array} Measurement
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 503 {object} ErrorResponse "MongoDB unavailable"
+// @Router /measurements/around [get]
+func getMeasurementsAround(c *gin.Context) {
+	ts, err := time.Parse(time.RFC3339Nano, c.Query("ts"))
+	if err != nil {
+		respondError(c, validationError(errors.New("invalid ts: expected RFC3339 timestamp")))
+		return
+	}
+	// Timestamps are stored in milliseconds, so a finer ts would put the
+	// measurement of its own millisecond on the wrong side.
+	ts = ts.Truncate(time.Millisecond)
+	before, err := aroundCount(c, "before")
+	if err != nil {
+		respondError(c, validationError(err))
+		return
+	}
+	after, err := aroundCount(c, "after")
+	if err != nil {
+		respondError(c, validationError(err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	collection, err := getMongoCollection()
+	if err != nil {
+		respondError(c, errDBUnavailable)
+		return
+	}
+
+	filter := func(timestamp bson.M) bson.M {
+		filter := bson.M{"timestamp": timestamp}
+		if host := c.Query("host"); host != "" {
+			filter["host"] = host
+		}
+		return notDeleted(fromSource(filter, hostSource))
+	}
+	// The measurements before ts are fetched newest first, so that the limit
+	// keeps the closest ones, and reversed.
+	earlier, err := findAround(ctx, collection, filter(bson.M{"$lt": ts}), -1, before)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	later, err := findAround(ctx, collection, filter(bson.M{"$gte": ts}), 1, after)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	around := make([]Measurement, 0, len(earlier)+len(later))
+	for i := len(earlier) - 1; i >= 0; i-- {
+		around = append(around, earlier[i])
+	}
+	around = append(around, later...)
+	c.JSON(http.StatusOK, responseMeasurements(around))
+}
+
+// aroundCount parses the before or after query parameter.
+func aroundCount(c *gin.Context, name string) (int64, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return defaultAround, nil
+	}
+	n, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || n < 0 || n > maxAround {
+		return 0, fmt.Errorf("invalid %s: expected a number between 0 and %d", name, maxAround)
+	}
+	return n, nil
+}
+
+// findAround returns up to limit measurements matching filter in the given
+// timestamp order. GET /measurements/tail uses it for its backfill.
+func findAround(ctx context.Context, collection *mongo.Collection, filter bson.M, order int, limit int64) ([]Measurement, error) {
+	measurements := []Measurement{}
+	if limit == 0 {
+		return measurements, nil
+	}
+	findOptions := options.Find().SetSort(bson.D{{Key: "timestamp", Value: order}}).SetLimit(limit)
+	cur, err := collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, internalError("Failed to query measurements")
+	}
+	defer cur.Close(ctx)
+	if err := cur.All(ctx, &measurements); err != nil {
+		return nil, internalError("Failed to decode measurements")
+	}
+	return measurements, nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// defaultAvailabilityWindow is the range /measurements/availability covers
+// when from is not set.
+const defaultAvailabilityWindow = 24 * time.Hour
+
+// Availability is the share of a time range a host was reporting
+// measurements in.
+type Availability struct {
+	Host     string           `json:"host"`
+	From     time.Time        `json:"from"`
+	To       time.Time        `json:"to"`
+	Interval string           `json:"interval"`
+	Samples  int              `json:"samples"`
+	Percent  float64          `json:"availability_percent"`
+	Downtime []DowntimeWindow `json:"downtime"`
+}
+
+// DowntimeWindow is a period in which a host sent no measurements.
+type DowntimeWindow struct {
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Duration string    `json:"duration"`
+}
+
+// downtimeWindows finds the gaps in the sorted timestamps of a host sampling
+// every interval within [from, to]. A gap counts once it exceeds twice the
+// interval, i.e. at least one sample was missed, which tolerates jitter; the
+// downtime then starts one interval after the last sample.
+func downtimeWindows(timestamps []time.Time, from, to time.Time, interval time.Duration) []DowntimeWindow {
+	windows := []DowntimeWindow{}
+	add := func(start, end time.Time) {
+		windows = append(windows, DowntimeWindow{Start: start, End: end, Duration: end.Sub(start).String()})
+	}
+
+	if len(timestamps) == 0 {
+		add(from, to)
+		return windows
+	}
+	if timestamps[0].Sub(from) > 2*interval {
+		add(from, timestamps[0])
+	}
+	for i := 1; i < len(timestamps); i++ {
+		if timestamps[i].Sub(timestamps[i-1]) > 2*interval {
+			add(timestamps[i-1].Add(interval), timestamps[i])
+		}
+	}
+	if last := timestamps[len(timestamps)-1]; to.Sub(last) > 2*interval {
+		add(last.Add(interval), to)
+	}
+	return windows
+}
+
+// @Summary Availability of a host
+// @Description Turns the gaps between the measurements of a host into an availability percentage and the list of downtime windows. A gap counts as downtime once it exceeds twice the interval the host samples at.
+// @Tags Hosts
+// @Produce json
+// @Param host query string true "Host name"
+// @Param from query string false "Start of the range as an RFC3339 timestamp (default 24 hours before to)"
+// @Param to query string false "End of the range as an RFC3339 timestamp (default now)"
+// @Param interval query string false "Interval the host samples at as a Go duration (default OBSERVER_INTERVAL)"
+// @Success 200 {object} Availability
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 503 {object} ErrorResponse "MongoDB unavailable"
+// @Router /measurements/availability [get]
+func getAvailability(c *gin.Context) {
+	host := c.Query("host")
+	if host == "" {
+		respondError(c, validationError(errors.New("host is required")))
+		return
+	}
+	interval := cfg().ObserverInterval
+	if raw := c.Query("interval"); raw != "" {
+		var err error
+		interval, err = time.ParseDuration(raw)
+		if err != nil || interval <= 0 {
+			respondError(c, validationError(errors.New("invalid interval: expected a positive duration such as 10s")))
+			return
+		}
+	}
+	from, to, err := parseTimeRange(c)
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if from.IsZero() {
+		from = to.Add(-defaultAvailabilityWindow)
+	}
+	if err == nil && !to.After(from) {
+		err = errors.New("invalid range: to must be after from")
+	}
+	if err == nil {
+		err = checkQueryWindow(from, to)
+	}
+	if err != nil {
+		respondError(c, validationError(err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	collection, err := getMongoCollection()
+	if err != nil {
+		respondError(c, errDBUnavailable)
+		return
+	}
+
+	filter := rangeFilter(from, to)
+	filter["host"] = host
+	findOptions := options.Find().SetSort(bson.M{"timestamp": 1}).SetProjection(bson.M{"timestamp": 1})
+	cur, err := collection.Find(ctx, notDeleted(fromSource(filter, hostSource)), findOptions)
+	if err != nil {
+		respondError(c, internalError("Failed to query measurements"))
+		return
+	}
+	defer cur.Close(ctx)
+
+	var timestamps []time.Time
+	for cur.Next(ctx) {
+		var m Measurement
+		if err := cur.Decode(&m); err != nil {
+			respondError(c, internalError("Failed to decode measurement"))
+			return
+		}
+		timestamps = append(timestamps, m.Timestamp)
+	}
+	if err := cur.Err(); err != nil {
+		respondError(c, internalError("Failed to query measurements"))
+		return
+	}
+
+	result := Availability{Host: host, From: from, To: to, Interval: interval.String(), Samples: len(timestamps)}
+	result.Downtime = downtimeWindows(timestamps, from, to, interval)
+	var down time.Duration
+	for _, window := range result.Downtime {
+		down += window.End.Sub(window.Start)
+	}
+	result.Percent = 100 * (1 - down.Seconds()/to.Sub(from).Seconds())
+
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// observerInterval is the interval the resource observer currently samples
+// at, in nanoseconds.
+var observerInterval atomic.Int64
+
+func init() {
+	newGauge("observer_interval_seconds", "Interval the resource observer currently samples at, lengthened under OBSERVER_BACKOFF_CPU.",
+		func() float64 { return time.Duration(observerInterval.Load()).Seconds() })
+}
+
+// samplingBackoff lengthens the observer interval while this machine is
+// overloaded, so that the monitor does not add to the load it reports. Each
+// sample above OBSERVER_BACKOFF_CPU doubles the interval, up to
+// OBSERVER_MAX_INTERVAL, and each sample below OBSERVER_BACKOFF_RESUME_CPU
+// halves it again, down to OBSERVER_INTERVAL.
+type samplingBackoff struct {
+	interval time.Duration
+}
+
+// next returns the interval to wait before the next sample. It is derived
+// from the configuration on every call, so that a reload applies right away.
+func (b *samplingBackoff) next() time.Duration {
+	base, limit := cfg().ObserverInterval, cfg().ObserverMaxInterval
+	switch {
+	case cfg().ObserverBackoffCPU <= 0 || b.interval < base:
+		b.interval = base
+	case b.interval > limit:
+		b.interval = limit
+	}
+	observerInterval.Store(int64(b.interval))
+	return b.interval
+}
+
+// observe adjusts the interval to the CPU usage of the latest sample.
+func (b *samplingBackoff) observe(cpu float64) {
+	high := cfg().ObserverBackoffCPU
+	if high <= 0 {
+		return
+	}
+	low := cfg().ObserverBackoffResumeCPU
+	if low <= 0 {
+		low = high
+	}
+	base, limit := cfg().ObserverInterval, cfg().ObserverMaxInterval
+
+	previous := b.interval
+	switch {
+	case cpu > high && b.interval < limit:
+		b.interval *= 2
+		if b.interval > limit {
+			b.interval = limit
+		}
+	case cpu < low && b.interval > base:
+		b.interval /= 2
+		if b.interval < base {
+			b.interval = base
+		}
+	}
+	if b.interval != previous {
+		log.Printf("CPU usage at %.1f%%, sampling every %s instead of %s\n", cpu, b.interval, previous)
+	}
+}
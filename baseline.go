@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Baseline is the load a host is expected to run at on average.
+type Baseline struct {
+	Host      string    `bson:"_id" json:"host"`
+	CPU       float64   `bson:"cpu" json:"cpu"`
+	RAM       float64   `bson:"ram" json:"ram"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// validate checks that the expected usage is a percentage.
+func (b Baseline) validate() error {
+	if b.CPU < 0 || b.CPU > 100 {
+		return errors.New("cpu must be between 0 and 100")
+	}
+	if b.RAM < 0 || b.RAM > 100 {
+		return errors.New("ram must be between 0 and 100")
+	}
+	return nil
+}
+
+// HostDeviation compares the average load of a host over a time range with
+// its baseline. The averages and deviations, in percentage points above
+// (positive) or below the baseline, are null without measurements in the
+// range.
+type HostDeviation struct {
+	Host         string   `json:"host"`
+	BaselineCPU  float64  `json:"baseline_cpu"`
+	BaselineRAM  float64  `json:"baseline_ram"`
+	AvgCPU       *float64 `json:"avg_cpu"`
+	AvgRAM       *float64 `json:"avg_ram"`
+	CPUDeviation *float64 `json:"cpu_deviation"`
+	RAMDeviation *float64 `json:"ram_deviation"`
+	Samples      int      `json:"samples"`
+}
+
+// largestDeviation is the larger absolute deviation of d, or -1 without
+// measurements so those hosts sort last.
+func (d HostDeviation) largestDeviation() float64 {
+	if d.CPUDeviation == nil {
+		return -1
+	}
+	return math.Max(math.Abs(*d.CPUDeviation), math.Abs(*d.RAMDeviation))
+}
+
+// baselineCollection holds the baselines of the hosts whose measurements are
+// stored in collection, keyed by host.
+func baselineCollection(collection *mongo.Collection) *mongo.Collection {
+	return collection.Database().Collection(collection.Name() + "-baselines")
+}
+
+// @Summary List baselines
+// @Description Lists the expected average CPU and RAM usage of every host that has a baseline
+// @Tags Hosts
+// @Produce json
+// @Success 200 {array} Baseline
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 503 {object} ErrorResponse "MongoDB unavailable"
+// @Router /baselines [get]
+func listBaselines(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	collection, err := getMongoCollection()
+	if err != nil {
+		respondError(c, errDBUnavailable)
+		return
+	}
+
+	findOptions := options.Find().SetSort(bson.M{"_id": 1})
+	cur, err := baselineCollection(collection).Find(ctx, bson.M{}, findOptions)
+	if err != nil {
+		respondError(c, internalError("Failed to retrieve baselines"))
+		return
+	}
+	defer cur.Close(ctx)
+
+	baselines := []Baseline{}
+	if err := cur.All(ctx, &baselines); err != nil {
+		respondError(c, internalError("Failed to decode baselines"))
+		return
+	}
+
+	c.JSON(http.StatusOK, baselines)
+}
+
+// @Summary Set the baseline of a host
+// @Description Creates or replaces the expected average CPU and RAM usage of a host, which /measurements/deviation compares against
+// @Tags Hosts
+// @Accept json
+// @Produce json
+// @Param host path string true "Host name"
+// @Param baseline body Baseline true "Expected usage in percent; host and updated_at are ignored"
+// @Success 200 {object} Baseline
+// @Failure 400 {object} ErrorResponse "Invalid baseline"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 503 {object} ErrorResponse "MongoDB unavailable"
+// @Router /baselines/{host} [put]
+func putBaseline(c *gin.Context) {
+	var baseline Baseline
+	if err := c.ShouldBindJSON(&baseline); err != nil {
+		respondError(c, validationError(err))
+		return
+	}
+	if err := baseline.validate(); err != nil {
+		respondError(c, validationError(err))
+		return
+	}
+	baseline.Host = c.Param("host")
+	baseline.UpdatedAt = time.Now()
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	collection, err := getMongoCollection()
+	if err != nil {
+		respondError(c, errDBUnavailable)
+		return
+	}
+
+	_, err = baselineCollection(collection).ReplaceOne(ctx, bson.M{"_id": baseline.Host}, baseline,
+		options.Replace().SetUpsert(true))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, baseline)
+}
+
+// @Summary Deviation from the baselines
+// @Description Compares the average CPU and RAM usage of every host with a baseline over the time range with that baseline, largest deviation first, to surface machines behaving unlike their own norm
+// @Tags Hosts
+// @Produce json
+// @Param from query string false "Only measurements at or after this RFC3339 timestamp"
+// @Param to query string false "Only measurements at or before this RFC3339 timestamp"
+// @Success 200 {array} HostDeviation
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 503 {object} ErrorResponse "MongoDB unavailable"
+// @Router /measurements/deviation [get]
+func getDeviation(c *gin.Context) {
+	from, to, err := parseTimeRange(c)
+	if err == nil {
+		err = checkQueryWindow(from, to)
+	}
+	if err != nil {
+		respondError(c, validationError(err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	collection, err := getMongoCollection()
+	if err != nil {
+		respondError(c, errDBUnavailable)
+		return
+	}
+
+	cur, err := baselineCollection(collection).Find(ctx, bson.M{})
+	if err != nil {
+		respondError(c, internalError("Failed to retrieve baselines"))
+		return
+	}
+	var baselines []Baseline
+	if err := cur.All(ctx, &baselines); err != nil {
+		respondError(c, internalError("Failed to decode baselines"))
+		return
+	}
+
+	hosts := make([]string, len(baselines))
+	for i, baseline := range baselines {
+		hosts[i] = baseline.Host
+	}
+	filter := rangeFilter(from, to)
+	filter["host"] = bson.M{"$in": hosts}
+	cur, err = collection.Aggregate(ctx, []bson.M{
+		{"$match": notDeleted(fromSource(filter, hostSource))},
+		{"$group": bson.M{
+			"_id":     "$host",
+			"avg_cpu": bson.M{"$avg": "$cpu"},
+			"avg_ram": bson.M{"$avg": "$ram"},
+			"samples": bson.M{"$sum": 1},
+		}},
+	})
+	if err != nil {
+		respondError(c, internalError("Failed to compute the averages"))
+		return
+	}
+	var averages []struct {
+		Host    string  `bson:"_id"`
+		AvgCPU  float64 `bson:"avg_cpu"`
+		AvgRAM  float64 `bson:"avg_ram"`
+		Samples int     `bson:"samples"`
+	}
+	if err := cur.All(ctx, &averages); err != nil {
+		respondError(c, internalError("Failed to decode the averages"))
+		return
+	}
+
+	deviations := make([]HostDeviation, len(baselines))
+	index := make(map[string]int, len(baselines))
+	for i, baseline := range baselines {
+		deviations[i] = HostDeviation{Host: baseline.Host, BaselineCPU: baseline.CPU, BaselineRAM: baseline.RAM}
+		index[baseline.Host] = i
+	}
+	for _, average := range averages {
+		d := &deviations[index[average.Host]]
+		avgCPU, avgRAM := roundPercent(average.AvgCPU), roundPercent(average.AvgRAM)
+		cpuDeviation := roundPercent(average.AvgCPU - d.BaselineCPU)
+		ramDeviation := roundPercent(average.AvgRAM - d.BaselineRAM)
+		d.AvgCPU, d.AvgRAM = &avgCPU, &avgRAM
+		d.CPUDeviation, d.RAMDeviation = &cpuDeviation, &ramDeviation
+		d.Samples = average.Samples
+	}
+	sort.SliceStable(deviations, func(i, j int) bool {
+		return deviations[i].largestDeviation() > deviations[j].largestDeviation()
+	})
+
+	c.JSON(http.StatusOK, deviations)
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxBatchSize bounds the number of measurements created by one request.
+const maxBatchSize = 1000
+
+// BatchResult reports the outcome of a batch create. Failed lists the
+// batch positions that were not stored; all others were.
+type BatchResult struct {
+	Inserted []primitive.ObjectID `json:"inserted"`
+	Failed   []BatchFailure       `json:"failed"`
+}
+
+// BatchFailure is a measurement of a batch that could not be stored.
+type BatchFailure struct {
+	Index int       `json:"index"`
+	Error *APIError `json:"error"`
+}
+
+// isJSONArray reports whether body holds a JSON array rather than a single
+// object.
+func isJSONArray(body []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(body), []byte("["))
+}
+
+// RowErrors lists the invalid fields of the measurement at position Row of
+// a batch.
+type RowErrors struct {
+	Row    int          `json:"row"`
+	Errors []FieldError `json:"errors"`
+}
+
+// Import formats accepted besides JSON, selected by the Content-Type of the
+// body.
+const (
+	mimeCSV    = "text/csv"
+	mimeNDJSON = "application/x-ndjson"
+)
+
+// isImportFormat reports whether contentType is a format that is always
+// decoded as a batch.
+func isImportFormat(contentType string) bool {
+	return contentType == mimeCSV || contentType == mimeNDJSON
+}
+
+// parseImport decodes and validates the measurements of a batch body in the
+// format of contentType: CSV, NDJSON or, for any other type, a JSON array.
+// Batch creation and POST /measurements/import/validate share it, so that
+// a validated file is accepted as it was reported.
+func parseImport(contentType string, body []byte) ([]Measurement, []RowErrors, error) {
+	switch contentType {
+	case mimeCSV:
+		return parseCSVBatch(body)
+	case mimeNDJSON:
+		return parseNDJSONBatch(body)
+	}
+	return parseBatch(body)
+}
+
+// checkBatchSize returns an error unless a batch of n measurements may be
+// stored at once.
+func checkBatchSize(n int) error {
+	if n == 0 || n > maxBatchSize {
+		return fmt.Errorf("a batch must hold 1 to %d measurements", maxBatchSize)
+	}
+	return nil
+}
+
+// parseBatch decodes the measurements of a JSON array body and validates
+// each of them. An error is returned if body is not an array of 1 to
+// maxBatchSize entries.
+func parseBatch(body []byte) ([]Measurement, []RowErrors, error) {
+	var rows []json.RawMessage
+	if err := json.Unmarshal(body, &rows); err != nil {
+		return nil, nil, err
+	}
+	return parseJSONRows(rows)
+}
+
+// parseNDJSONBatch decodes the measurements of an NDJSON body, one JSON
+// object per line, and validates each of them. Blank lines are skipped, and
+// a line that is not valid JSON only invalidates its own row.
+func parseNDJSONBatch(body []byte) ([]Measurement, []RowErrors, error) {
+	var rows []json.RawMessage
+	for _, line := range bytes.Split(body, []byte("\n")) {
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			rows = append(rows, line)
+		}
+	}
+	return parseJSONRows(rows)
+}
+
+// parseJSONRows decodes and validates every row. A row that is not a valid
+// measurement does not keep the others from being checked; the invalid
+// rows are returned in order.
+func parseJSONRows(rows []json.RawMessage) ([]Measurement, []RowErrors, error) {
+	if err := checkBatchSize(len(rows)); err != nil {
+		return nil, nil, err
+	}
+	batch := make([]Measurement, len(rows))
+	var invalid []RowErrors
+	for i, row := range rows {
+		var details []FieldError
+		var typeErr *json.UnmarshalTypeError
+		if err := json.Unmarshal(row, &batch[i]); errors.As(err, &typeErr) {
+			// Field is empty when the row itself is not an object.
+			details = []FieldError{{typeErr.Field, fmt.Sprintf("must be %s, not %s", jsonTypeName(typeErr.Type), typeErr.Value)}}
+		} else if err != nil {
+			details = []FieldError{{"", err.Error()}}
+		} else {
+			details = batch[i].validate()
+		}
+		if len(details) > 0 {
+			invalid = append(invalid, RowErrors{i, details})
+		}
+	}
+	return batch, invalid, nil
+}
+
+// parseCSVBatch decodes the measurements of a CSV body and validates each
+// of them. The header names the columns as the fields of /ingest, e.g.
+// timestamp,host,cpu,ram,label.rack; other columns, such as the id of an
+// export, are ignored and empty cells are left unset. A record with the
+// wrong number of cells only invalidates its own row, while a body that is
+// not CSV is rejected as a whole.
+func parseCSVBatch(body []byte) ([]Measurement, []RowErrors, error) {
+	reader := csv.NewReader(bytes.NewReader(body))
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil, checkBatchSize(0)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var batch []Measurement
+	var invalid []RowErrors
+	for row := 0; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil && !errors.Is(err, csv.ErrFieldCount) {
+			return nil, nil, err
+		}
+		if err != nil {
+			batch = append(batch, Measurement{})
+			invalid = append(invalid, RowErrors{row, []FieldError{{"", fmt.Sprintf("has %d cells, not the %d of the header", len(record), len(header))}}})
+			continue
+		}
+
+		values := url.Values{}
+		for i, cell := range record {
+			if cell != "" {
+				values.Set(header[i], cell)
+			}
+		}
+		var details []FieldError
+		measurement, err := measurementFromValues(values)
+		if err != nil {
+			details = []FieldError{{"", err.Error()}}
+		} else {
+			details = measurement.validate()
+		}
+		batch = append(batch, measurement)
+		if len(details) > 0 {
+			invalid = append(invalid, RowErrors{row, details})
+		}
+	}
+	if err := checkBatchSize(len(batch)); err != nil {
+		return nil, nil, err
+	}
+	return batch, invalid, nil
+}
+
+// jsonTypeName names the JSON type that decodes into t, for error messages.
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	}
+	return "a number"
+}
+
+// createMeasurementBatch stores the measurements of a batch body in the
+// format of contentType, see parseImport. It responds 201 when all of them
+// were stored and 207 when some failed.
+func createMeasurementBatch(c *gin.Context, contentType string, body []byte) {
+	batch, invalid, err := parseImport(contentType, body)
+	if err != nil {
+		respondError(c, validationError(err))
+		return
+	}
+	if len(invalid) > 0 {
+		var details []FieldError
+		for _, row := range invalid {
+			for _, detail := range row.Errors {
+				field := fmt.Sprintf("[%d]", row.Row)
+				if detail.Field != "" {
+					field += "." + detail.Field
+				}
+				details = append(details, FieldError{field, detail.Message})
+			}
+		}
+		respondError(c, invalidMeasurement(details))
+		return
+	}
+
+	result, err := insertMeasurements(c.Request.Context(), batch)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	status := http.StatusCreated
+	if len(result.Failed) > 0 {
+		status = http.StatusMultiStatus
+	}
+	c.JSON(status, result)
+}
+
+// insertMeasurements stores batch with a single unordered InsertMany, so
+// that measurements failing to insert, e.g. on a duplicate key, do not keep
+// the others from being stored. An error is only returned if the batch
+// failed as a whole. Unlike insertMeasurement it does not retry, since a
+// retry could store part of the batch twice.
+func insertMeasurements(ctx context.Context, batch []Measurement) (BatchResult, error) {
+	if !allowWrites(len(batch)) {
+		return BatchResult{}, errWriteRateExceeded
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	collection, err := getMongoCollection()
+	if err != nil {
+		return BatchResult{}, errDBUnavailable
+	}
+
+	// IDs are assigned up front so that the result can name them whether
+	// or not the insert failed halfway.
+	docs := make([]interface{}, len(batch))
+	for i := range batch {
+		batch[i] = withEnvironment(batch[i])
+		if batch[i].ID.IsZero() {
+			batch[i].ID = primitive.NewObjectID()
+		}
+		docs[i] = batch[i]
+	}
+
+	result := BatchResult{Inserted: []primitive.ObjectID{}, Failed: []BatchFailure{}}
+	failed := map[int]bool{}
+	_, err = collection.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	var bulkErr mongo.BulkWriteException
+	switch {
+	case errors.As(err, &bulkErr) && bulkErr.WriteConcernError == nil:
+		for _, writeErr := range bulkErr.WriteErrors {
+			failed[writeErr.Index] = true
+			result.Failed = append(result.Failed, BatchFailure{
+				Index: writeErr.Index,
+				Error: toAPIError(ctx, duplicateMeasurement(writeErr.WriteError)),
+			})
+		}
+	case err != nil:
+		return BatchResult{}, err
+	}
+
+	for i, measurement := range batch {
+		if !failed[i] {
+			result.Inserted = append(result.Inserted, measurement.ID)
+			recentCache.Add(measurement)
+			broadcastMeasurement(measurement)
+			invalidateQueryCacheFor(measurement)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestParseImport(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantTotal   int
+		wantInvalid []RowErrors
+		wantErr     bool
+	}{
+		{
+			name:        "json array",
+			contentType: "application/json",
+			body:        `[{"CPU": 10, "RAM": 20}, {"CPU": 101, "RAM": 20}]`,
+			wantTotal:   2,
+			wantInvalid: []RowErrors{{1, []FieldError{{"CPU", "must be at most 100"}}}},
+		},
+		{
+			name:        "json type error",
+			contentType: "application/json",
+			body:        `[{"CPU": "high", "RAM": 20}]`,
+			wantTotal:   1,
+			wantInvalid: []RowErrors{{0, []FieldError{{"CPU", "must be a number, not string"}}}},
+		},
+		{
+			name:        "ndjson",
+			contentType: mimeNDJSON,
+			body:        "{\"CPU\": 10, \"RAM\": 20}\n\n{\"CPU\": 10, \"RAM\": -1}\n",
+			wantTotal:   2,
+			wantInvalid: []RowErrors{{1, []FieldError{{"RAM", "must be at least 0"}}}},
+		},
+		{
+			name:        "ndjson line that is not json",
+			contentType: mimeNDJSON,
+			body:        "{\"CPU\": 10, \"RAM\": 20}\nnot json\n",
+			wantTotal:   2,
+			wantInvalid: []RowErrors{{1, []FieldError{{"", "invalid character 'o' in literal null (expecting 'u')"}}}},
+		},
+		{
+			name:        "csv",
+			contentType: mimeCSV,
+			body:        "id,timestamp,host,cpu,ram,label.rack\nx,2026-01-02T03:04:05Z,web-1,10,20,r1\n,,web-2,10,200,\n",
+			wantTotal:   2,
+			wantInvalid: []RowErrors{{1, []FieldError{{"RAM", "must be at most 100"}}}},
+		},
+		{
+			name:        "csv missing and invalid cells",
+			contentType: mimeCSV,
+			body:        "cpu,ram\n10,\nhigh,20\n",
+			wantTotal:   2,
+			wantInvalid: []RowErrors{
+				{0, []FieldError{{"", "missing ram"}}},
+				{1, []FieldError{{"", "invalid cpu: expected a number"}}},
+			},
+		},
+		{
+			name:        "csv record with the wrong number of cells",
+			contentType: mimeCSV,
+			body:        "cpu,ram\n10,20\n10\n",
+			wantTotal:   2,
+			wantInvalid: []RowErrors{{1, []FieldError{{"", "has 1 cells, not the 2 of the header"}}}},
+		},
+		{name: "csv without rows", contentType: mimeCSV, body: "cpu,ram\n", wantErr: true},
+		{name: "empty csv", contentType: mimeCSV, body: "", wantErr: true},
+		{name: "malformed csv", contentType: mimeCSV, body: "cpu,ram\n\"10,20\n", wantErr: true},
+		{name: "empty ndjson", contentType: mimeNDJSON, body: "\n\n", wantErr: true},
+		{name: "empty json array", contentType: "application/json", body: "[]", wantErr: true},
+		{
+			name:        "too many rows",
+			contentType: mimeNDJSON,
+			body:        strings.Repeat("{\"CPU\": 1, \"RAM\": 1}\n", maxBatchSize+1),
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			batch, invalid, err := parseImport(tt.contentType, []byte(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error: %v", err, tt.wantErr)
+			}
+			if len(batch) != tt.wantTotal {
+				t.Errorf("decoded %d measurements, want %d", len(batch), tt.wantTotal)
+			}
+			if !reflect.DeepEqual(invalid, tt.wantInvalid) {
+				t.Errorf("invalid = %+v, want %+v", invalid, tt.wantInvalid)
+			}
+		})
+	}
+}
+
+func TestParseCSVBatchFields(t *testing.T) {
+	body := "timestamp,host,cpu,ram,label.rack,metric.temperature\n2026-01-02T03:04:05.5Z,web-1,12.5,40,r1,21.5\n"
+	batch, invalid, err := parseImport(mimeCSV, []byte(body))
+	if err != nil || len(invalid) > 0 {
+		t.Fatalf("err = %v, invalid = %+v", err, invalid)
+	}
+	m := batch[0]
+	if got := m.Timestamp.Format("2006-01-02T15:04:05.0Z07:00"); got != "2026-01-02T03:04:05.5Z" {
+		t.Errorf("timestamp = %s", got)
+	}
+	if m.Host != "web-1" || m.CPU != 12.5 || m.RAM != 40 {
+		t.Errorf("host, cpu, ram = %q, %v, %v", m.Host, m.CPU, m.RAM)
+	}
+	if m.Labels["rack"] != "r1" || m.Metrics["temperature"] != 21.5 {
+		t.Errorf("labels = %v, metrics = %v", m.Labels, m.Metrics)
+	}
+}
+
+func TestInsertMeasurementsPartialFailure(t *testing.T) {
+	testConfig(t)
+	existing, err := insertMeasurement(context.Background(), Measurement{Timestamp: time.Now(), CPU: 1, RAM: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	repeated := primitive.NewObjectID()
+
+	tests := []struct {
+		name         string
+		ids          []primitive.ObjectID
+		wantInserted []int
+		wantFailed   []int
+	}{
+		{name: "all new", ids: []primitive.ObjectID{{}, {}, {}}, wantInserted: []int{0, 1, 2}},
+		{name: "duplicate of a stored id", ids: []primitive.ObjectID{{}, existing.ID, {}}, wantInserted: []int{0, 2}, wantFailed: []int{1}},
+		{name: "duplicate within the batch", ids: []primitive.ObjectID{repeated, {}, repeated}, wantInserted: []int{0, 1}, wantFailed: []int{2}},
+		{name: "all duplicates", ids: []primitive.ObjectID{existing.ID, existing.ID}, wantFailed: []int{0, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			batch := make([]Measurement, len(tt.ids))
+			for i, id := range tt.ids {
+				batch[i] = Measurement{ID: id, Timestamp: time.Now(), CPU: float64(i), RAM: 1}
+			}
+			result, err := insertMeasurements(context.Background(), batch)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			wantIDs := []primitive.ObjectID{}
+			for _, i := range tt.wantInserted {
+				wantIDs = append(wantIDs, batch[i].ID)
+			}
+			if !reflect.DeepEqual(result.Inserted, wantIDs) {
+				t.Errorf("inserted %v, want the IDs of positions %v: %v", result.Inserted, tt.wantInserted, wantIDs)
+			}
+			var failed []int
+			for _, failure := range result.Failed {
+				failed = append(failed, failure.Index)
+				if failure.Error.Status != http.StatusConflict {
+					t.Errorf("position %d failed with %d, want %d", failure.Index, failure.Error.Status, http.StatusConflict)
+				}
+			}
+			sort.Ints(failed)
+			if !reflect.DeepEqual(failed, tt.wantFailed) {
+				t.Errorf("failed positions %v, want %v", failed, tt.wantFailed)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BrokerStat is the last value the broker published on a $SYS topic.
+type BrokerStat struct {
+	Value     interface{} `json:"value"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+// brokerStats holds the latest $SYS values keyed by topic.
+var brokerStats = struct {
+	sync.RWMutex
+	values map[string]BrokerStat
+}{values: map[string]BrokerStat{}}
+
+// subscribeBrokerStats subscribes to the configured $SYS topics.
+func subscribeBrokerStats(client MQTTClient) error {
+	for _, topic := range cfg().MQTTSysTopics {
+		if err := client.Subscribe(topic, 0, brokerStatsHandler); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// brokerStatsHandler records a $SYS message. Numeric payloads are stored as
+// numbers, anything else (e.g. "3600 seconds") as a string.
+func brokerStatsHandler(msg mqttMessage) {
+	payload := string(msg.Payload)
+	var value interface{} = payload
+	if number, err := strconv.ParseFloat(payload, 64); err == nil {
+		value = number
+	}
+
+	brokerStats.Lock()
+	brokerStats.values[msg.Topic] = BrokerStat{Value: value, UpdatedAt: time.Now()}
+	brokerStats.Unlock()
+}
+
+// @Summary Get broker statistics
+// @Description Returns the latest values of the subscribed MQTT $SYS topics, keyed by topic
+// @Tags Broker
+// @Produce json
+// @Success 200 {object} map[string]BrokerStat
+// @Router /broker/stats [get]
+func getBrokerStats(c *gin.Context) {
+	brokerStats.RLock()
+	defer brokerStats.RUnlock()
+
+	stats := make(map[string]BrokerStat, len(brokerStats.values))
+	for topic, stat := range brokerStats.values {
+		stats[topic] = stat
+	}
+	c.JSON(http.StatusOK, stats)
+}
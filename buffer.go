@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// diskBuffer is an append-only file of measurements that could not be
+// stored, one JSON document per line, replayed once MongoDB is reachable
+// again. When the file would grow beyond maxBytes the oldest lines are
+// dropped. A nil buffer is valid and buffers nothing.
+type diskBuffer struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+}
+
+// observerBuffer keeps the observer's samples across MongoDB outages. It is
+// enabled by setting OBSERVER_BUFFER_FILE.
+var observerBuffer *diskBuffer
+
+func newDiskBuffer(path string, maxBytes int64) *diskBuffer {
+	if path == "" {
+		return nil
+	}
+	return &diskBuffer{path: path, maxBytes: maxBytes}
+}
+
+// Append adds m to the end of the buffer.
+func (b *diskBuffer) Append(m Measurement) error {
+	if b == nil {
+		return nil
+	}
+	line, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	lines, err := b.readLines()
+	if err != nil {
+		return err
+	}
+	size := int64(len(line))
+	for _, l := range lines {
+		size += int64(len(l))
+	}
+	if size > b.maxBytes {
+		dropped := 0
+		for len(lines) > 0 && size > b.maxBytes {
+			size -= int64(len(lines[0]))
+			lines = lines[1:]
+			dropped++
+		}
+		log.Printf("Warning: buffer %s is full, dropped %d oldest measurements\n", b.path, dropped)
+		if err := b.writeLines(lines); err != nil {
+			return err
+		}
+	}
+
+	file, err := os.OpenFile(b.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(line); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Replay stores the buffered measurements in order with store. A line that
+// cannot be stored ever, because it is corrupt or store rejected it as
+// invalid or a duplicate, is handed to reject and removed, so that it does
+// not hold up the lines after it. Replay stops at the first other failure,
+// which may be transient; the measurements not stored yet stay buffered.
+// The number of stored measurements is returned.
+func (b *diskBuffer) Replay(store func(Measurement) error, reject func(line []byte, err error)) (int, error) {
+	if b == nil {
+		return 0, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	lines, err := b.readLines()
+	if err != nil || len(lines) == 0 {
+		return 0, err
+	}
+
+	replayed := 0
+	for i, line := range lines {
+		var m Measurement
+		if err := json.Unmarshal(line, &m); err != nil {
+			reject(line, fmt.Errorf("corrupt line: %w", err))
+			continue
+		}
+		if err := store(m); isPermanentStoreError(err) {
+			reject(line, err)
+			continue
+		} else if err != nil {
+			if werr := b.writeLines(lines[i:]); werr != nil {
+				return replayed, werr
+			}
+			return replayed, err
+		}
+		replayed++
+	}
+	return replayed, b.writeLines(nil)
+}
+
+// isPermanentStoreError reports whether storing a measurement failed for a
+// reason a retry cannot fix, such as an invalid or duplicate measurement.
+// Those are the client errors; an unreachable or overloaded database is
+// not one.
+func isPermanentStoreError(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Status < http.StatusInternalServerError
+}
+
+// readLines returns the lines of the buffer file, each with its newline.
+func (b *diskBuffer) readLines() ([][]byte, error) {
+	data, err := os.ReadFile(b.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var lines [][]byte
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	for scanner.Scan() {
+		if line := scanner.Bytes(); len(line) > 0 {
+			lines = append(lines, append(append([]byte(nil), line...), '\n'))
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// writeLines atomically replaces the buffer file with lines.
+func (b *diskBuffer) writeLines(lines [][]byte) error {
+	tmp := b.path + ".tmp"
+	if err := os.WriteFile(tmp, bytes.Join(lines, nil), 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, b.path); err != nil {
+		return fmt.Errorf("replace buffer: %w", err)
+	}
+	return nil
+}
+
+// maxBufferBackoff bounds the wait between replays of the observer buffer
+// after transient failures.
+const maxBufferBackoff = 5 * time.Minute
+
+// bufferBackoff delays the next replay of the observer buffer after a
+// transient failure, doubling from MONGO_WRITE_BACKOFF with each failure
+// in a row.
+var bufferBackoff struct {
+	sync.Mutex
+	delay   time.Duration
+	retryAt time.Time
+}
+
+// replayObserverBuffer stores the buffered observer samples, if any, unless
+// a transient failure of the previous replay asks to wait. Samples that
+// can never be stored are dead-lettered with the source deadLetterBuffer.
+func replayObserverBuffer() {
+	bufferBackoff.Lock()
+	defer bufferBackoff.Unlock()
+	if time.Now().Before(bufferBackoff.retryAt) {
+		return
+	}
+
+	replayed, err := observerBuffer.Replay(func(m Measurement) error {
+		_, err := insertMeasurement(context.Background(), m)
+		return err
+	}, func(line []byte, err error) {
+		log.Printf("Dead-lettering buffered measurement: %s\n", err)
+		// The receipt time is the sample time, if the line has one.
+		var m Measurement
+		if json.Unmarshal(line, &m) != nil {
+			m.Timestamp = time.Now()
+		}
+		storeDeadLetter(DeadLetter{
+			Source:     deadLetterBuffer,
+			Payload:    bytes.TrimSpace(line),
+			Error:      err.Error(),
+			ReceivedAt: m.Timestamp,
+		})
+	})
+	if replayed > 0 {
+		log.Printf("Replayed %d buffered measurements\n", replayed)
+	}
+	if err != nil {
+		bufferBackoff.delay *= 2
+		if bufferBackoff.delay < cfg().MongoWriteBackoff {
+			bufferBackoff.delay = cfg().MongoWriteBackoff
+		}
+		if bufferBackoff.delay > maxBufferBackoff {
+			bufferBackoff.delay = maxBufferBackoff
+		}
+		bufferBackoff.retryAt = time.Now().Add(bufferBackoff.delay)
+		log.Printf("Error replaying buffered measurements, retrying in %s: %s\n", bufferBackoff.delay, err)
+		return
+	}
+	bufferBackoff.delay = 0
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// BulkUpdateResult reports how many measurements a bulk update matched and
+// how many of them it changed.
+type BulkUpdateResult struct {
+	Matched  int64 `json:"matched"`
+	Modified int64 `json:"modified"`
+}
+
+// fixedFields are the measurement fields a bulk update must not set.
+var fixedFields = map[string]bool{"ID": true, "Samples": true, "DeletedAt": true}
+
+// measurementFields are the fields of Measurement by their API name.
+var measurementFields = func() map[string]reflect.StructField {
+	t := reflect.TypeOf(Measurement{})
+	fields := make(map[string]reflect.StructField, t.NumField())
+	for i, schema := range measurementSchema {
+		fields[schema.Name] = t.Field(i)
+	}
+	return fields
+}()
+
+// updateValue decodes the value of a bulk update key, a field name such as
+// Host or a map entry such as Labels.rack, and checks it against the type
+// and binding tag of the field. It returns the stored key and the value.
+func updateValue(key string, raw json.RawMessage) (string, interface{}, error) {
+	name, entry, isEntry := strings.Cut(key, ".")
+	field, ok := measurementFields[name]
+	if !ok || fixedFields[name] {
+		return "", nil, errors.New("is not a field that can be updated")
+	}
+	stored := strings.Split(field.Tag.Get("bson"), ",")[0]
+	t, tag := field.Type, field.Tag.Get("binding")
+	if isEntry {
+		if t.Kind() != reflect.Map {
+			return "", nil, errors.New("only map fields have entries")
+		}
+		if !isValidMetricName(entry) {
+			return "", nil, errors.New("names must not be empty, start with $ or contain dots")
+		}
+		stored += "." + entry
+		t, tag = t.Elem(), ""
+		if rest, ok := strings.CutPrefix(field.Tag.Get("binding"), "dive,"); ok {
+			tag = rest
+		}
+	}
+
+	value := reflect.New(t)
+	if err := json.Unmarshal(raw, value.Interface()); err != nil {
+		return "", nil, fmt.Errorf("must be a %s", schemaType(t))
+	}
+	if t.Kind() == reflect.Map {
+		for _, k := range value.Elem().MapKeys() {
+			if !isValidMetricName(k.String()) {
+				return "", nil, fmt.Errorf("invalid name %q: names must not be empty, start with $ or contain dots", k.String())
+			}
+		}
+	}
+	if tag != "" {
+		validate := binding.Validator.Engine().(*validator.Validate)
+		var fieldErrs validator.ValidationErrors
+		if err := validate.Var(value.Elem().Interface(), tag); errors.As(err, &fieldErrs) {
+			return "", nil, errors.New(fieldErrorMessage(fieldErrs[0]))
+		}
+	}
+	return stored, value.Elem().Interface(), nil
+}
+
+// @Summary Update many measurements
+// @Description Sets the given fields on every measurement matching the usual filters, e.g. to correct a host name. At least one filter is required. Keys are field names as in responses, or map entries such as Labels.rack; ID, Samples and DeletedAt cannot be set. History is not recorded for bulk updates.
+// @Tags Measurements
+// @Accept json
+// @Produce json
+// @Param fields body object true "Fields to set, e.g. {\"Host\": \"web-1\", \"Labels.rack\": \"r2\"}"
+// @Param from query string false "Only measurements at or after this RFC3339 timestamp"
+// @Param to query string false "Only measurements at or before this RFC3339 timestamp"
+// @Param host query string false "Only measurements from this host"
+// @Param source query string false "host (default) for host measurements, self for those of this process" Enums(host, self)
+// @Success 200 {object} BulkUpdateResult
+// @Failure 400 {object} ErrorResponse "Missing filter or invalid fields"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 503 {object} ErrorResponse "MongoDB unavailable"
+// @Router /measurements [patch]
+func updateMeasurements(c *gin.Context) {
+	filter, err := measurementConditions(c)
+	if err != nil {
+		respondError(c, validationError(err))
+		return
+	}
+	// An empty filter would update every measurement.
+	if len(filter) == 0 {
+		respondError(c, validationError(errors.New("a bulk update requires at least one filter")))
+		return
+	}
+	source, err := querySource(c)
+	if err != nil {
+		respondError(c, validationError(err))
+		return
+	}
+	filter = fromSource(filter, source)
+	if !includeDeleted(c) {
+		filter = notDeleted(filter)
+	}
+
+	var body map[string]json.RawMessage
+	if err := json.NewDecoder(c.Request.Body).Decode(&body); err != nil {
+		respondError(c, validationError(err))
+		return
+	}
+	if len(body) == 0 {
+		respondError(c, validationError(errors.New("the body must set at least one field")))
+		return
+	}
+	keys := make([]string, 0, len(body))
+	for key := range body {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	set := bson.M{}
+	var details []FieldError
+	for _, key := range keys {
+		if name, _, isEntry := strings.Cut(key, "."); isEntry && body[name] != nil {
+			details = append(details, FieldError{key, "cannot be set along with " + name})
+			continue
+		}
+		stored, value, err := updateValue(key, body[key])
+		if err != nil {
+			details = append(details, FieldError{key, err.Error()})
+			continue
+		}
+		set[stored] = value
+	}
+	if len(details) > 0 {
+		respondError(c, invalidMeasurement(details))
+		return
+	}
+	// As on every other write, APP_ENV wins over the environment label.
+	if env := cfg().AppEnv; env != "" {
+		if labels, ok := set["labels"].(map[string]string); ok {
+			set["labels"] = withEnvironment(Measurement{Labels: labels}).Labels
+		}
+		if _, ok := set["labels."+environmentLabel]; ok {
+			set["labels."+environmentLabel] = env
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	collection, err := getMongoCollection()
+	if err != nil {
+		respondError(c, errDBUnavailable)
+		return
+	}
+
+	result, err := collection.UpdateMany(ctx, filter, bson.M{"$set": set})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, BulkUpdateResult{Matched: result.MatchedCount, Modified: result.ModifiedCount})
+}
@@ -0,0 +1,74 @@
+package main
+
+import "sync"
+
+// cacheHeader marks responses that were served from the in-memory cache
+// instead of MongoDB.
+const cacheHeader = "X-Served-From-Cache"
+
+// measurementCache is a fixed-size ring buffer of the most recently stored
+// measurements. A nil cache is valid and holds nothing.
+type measurementCache struct {
+	mu    sync.RWMutex
+	items []Measurement
+	next  int
+	full  bool
+}
+
+// recentCache is filled by the observer and the MQTT ingest path. It is
+// sized by the RecentCacheSize setting at startup; zero (the default)
+// leaves it disabled.
+var recentCache *measurementCache
+
+func newMeasurementCache(size int) *measurementCache {
+	if size <= 0 {
+		return nil
+	}
+	return &measurementCache{items: make([]Measurement, size)}
+}
+
+// Add stores m, evicting the oldest entry when the cache is full.
+func (c *measurementCache) Add(m Measurement) {
+	// Only host measurements are served from the cache.
+	if c == nil || isSelfMeasurement(m) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.items[c.next] = m
+	c.next = (c.next + 1) % len(c.items)
+	if c.next == 0 {
+		c.full = true
+	}
+}
+
+// Recent returns the cached measurements, oldest first.
+func (c *measurementCache) Recent() []Measurement {
+	if c == nil {
+		return nil
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if !c.full {
+		return append([]Measurement(nil), c.items[:c.next]...)
+	}
+	recent := make([]Measurement, 0, len(c.items))
+	recent = append(recent, c.items[c.next:]...)
+	return append(recent, c.items[:c.next]...)
+}
+
+// Latest returns the most recently added measurement, if any.
+func (c *measurementCache) Latest() (Measurement, bool) {
+	if c == nil {
+		return Measurement{}, false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if !c.full && c.next == 0 {
+		return Measurement{}, false
+	}
+	return c.items[(c.next-1+len(c.items))%len(c.items)], true
+}
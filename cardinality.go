@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+var cardinalityRejected = newCounter("measurements_cardinality_rejected_total",
+	"Number of measurements rejected for exceeding MAX_LABELS, MAX_METRICS or MAX_KEY_LENGTH.")
+
+// cardinalityErrors checks the labels and metrics of m against MAX_LABELS,
+// MAX_METRICS and MAX_KEY_LENGTH, which bound the distinct document keys a
+// publisher can create. A zero limit is not enforced. Rejected measurements
+// are counted.
+func cardinalityErrors(m Measurement) []FieldError {
+	var details []FieldError
+	for _, keys := range []struct {
+		field string
+		names []string
+		limit int
+	}{
+		{"Labels", labelNames(m.Labels), cfg().MaxLabels},
+		{"Metrics", metricNames(m.Metrics), cfg().MaxMetrics},
+	} {
+		if keys.limit > 0 && len(keys.names) > keys.limit {
+			details = append(details, FieldError{keys.field,
+				fmt.Sprintf("must have at most %d entries", keys.limit)})
+		}
+		if maxLength := cfg().MaxKeyLength; maxLength > 0 {
+			sort.Strings(keys.names)
+			for _, name := range keys.names {
+				if len(name) > maxLength {
+					details = append(details, FieldError{fmt.Sprintf("%s[%s]", keys.field, name),
+						fmt.Sprintf("names must be at most %d bytes long", maxLength)})
+				}
+			}
+		}
+	}
+	if len(details) > 0 {
+		cardinalityRejected.Inc()
+	}
+	return details
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCardinalityErrors(t *testing.T) {
+	long := strings.Repeat("k", 9)
+	tests := []struct {
+		name                          string
+		maxLabels, maxMetrics, maxKey int
+		m                             Measurement
+		want                          []FieldError
+	}{
+		{name: "no limits", m: Measurement{
+			Labels:  map[string]string{"a": "1", "b": "2", long: "3"},
+			Metrics: map[string]float64{"x": 1, "y": 2},
+		}},
+		{name: "at the limits", maxLabels: 2, maxMetrics: 1, maxKey: 8, m: Measurement{
+			Labels:  map[string]string{"a": "1", "12345678": "2"},
+			Metrics: map[string]float64{"x": 1},
+		}},
+		{name: "too many labels", maxLabels: 2, m: Measurement{
+			Labels: map[string]string{"a": "1", "b": "2", "c": "3"},
+		}, want: []FieldError{{"Labels", "must have at most 2 entries"}}},
+		{name: "too many metrics", maxMetrics: 1, m: Measurement{
+			Metrics: map[string]float64{"x": 1, "y": 2},
+		}, want: []FieldError{{"Metrics", "must have at most 1 entries"}}},
+		{name: "long names", maxKey: 8, m: Measurement{
+			Labels:  map[string]string{long: "1", "short": "2"},
+			Metrics: map[string]float64{long + "b": 1, long + "a": 2},
+		}, want: []FieldError{
+			{"Labels[" + long + "]", "names must be at most 8 bytes long"},
+			{"Metrics[" + long + "a]", "names must be at most 8 bytes long"},
+			{"Metrics[" + long + "b]", "names must be at most 8 bytes long"},
+		}},
+		{name: "every limit", maxLabels: 1, maxMetrics: 1, maxKey: 8, m: Measurement{
+			Labels:  map[string]string{"a": "1", long: "2"},
+			Metrics: map[string]float64{"x": 1, "y": 2},
+		}, want: []FieldError{
+			{"Labels", "must have at most 1 entries"},
+			{"Labels[" + long + "]", "names must be at most 8 bytes long"},
+			{"Metrics", "must have at most 1 entries"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.MaxLabels, config.MaxMetrics, config.MaxKeyLength = tt.maxLabels, tt.maxMetrics, tt.maxKey
+			useConfig(t, config)
+
+			before := cardinalityRejected.value.Load()
+			got := cardinalityErrors(tt.m)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("cardinalityErrors = %v, want %v", got, tt.want)
+			}
+			wantRejected := int64(0)
+			if len(tt.want) > 0 {
+				wantRejected = 1
+			}
+			if n := cardinalityRejected.value.Load() - before; n != wantRejected {
+				t.Errorf("counted %d rejections, want %d", n, wantRejected)
+			}
+
+			// Every write path validates through insertMeasurement, which
+			// rejects the measurement before reaching MongoDB.
+			if len(tt.want) == 0 {
+				return
+			}
+			tt.m.CPU, tt.m.RAM = 1, 1
+			_, err := insertMeasurement(context.Background(), tt.m)
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || apiErr.Status != http.StatusBadRequest || !reflect.DeepEqual(apiErr.Details, tt.want) {
+				t.Errorf("insertMeasurement err = %v, want a 400 with %v", err, tt.want)
+			}
+		})
+	}
+}
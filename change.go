@@ -0,0 +1,31 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// changeFilter decides whether the observer stores a sample. With a positive
+// delta a sample is only stored when CPU or RAM moved by more than delta
+// percentage points since the last stored one, or when maxInterval has passed
+// since then; otherwise every sample is stored.
+type changeFilter struct {
+	stored   bool
+	cpu, ram float64
+	at       time.Time
+}
+
+func (f *changeFilter) shouldStore(cpu, ram float64, now time.Time, delta float64, maxInterval time.Duration) bool {
+	switch {
+	case delta <= 0, !f.stored:
+		return true
+	case maxInterval > 0 && now.Sub(f.at) >= maxInterval:
+		return true
+	}
+	return math.Abs(cpu-f.cpu) > delta || math.Abs(ram-f.ram) > delta
+}
+
+// record remembers a sample that was stored.
+func (f *changeFilter) record(cpu, ram float64, now time.Time) {
+	f.stored, f.cpu, f.ram, f.at = true, cpu, ram, now
+}
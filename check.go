@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// checkTimeout bounds each step of the startup self-check.
+const checkTimeout = 10 * time.Second
+
+// runSelfCheck verifies that MongoDB and the MQTT broker are reachable and
+// accept both reads and writes, using the same configuration as a normal
+// start. It returns the process exit code: 0 when every check passed.
+func runSelfCheck() int {
+	code := 0
+	for _, check := range []struct {
+		name string
+		run  func() error
+	}{
+		{"MongoDB", checkMongo},
+		{"MQTT", checkMQTT},
+	} {
+		if err := check.run(); err != nil {
+			log.Printf("Self-check %s: FAILED: %s\n", check.name, err)
+			code = 1
+			continue
+		}
+		log.Printf("Self-check %s: OK\n", check.name)
+	}
+	return code
+}
+
+// checkMongo round-trips a probe document through a scratch collection so
+// the measurements themselves are left untouched.
+func checkMongo() error {
+	ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+	defer cancel()
+
+	collection, err := getMongoCollection()
+	if err != nil {
+		return err
+	}
+	probe := collection.Database().Collection("selfcheck")
+
+	result, err := probe.InsertOne(ctx, bson.M{"checked_at": time.Now()})
+	if err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+	filter := bson.M{"_id": result.InsertedID}
+	if err := probe.FindOne(ctx, filter).Err(); err != nil {
+		return fmt.Errorf("read: %w", err)
+	}
+	if _, err := probe.DeleteOne(ctx, filter); err != nil {
+		return fmt.Errorf("cleanup: %w", err)
+	}
+	return nil
+}
+
+// checkMQTT publishes a message on a private topic and waits for it to be
+// delivered back. It uses its own client ID so it does not kick a running
+// instance off the broker.
+func checkMQTT() error {
+	clientID := fmt.Sprintf("mqtt-client-check-%d", time.Now().UnixNano())
+	client, err := connectMQTT(clientID)
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	defer client.Disconnect()
+
+	topic := "monitoring/selfcheck/" + clientID
+	received := make(chan struct{}, 1)
+	err = client.Subscribe(topic, 1, func(mqttMessage) {
+		select {
+		case received <- struct{}{}:
+		default:
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("subscribe: %w", err)
+	}
+
+	if err := client.Publish(topic, 1, false, []byte("ping")); err != nil {
+		return fmt.Errorf("publish: %w", err)
+	}
+
+	select {
+	case <-received:
+		return nil
+	case <-time.After(checkTimeout):
+		return fmt.Errorf("read: message not received within %s", checkTimeout)
+	}
+}
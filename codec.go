@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// payloadCodecs convert MQTT payloads in the supported encodings to JSON,
+// so that every encoding is decoded into a Measurement by the same rules.
+var payloadCodecs = map[string]func([]byte) ([]byte, error){
+	"json":    func(payload []byte) ([]byte, error) { return payload, nil },
+	"cbor":    cborToJSON,
+	"msgpack": msgpackToJSON,
+}
+
+// cborDecoder decodes maps with string keys, which JSON can represent.
+var cborDecoder, _ = cbor.DecOptions{
+	DefaultMapType: reflect.TypeOf(map[string]interface{}(nil)),
+}.DecMode()
+
+func cborToJSON(payload []byte) ([]byte, error) {
+	var value interface{}
+	if err := cborDecoder.Unmarshal(payload, &value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+func msgpackToJSON(payload []byte) ([]byte, error) {
+	var value interface{}
+	if err := msgpack.Unmarshal(payload, &value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+// topicCodec returns the codec of payloads received on topic: the first
+// entry of MQTT_CODECS whose topic filter matches, else the codec named by
+// the last topic level, e.g. sensors/a/cbor, else JSON.
+func topicCodec(topic string) string {
+	for _, entry := range cfg().MQTTCodecs {
+		filter, codec, _ := strings.Cut(entry, "=")
+		if topicMatches(filter, topic) {
+			return codec
+		}
+	}
+	if i := strings.LastIndex(topic, "/"); i >= 0 {
+		if _, ok := payloadCodecs[topic[i+1:]]; ok {
+			return topic[i+1:]
+		}
+	}
+	return "json"
+}
+
+// validCodecEntries reports whether every MQTT_CODECS entry has the form
+// <topic filter>=<codec> with a supported codec.
+func validCodecEntries(entries []string) bool {
+	for _, entry := range entries {
+		filter, codec, ok := strings.Cut(entry, "=")
+		if _, known := payloadCodecs[codec]; !ok || filter == "" || !known {
+			return false
+		}
+	}
+	return true
+}
+
+// payloadToJSON converts a payload received on topic to JSON.
+func payloadToJSON(topic string, payload []byte) ([]byte, error) {
+	codec := topicCodec(topic)
+	data, err := payloadCodecs[codec](payload)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", codec, err)
+	}
+	return data, nil
+}
+
+// sharedSubscriptionPrefix starts a shared subscription,
+// $share/<group>/<filter>, whose messages the broker spreads across the
+// clients subscribed with the same group.
+const sharedSubscriptionPrefix = "$share/"
+
+// subscriptionFilter returns the topic filter of an MQTT_TOPIC, without the
+// $share/<group>/ of a shared subscription.
+func subscriptionFilter(topic string) string {
+	if shared, ok := strings.CutPrefix(topic, sharedSubscriptionPrefix); ok {
+		_, filter, _ := strings.Cut(shared, "/")
+		return filter
+	}
+	return topic
+}
+
+// validSubscription reports whether an MQTT_TOPIC that is a shared
+// subscription names a group without wildcards and a topic filter.
+func validSubscription(topic string) bool {
+	shared, ok := strings.CutPrefix(topic, sharedSubscriptionPrefix)
+	if !ok {
+		return true
+	}
+	group, filter, ok := strings.Cut(shared, "/")
+	return ok && group != "" && !strings.ContainsAny(group, "+#") && filter != ""
+}
+
+// topicMatches reports whether topic matches the MQTT topic filter, which
+// may contain the + (one level) and # (any remaining levels) wildcards.
+func topicMatches(filter, topic string) bool {
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+	for i, level := range filterLevels {
+		if level == "#" {
+			return true
+		}
+		if i >= len(topicLevels) || (level != "+" && level != topicLevels[i]) {
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
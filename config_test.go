@@ -0,0 +1,149 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigMongoURI(t *testing.T) {
+	tests := []struct {
+		name         string
+		uri          string
+		database     string
+		wantDatabase string
+		wantErr      bool
+	}{
+		{name: "database in the uri", uri: "mongodb://db:27017/metrics?replicaSet=rs0", wantDatabase: "metrics"},
+		{name: "MONGO_DATABASE wins", uri: "mongodb://db:27017/metrics", database: "other", wantDatabase: "other"},
+		{name: "no database", uri: "mongodb://db:27017/?tls=true", wantDatabase: defaultMongoDatabase},
+		{name: "invalid option", uri: "mongodb://db:27017/?connectTimeoutMS=soon", wantErr: true},
+		{name: "not a uri", uri: "db:27017", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MONGO_HOST", "")
+			t.Setenv("CONFIG_FILE", "")
+			t.Setenv("MONGO_URI", tt.uri)
+			t.Setenv("MONGO_DATABASE", tt.database)
+
+			config, err := loadConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error: %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if config.MongoURI != tt.uri {
+				t.Errorf("MongoURI = %q, want it unchanged", config.MongoURI)
+			}
+			if config.MongoDatabase != tt.wantDatabase {
+				t.Errorf("MongoDatabase = %q, want %q", config.MongoDatabase, tt.wantDatabase)
+			}
+		})
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		set  func(*Config)
+		// wantErr is the setting the error starts with, or empty if the
+		// configuration is valid.
+		wantErr string
+	}{
+		{name: "defaults", set: func(c *Config) {}},
+		{name: "tls cert without key", set: func(c *Config) { c.TLSCertFile = "cert.pem" }, wantErr: "TLS_CERT_FILE"},
+		{name: "tls client ca alone", set: func(c *Config) { c.TLSClientCAFile = "ca.pem" }, wantErr: "TLS_CLIENT_CA_FILE"},
+		{name: "unknown codec", set: func(c *Config) { c.MQTTCodecs = []string{"sensors/#=xml"} }, wantErr: "MQTT_CODECS"},
+		{name: "codec", set: func(c *Config) { c.MQTTCodecs = []string{"sensors/#=cbor"} }},
+		{name: "shared subscription without group", set: func(c *Config) { c.MQTTTopic = "$share//metrics/#" }, wantErr: "MQTT_TOPIC"},
+		{name: "shared subscription without filter", set: func(c *Config) { c.MQTTTopic = "$share/group" }, wantErr: "MQTT_TOPIC"},
+		{name: "shared subscription", set: func(c *Config) { c.MQTTTopic = "$share/group/metrics/#" }},
+		{name: "publish topic with wildcard", set: func(c *Config) { c.MQTTPublishTopic = "out/+" }, wantErr: "MQTT_PUBLISH_TOPIC"},
+		{name: "publish topic subscribed", set: func(c *Config) {
+			c.MQTTTopic = "metrics/#"
+			c.MQTTPublishTopic = "metrics/self"
+		}, wantErr: "MQTT_PUBLISH_TOPIC"},
+		{name: "publish topic", set: func(c *Config) { c.MQTTPublishTopic = "observer/metrics" }},
+		{name: "host topic without host", set: func(c *Config) { c.MQTTHostTopic = "metrics/#" }, wantErr: "MQTT_HOST_TOPIC"},
+		{name: "host topic", set: func(c *Config) { c.MQTTHostTopic = "metrics/{host}/#" }},
+		{name: "empty payload path key", set: func(c *Config) { c.MQTTPayloadPath = "data..reading" }, wantErr: "MQTT_PAYLOAD_PATH"},
+		{name: "request id header with colon", set: func(c *Config) { c.RequestIDHeader = "X-ID:" }, wantErr: "REQUEST_ID_HEADER"},
+		{name: "zero shutdown timeout", set: func(c *Config) { c.ShutdownTimeout = 0 }, wantErr: "SHUTDOWN_TIMEOUT"},
+		{name: "negative export timeout", set: func(c *Config) { c.ExportTimeout = -time.Second }, wantErr: "REQUEST_TIMEOUT"},
+		{name: "mqtt protocol 3", set: func(c *Config) { c.MQTTProtocolVersion = 3 }, wantErr: "MQTT_PROTOCOL_VERSION"},
+		{name: "keepalive too long", set: func(c *Config) { c.MQTTKeepAlive = 65536 * time.Second }, wantErr: "MQTT_KEEPALIVE"},
+		{name: "subscribe qos 3", set: func(c *Config) { c.MQTTSubscribeQoS = 3 }, wantErr: "MQTT_SUBSCRIBE_QOS"},
+		{name: "zero queue", set: func(c *Config) { c.MQTTQueueSize = 0 }, wantErr: "MQTT_QUEUE_SIZE"},
+		{name: "ingest ack 2", set: func(c *Config) { c.IngestAck = "2" }, wantErr: "INGEST_ACK"},
+		{name: "ingest ack majority", set: func(c *Config) { c.IngestAck = "majority" }},
+		{name: "zero observer interval", set: func(c *Config) { c.ObserverInterval = 0 }, wantErr: "OBSERVER_INTERVAL"},
+		{name: "sample window as long as the interval", set: func(c *Config) { c.CPUSampleWindow = c.ObserverInterval }, wantErr: "CPU_SAMPLE_WINDOW"},
+		{name: "jitter of 1", set: func(c *Config) { c.ObserverJitter = 1 }, wantErr: "OBSERVER_JITTER"},
+		{name: "backoff above 100", set: func(c *Config) { c.ObserverBackoffCPU = 101 }, wantErr: "OBSERVER_BACKOFF_CPU"},
+		{name: "resume above backoff", set: func(c *Config) {
+			c.ObserverBackoffCPU = 80
+			c.ObserverBackoffResumeCPU = 90
+		}, wantErr: "OBSERVER_BACKOFF_RESUME_CPU"},
+		{name: "max interval below interval", set: func(c *Config) {
+			c.ObserverBackoffCPU = 80
+			c.ObserverMaxInterval = time.Second
+		}, wantErr: "OBSERVER_MAX_INTERVAL"},
+		{name: "percent decimals 16", set: func(c *Config) { c.PercentDecimals = 16 }, wantErr: "PERCENT_DECIMALS"},
+		{name: "full precision", set: func(c *Config) { c.PercentDecimals = -1 }},
+		{name: "negative max labels", set: func(c *Config) { c.MaxLabels = -1 }, wantErr: "MAX_LABELS"},
+		{name: "alias of an unknown field", set: func(c *Config) { c.FieldAliases = []string{"Load=cpu"} }, wantErr: "FIELD_ALIASES"},
+		{name: "query cache endpoint without slash", set: func(c *Config) { c.QueryCacheEndpoints = []string{"measurements"} }, wantErr: "QUERY_CACHE_ENDPOINTS"},
+		{name: "no write attempts", set: func(c *Config) { c.MongoWriteAttempts = 0 }, wantErr: "MONGO_WRITE_ATTEMPTS"},
+		{name: "negative max concurrent", set: func(c *Config) { c.MongoMaxConcurrent = -1 }, wantErr: "MONGO_MAX_CONCURRENT"},
+		{name: "unknown read preference", set: func(c *Config) { c.MongoReadPref = "closest" }, wantErr: "MONGO_READ_PREFERENCE"},
+		{name: "read preference", set: func(c *Config) { c.MongoReadPref = "secondaryPreferred" }},
+		{name: "metrics without ram", set: func(c *Config) { c.Metrics = []string{"cpu", "disk"} }, wantErr: "METRICS"},
+		{name: "unknown metric", set: func(c *Config) { c.Metrics = []string{"cpu", "ram", "gpu"} }, wantErr: "METRICS"},
+		{name: "metrics", set: func(c *Config) { c.Metrics = []string{"cpu", "ram", "net"} }},
+		{name: "no disk workers", set: func(c *Config) { c.DiskSampleWorkers = 0 }, wantErr: "DISK_SAMPLE_WORKERS"},
+		{name: "zero buffer size", set: func(c *Config) { c.ObserverBufferMaxBytes = 0 }, wantErr: "OBSERVER_BUFFER_MAX_BYTES"},
+		{name: "negative idempotency ttl", set: func(c *Config) { c.IdempotencyKeyTTL = -time.Second }, wantErr: "IDEMPOTENCY_KEY_TTL"},
+		{name: "zero rollup interval", set: func(c *Config) { c.RollupInterval = 0 }, wantErr: "ROLLUP_INTERVAL"},
+		{name: "zero debug body", set: func(c *Config) { c.DebugHTTPMaxBody = 0 }, wantErr: "DEBUG_HTTP_MAX_BODY"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			tt.set(&config)
+			err := config.validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("err = %v, want none", err)
+				}
+				return
+			}
+			if err == nil || strings.FieldsFunc(err.Error(), func(r rune) bool { return r == ' ' || r == ',' })[0] != tt.wantErr {
+				t.Fatalf("err = %v, want one naming %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadConfigEnvErrors(t *testing.T) {
+	tests := []struct {
+		env, value string
+		wantErr    string
+	}{
+		{"OBSERVER_INTERVAL", "often", "OBSERVER_INTERVAL: "},
+		{"MQTT_WORKERS", "many", "MQTT_WORKERS: "},
+		{"MQTT_WORKERS", "-1", "MQTT_WORKERS must not be negative"},
+		{"OBSERVER_JITTER", "1.5", "OBSERVER_JITTER must be in [0, 1)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.env+"="+tt.value, func(t *testing.T) {
+			t.Setenv("CONFIG_FILE", "")
+			t.Setenv(tt.env, tt.value)
+			_, err := loadConfig()
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
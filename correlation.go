@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Correlation is the Pearson correlation coefficient between the CPU and RAM
+// usage of the measurements in a time range.
+type Correlation struct {
+	// Coefficient is between -1 and 1, or null when there are fewer than
+	// two samples or either usage did not vary.
+	Coefficient *float64 `json:"coefficient"`
+	Samples     int64    `json:"samples"`
+}
+
+// pearson accumulates the sums the Pearson correlation coefficient is
+// computed from. The values are shifted by the first pair, which keeps the
+// sums small and the result accurate for long, nearly constant series.
+type pearson struct {
+	n                     int64
+	x0, y0                float64
+	sx, sy, sxx, syy, sxy float64
+}
+
+func (p *pearson) add(x, y float64) {
+	if p.n == 0 {
+		p.x0, p.y0 = x, y
+	}
+	x, y = x-p.x0, y-p.y0
+	p.n++
+	p.sx += x
+	p.sy += y
+	p.sxx += x * x
+	p.syy += y * y
+	p.sxy += x * y
+}
+
+// coefficient returns the coefficient, or false if it is undefined.
+func (p *pearson) coefficient() (float64, bool) {
+	if p.n < 2 {
+		return 0, false
+	}
+	n := float64(p.n)
+	cov := p.sxy - p.sx*p.sy/n
+	varX := p.sxx - p.sx*p.sx/n
+	varY := p.syy - p.sy*p.sy/n
+	if varX <= 0 || varY <= 0 {
+		return 0, false
+	}
+	// Rounding may push the result just past ±1.
+	return math.Max(-1, math.Min(1, cov/math.Sqrt(varX*varY))), true
+}
+
+// @Summary Correlation between CPU and RAM usage
+// @Description Computes the Pearson correlation coefficient between the CPU and RAM usage of the measurements in the time range, e.g. to tell whether memory pressure tracks CPU load on a host. Near 1, RAM usage rises with CPU usage; near -1, it falls; near 0, they are unrelated.
+// @Tags Measurements
+// @Produce json
+// @Param from query string false "Only measurements at or after this RFC3339 timestamp"
+// @Param to query string false "Only measurements at or before this RFC3339 timestamp"
+// @Param host query string false "Only measurements from this host"
+// @Success 200 {object} Correlation
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 503 {object} ErrorResponse "MongoDB unavailable"
+// @Router /measurements/correlation [get]
+func getCorrelation(c *gin.Context) {
+	from, to, err := parseTimeRange(c)
+	if err == nil {
+		err = checkQueryWindow(from, to)
+	}
+	if err != nil {
+		respondError(c, validationError(err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	collection, err := getMongoCollection()
+	if err != nil {
+		respondError(c, errDBUnavailable)
+		return
+	}
+
+	filter := rangeFilter(from, to)
+	if host := c.Query("host"); host != "" {
+		filter["host"] = host
+	}
+	// Only the pairs are fetched, and they are summed as they stream in,
+	// so long ranges cost time but not memory.
+	findOptions := options.Find().SetProjection(bson.M{"_id": 0, "cpu": 1, "ram": 1})
+	cur, err := collection.Find(ctx, notDeleted(fromSource(filter, hostSource)), findOptions)
+	if err != nil {
+		respondError(c, internalError("Failed to query measurements"))
+		return
+	}
+	defer cur.Close(ctx)
+
+	var sums pearson
+	for cur.Next(ctx) {
+		var pair struct {
+			CPU float64 `bson:"cpu"`
+			RAM float64 `bson:"ram"`
+		}
+		if err := cur.Decode(&pair); err != nil {
+			respondError(c, internalError("Failed to decode measurements"))
+			return
+		}
+		sums.add(pair.CPU, pair.RAM)
+	}
+	if err := cur.Err(); err != nil {
+		respondError(c, internalError("Failed to query measurements"))
+		return
+	}
+
+	result := Correlation{Samples: sums.n}
+	if r, ok := sums.coefficient(); ok {
+		result.Coefficient = &r
+	}
+	c.JSON(http.StatusOK, result)
+}
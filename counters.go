@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/shirou/gopsutil/net"
+)
+
+// netCounters is a reading of the host's cumulative network byte counters,
+// summed over all interfaces.
+type netCounters struct {
+	sent, recv uint64
+	at         time.Time
+}
+
+func readNetCounters() (netCounters, error) {
+	stats, err := net.IOCounters(false)
+	if err != nil {
+		return netCounters{}, err
+	}
+	if len(stats) == 0 {
+		return netCounters{}, fmt.Errorf("no network counters available")
+	}
+	return netCounters{sent: stats[0].BytesSent, recv: stats[0].BytesRecv, at: time.Now()}, nil
+}
+
+// apply stores the cumulative counters on measurement and, given the
+// previous reading, the per-second rates since then.
+func (n netCounters) apply(measurement *Measurement, prev *netCounters) {
+	measurement.NetBytesSent = n.sent
+	measurement.NetBytesRecv = n.recv
+	if prev == nil {
+		return
+	}
+	elapsed := n.at.Sub(prev.at)
+	measurement.NetBytesSentRate = counterRate(prev.sent, n.sent, elapsed)
+	measurement.NetBytesRecvRate = counterRate(prev.recv, n.recv, elapsed)
+}
+
+// counterRate returns the per-second increase of a cumulative counter. A
+// counter that went backwards was reset, e.g. by a reboot, so the rate is
+// floored to zero instead of going negative.
+func counterRate(prev, cur uint64, elapsed time.Duration) float64 {
+	if cur < prev || elapsed <= 0 {
+		return 0
+	}
+	return float64(cur-prev) / elapsed.Seconds()
+}
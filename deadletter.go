@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DeadLetter is an MQTT message that could not be decoded or stored, kept so
+// that it can be inspected and reprocessed. The payload is the message as
+// received, base64-encoded in JSON. Source is deadLetterBuffer for observer
+// samples from OBSERVER_BUFFER_FILE, whose payload is a measurement in JSON,
+// and empty for MQTT messages.
+type DeadLetter struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Source         string             `bson:"source,omitempty" json:"source,omitempty"`
+	Topic          string             `bson:"topic" json:"topic"`
+	Payload        []byte             `bson:"payload" json:"payload"`
+	UserProperties map[string]string  `bson:"user_properties,omitempty" json:"user_properties,omitempty"`
+	Error          string             `bson:"error" json:"error"`
+	ReceivedAt     time.Time          `bson:"received_at" json:"received_at"`
+	Retries        int                `bson:"retries" json:"retries"`
+}
+
+// deadLetterBuffer is the source of dead-lettered observer buffer samples.
+const deadLetterBuffer = "observer_buffer"
+
+const (
+	defaultDeadLetterLimit = 100
+	maxDeadLetterLimit     = 1000
+)
+
+// errDeadLetterDisabled is returned by the dead-letter endpoints while
+// DEAD_LETTER_COLLECTION is not set.
+var errDeadLetterDisabled = &APIError{http.StatusNotFound, codeNotFound, "Dead-lettering is disabled", nil}
+
+// deadLetterCollection returns the collection holding the dead letters, or
+// nil while DEAD_LETTER_COLLECTION is not set.
+func deadLetterCollection() (*mongo.Collection, error) {
+	name := cfg().DeadLetterCollection
+	if name == "" {
+		return nil, nil
+	}
+	collection, err := getMongoCollection()
+	if err != nil {
+		return nil, err
+	}
+	return collection.Database().Collection(name), nil
+}
+
+// deadLetter keeps a message received at receivedAt that failed with err.
+// When MongoDB itself is the cause, this fails as well and the message is
+// only logged, as before.
+func deadLetter(msg mqttMessage, receivedAt time.Time, err error) {
+	storeDeadLetter(DeadLetter{
+		Topic:          msg.Topic,
+		Payload:        msg.Payload,
+		UserProperties: msg.UserProperties,
+		Error:          err.Error(),
+		ReceivedAt:     receivedAt,
+	})
+}
+
+// storeDeadLetter keeps letter, see deadLetter.
+func storeDeadLetter(letter DeadLetter) {
+	collection, cerr := deadLetterCollection()
+	if cerr != nil {
+		log.Println("Error dead-lettering message:", cerr)
+		return
+	}
+	if collection == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := collection.InsertOne(ctx, letter); err != nil {
+		log.Println("Error dead-lettering message:", err)
+	}
+}
+
+// decodeDeadLetter decodes the measurement of a dead letter with the
+// current configuration. Buffered observer samples are plain measurements,
+// to which the MQTT payload settings do not apply; letters without topic
+// that predate the source are those as well.
+func decodeDeadLetter(letter DeadLetter) (Measurement, error) {
+	if letter.Source == deadLetterBuffer || (letter.Source == "" && letter.Topic == "") {
+		var m Measurement
+		if err := json.Unmarshal(letter.Payload, &m); err != nil {
+			return Measurement{}, fmt.Errorf("invalid buffered measurement: %w", err)
+		}
+		return m, nil
+	}
+	msg := mqttMessage{Topic: letter.Topic, Payload: letter.Payload, UserProperties: letter.UserProperties}
+	return decodeMessage(msg, letter.ReceivedAt)
+}
+
+// @Summary List dead letters
+// @Description Lists the MQTT messages that could not be decoded or stored, newest first. Requires DEAD_LETTER_COLLECTION.
+// @Tags Broker
+// @Produce json
+// @Param topic query string false "Only messages received on this topic"
+// @Param limit query int false "Maximum number of messages (default 100, max 1000)"
+// @Success 200 {array} DeadLetter
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 404 {object} ErrorResponse "Dead-lettering disabled"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 503 {object} ErrorResponse "MongoDB unavailable"
+// @Router /deadletter [get]
+func listDeadLetters(c *gin.Context) {
+	limit := int64(defaultDeadLetterLimit)
+	if raw := c.Query("limit"); raw != "" {
+		var err error
+		limit, err = strconv.ParseInt(raw, 10, 64)
+		if err != nil || limit < 1 || limit > maxDeadLetterLimit {
+			respondError(c, validationError(fmt.Errorf("invalid limit: expected a number between 1 and %d", maxDeadLetterLimit)))
+			return
+		}
+	}
+
+	collection, err := deadLetterCollection()
+	if err != nil {
+		respondError(c, errDBUnavailable)
+		return
+	}
+	if collection == nil {
+		respondError(c, errDeadLetterDisabled)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if topic := c.Query("topic"); topic != "" {
+		filter["topic"] = topic
+	}
+	findOptions := options.Find().SetSort(bson.M{"_id": -1}).SetLimit(limit)
+	cur, err := collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		respondError(c, internalError("Failed to retrieve dead letters"))
+		return
+	}
+	defer cur.Close(ctx)
+
+	letters := []DeadLetter{}
+	if err := cur.All(ctx, &letters); err != nil {
+		respondError(c, internalError("Failed to decode dead letters"))
+		return
+	}
+
+	c.JSON(http.StatusOK, letters)
+}
+
+// @Summary Retry a dead letter
+// @Description Processes a dead-lettered MQTT message again, with the current configuration and the time it was originally received. Buffered observer samples are decoded as measurements in JSON. On success the measurement is stored and the dead letter removed; otherwise the dead letter is kept with the new error.
+// @Tags Broker
+// @Produce json
+// @Param id path string true "Dead letter ID"
+// @Success 201 {object} Measurement
+// @Failure 400 {object} ErrorResponse "Invalid ID or payload still not decodable"
+// @Failure 404 {object} ErrorResponse "Dead letter not found or dead-lettering disabled"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 503 {object} ErrorResponse "MongoDB unavailable"
+// @Router /deadletter/{id}/retry [post]
+func retryDeadLetter(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		respondError(c, errInvalidID)
+		return
+	}
+
+	collection, err := deadLetterCollection()
+	if err != nil {
+		respondError(c, errDBUnavailable)
+		return
+	}
+	if collection == nil {
+		respondError(c, errDeadLetterDisabled)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	var letter DeadLetter
+	err = collection.FindOne(ctx, bson.M{"_id": id}).Decode(&letter)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		respondError(c, &APIError{http.StatusNotFound, codeNotFound, "Dead letter not found", nil})
+		return
+	}
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	// keep records the error of a failed retry on the dead letter.
+	keep := func(err error) {
+		update := bson.M{"$set": bson.M{"error": err.Error()}, "$inc": bson.M{"retries": 1}}
+		if _, uerr := collection.UpdateByID(ctx, id, update); uerr != nil {
+			log.Println("Error updating dead letter:", uerr)
+		}
+	}
+
+	measurement, err := decodeDeadLetter(letter)
+	if err != nil {
+		keep(err)
+		respondError(c, validationError(err))
+		return
+	}
+	stored, err := insertMeasurement(ctx, measurement)
+	if err != nil {
+		keep(err)
+		respondError(c, err)
+		return
+	}
+
+	if _, err := collection.DeleteOne(ctx, bson.M{"_id": id}); err != nil {
+		log.Println("Error removing retried dead letter:", err)
+	}
+	c.JSON(http.StatusCreated, responseMeasurement(stored))
+}
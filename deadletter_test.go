@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDecodeDeadLetter(t *testing.T) {
+	config := defaultConfig()
+	config.MQTTCodecs = []string{"#=cbor"}
+	config.MQTTPayloadPath = "data"
+	useConfig(t, config)
+
+	sample := []byte(`{"Timestamp": "2026-01-02T03:04:05Z", "Host": "web-1", "CPU": 10, "RAM": 20}`)
+	receivedAt := time.Date(2026, 1, 2, 3, 4, 6, 0, time.UTC)
+	tests := []struct {
+		name    string
+		letter  DeadLetter
+		wantErr bool
+	}{
+		// The MQTT settings would decode the sample as CBOR under data.
+		{name: "buffered sample", letter: DeadLetter{Source: deadLetterBuffer, Payload: sample, ReceivedAt: receivedAt}},
+		{name: "buffered sample without source", letter: DeadLetter{Payload: sample, ReceivedAt: receivedAt}},
+		{name: "corrupt buffered sample", letter: DeadLetter{Source: deadLetterBuffer, Payload: []byte(`{"CPU": 1`)}, wantErr: true},
+		{name: "mqtt message", letter: DeadLetter{Topic: "sensors/web-1", Payload: sample, ReceivedAt: receivedAt}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := decodeDeadLetter(tt.letter)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error: %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			want := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+			if m.Host != "web-1" || m.CPU != 10 || m.RAM != 20 || !m.Timestamp.Equal(want) {
+				t.Errorf("decoded %+v, want the buffered sample", m)
+			}
+		})
+	}
+}
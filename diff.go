@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MeasurementDiff is the change from measurement A to measurement B. Each
+// numeric field holds B's value minus A's, in the unit of the field;
+// percentages are differences in percentage points.
+type MeasurementDiff struct {
+	A primitive.ObjectID `json:"a"`
+	B primitive.ObjectID `json:"b"`
+	// TimeGapSeconds is B's timestamp minus A's.
+	TimeGapSeconds float64 `json:"time_gap_seconds"`
+
+	CPU              float64 `json:"cpu"`
+	RAM              float64 `json:"ram"`
+	NetBytesSent     int64   `json:"net_bytes_sent"`
+	NetBytesRecv     int64   `json:"net_bytes_recv"`
+	NetBytesSentRate float64 `json:"net_bytes_sent_rate"`
+	NetBytesRecvRate float64 `json:"net_bytes_recv_rate"`
+
+	// Disks and Metrics hold the difference for every path or name either
+	// measurement has, null if only one of them has it.
+	Disks   map[string]*float64 `json:"disks,omitempty"`
+	Metrics map[string]*float64 `json:"metrics,omitempty"`
+
+	// Changed lists the non-numeric fields that differ, Host or a label
+	// such as Labels.rack, with A's and B's value.
+	Changed map[string][2]string `json:"changed,omitempty"`
+}
+
+// diffMeasurements computes the change from a to b.
+func diffMeasurements(a, b Measurement) MeasurementDiff {
+	diff := MeasurementDiff{
+		A:                a.ID,
+		B:                b.ID,
+		TimeGapSeconds:   b.Timestamp.Sub(a.Timestamp).Seconds(),
+		CPU:              roundPercent(b.CPU - a.CPU),
+		RAM:              roundPercent(b.RAM - a.RAM),
+		NetBytesSent:     int64(b.NetBytesSent - a.NetBytesSent),
+		NetBytesRecv:     int64(b.NetBytesRecv - a.NetBytesRecv),
+		NetBytesSentRate: b.NetBytesSentRate - a.NetBytesSentRate,
+		NetBytesRecvRate: b.NetBytesRecvRate - a.NetBytesRecvRate,
+		Disks:            diffValues(a.Disks, b.Disks, roundPercent),
+		Metrics:          diffValues(a.Metrics, b.Metrics, func(v float64) float64 { return v }),
+		Changed:          map[string][2]string{},
+	}
+	if a.Host != b.Host {
+		diff.Changed["Host"] = [2]string{a.Host, b.Host}
+	}
+	for name := range a.Labels {
+		if a.Labels[name] != b.Labels[name] {
+			diff.Changed["Labels."+name] = [2]string{a.Labels[name], b.Labels[name]}
+		}
+	}
+	for name := range b.Labels {
+		if _, ok := a.Labels[name]; !ok {
+			diff.Changed["Labels."+name] = [2]string{"", b.Labels[name]}
+		}
+	}
+	return diff
+}
+
+// diffValues returns b's values minus a's, passed through round, by key.
+func diffValues(a, b map[string]float64, round func(float64) float64) map[string]*float64 {
+	diff := map[string]*float64{}
+	for key, va := range a {
+		if vb, ok := b[key]; ok {
+			d := round(vb - va)
+			diff[key] = &d
+		} else {
+			diff[key] = nil
+		}
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			diff[key] = nil
+		}
+	}
+	return diff
+}
+
+// @Summary Compare two measurements
+// @Description Returns the field-by-field change from measurement a to measurement b: the difference of every numeric field, the time between them and the host and labels that differ.
+// @Tags Measurements
+// @Produce json
+// @Param a query string true "ID of the first measurement"
+// @Param b query string true "ID of the second measurement"
+// @Success 200 {object} MeasurementDiff
+// @Failure 400 {object} ErrorResponse "Invalid ID"
+// @Failure 404 {object} ErrorResponse "Measurement not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 503 {object} ErrorResponse "MongoDB unavailable"
+// @Router /measurements/diff [get]
+func getMeasurementDiff(c *gin.Context) {
+	var ids [2]primitive.ObjectID
+	for i, param := range []string{"a", "b"} {
+		id, err := primitive.ObjectIDFromHex(c.Query(param))
+		if err != nil {
+			respondError(c, &APIError{http.StatusBadRequest, codeInvalidID, "Invalid ID",
+				[]FieldError{{Field: param, Message: "must be a measurement ID"}}})
+			return
+		}
+		ids[i] = id
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	collection, err := getMongoCollection()
+	if err != nil {
+		respondError(c, errDBUnavailable)
+		return
+	}
+
+	var measurements [2]Measurement
+	for i, id := range ids {
+		err := collection.FindOne(ctx, notDeleted(bson.M{"_id": id})).Decode(&measurements[i])
+		if err != nil {
+			apiErr := toAPIError(ctx, err)
+			if apiErr == errNotFound {
+				apiErr = &APIError{http.StatusNotFound, codeNotFound,
+					fmt.Sprintf("Measurement %s not found", id.Hex()), nil}
+			}
+			respondError(c, apiErr)
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, diffMeasurements(measurements[0], measurements[1]))
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"log"
+	"sync"
+
+	"github.com/shirou/gopsutil/disk"
+)
+
+// getDiskUsage returns the used percentage of each mount path, sampling up
+// to workers paths concurrently to keep the observer tick short. Paths that
+// cannot be sampled are logged and left out.
+func getDiskUsage(paths []string, workers int) map[string]float64 {
+	if len(paths) == 0 {
+		return nil
+	}
+
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		usage = make(map[string]float64, len(paths))
+		jobs  = make(chan string)
+	)
+	if workers > len(paths) {
+		workers = len(paths)
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range jobs {
+				stat, err := disk.Usage(path)
+				if err != nil {
+					log.Printf("Error getting disk usage of %s: %s\n", path, err)
+					continue
+				}
+				mu.Lock()
+				usage[path] = stat.UsedPercent
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, path := range paths {
+		jobs <- path
+	}
+	close(jobs)
+	wg.Wait()
+	return usage
+}
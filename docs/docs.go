@@ -16,198 +16,3699 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/measurements": {
+        "/admin/config": {
             "get": {
-                "description": "Retrieves the CPU and RAM usage in percentages",
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Returns every setting as currently in effect, after the config file, the environment and any reload, by its config file name. The admin key and the passwords in MONGO_URI and MQTT_BROKER_URL are redacted.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Measurements"
+                    "Admin"
                 ],
-                "summary": "Get CPU and RAM usage",
+                "summary": "Get the effective configuration",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/main.Measurement"
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid API key",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Admin API disabled",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/indexes": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Lists the indexes of the measurement collection",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "List indexes",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/main.IndexSpec"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid API key",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Admin API disabled",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "MongoDB unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
                         }
                     }
                 }
             },
             "post": {
-                "description": "Create a new measurement record",
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Creates a named index on the measurement collection. Keys are indexed in the given order.",
                 "consumes": [
                     "application/json"
                 ],
                 "produces": [
                     "application/json"
                 ],
-                "summary": "Create a new measurement",
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Create an index",
                 "parameters": [
                     {
-                        "description": "Measurement object to be created",
-                        "name": "measurement",
+                        "description": "Index to create",
+                        "name": "index",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/main.Measurement"
+                            "$ref": "#/definitions/main.IndexSpec"
                         }
                     }
                 ],
                 "responses": {
                     "201": {
-                        "description": "Measurement created successfully",
+                        "description": "Created",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/main.IndexSpec"
                         }
                     },
                     "400": {
-                        "description": "Bad request",
+                        "description": "Invalid index",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid API key",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Admin API disabled",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflicting index",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
                         }
                     },
                     "500": {
                         "description": "Internal server error",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "MongoDB unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
                         }
                     }
                 }
             }
         },
-        "/measurements/{id}": {
-            "get": {
-                "description": "Get a measurement record by ID",
+        "/admin/maintenance": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Enables or disables maintenance mode. While enabled, the write endpoints answer 503 with Retry-After and reads keep working, e.g. during a backup or migration. The mode is kept in memory and ends with a restart.",
+                "consumes": [
+                    "application/json"
+                ],
                 "produces": [
                     "application/json"
                 ],
-                "summary": "Get a measurement by ID",
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Toggle maintenance mode",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "Measurement ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "description": "enabled and, optionally, retry_after_seconds (default 60); since is ignored",
+                        "name": "mode",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.MaintenanceMode"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Measurement object",
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/main.Measurement"
+                            "$ref": "#/definitions/main.MaintenanceMode"
                         }
                     },
-                    "404": {
-                        "description": "Measurement not found",
+                    "400": {
+                        "description": "Invalid request",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/main.ErrorResponse"
                         }
                     },
-                    "500": {
-                        "description": "Internal server error",
+                    "401": {
+                        "description": "Invalid API key",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Admin API disabled",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
                         }
                     }
                 }
-            },
-            "put": {
-                "description": "Update a measurement record by ID",
-                "consumes": [
-                    "application/json"
+            }
+        },
+        "/admin/observer/pause": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
                 ],
+                "description": "Stops the resource observer from sampling this machine until it is resumed, e.g. during a noisy maintenance window that should not be recorded. MQTT and API ingestion carry on. The state is kept in memory and a restart resumes the observer.",
                 "produces": [
                     "application/json"
                 ],
-                "summary": "Update a measurement",
-                "parameters": [
-                    {
-                        "type": "string",
-                        "description": "Measurement ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Pause the resource observer",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.ObserverState"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid API key",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
                     },
+                    "403": {
+                        "description": "Admin API disabled",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/observer/resume": {
+            "post": {
+                "security": [
                     {
-                        "description": "Measurement object to be updated",
-                        "name": "measurement",
-                        "in": "body",
-                        "required": true,
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Restarts the sampling of a paused resource observer; the next sample is taken one OBSERVER_INTERVAL later.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Resume the resource observer",
+                "responses": {
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/main.Measurement"
+                            "$ref": "#/definitions/main.ObserverState"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid API key",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Admin API disabled",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
                         }
                     }
+                }
+            }
+        },
+        "/admin/reload": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Re-reads the config file and environment and applies the hot-reloadable settings. Changed settings that need a restart are reported but not applied.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
                 ],
+                "summary": "Reload the configuration",
                 "responses": {
                     "200": {
-                        "description": "Measurement updated successfully",
+                        "description": "OK",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/main.ReloadResult"
                         }
                     },
                     "400": {
-                        "description": "Bad request",
+                        "description": "Invalid configuration",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid API key",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Admin API disabled",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/storage": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Reports the document count, data, storage and index sizes and the average document size of the measurement collection, to judge when to tighten retention",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Get storage statistics",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.StorageStats"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid API key",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Admin API disabled",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
                         }
                     },
                     "500": {
                         "description": "Internal server error",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "MongoDB unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
                         }
                     }
                 }
-            },
-            "delete": {
-                "description": "Delete a measurement record by ID",
-                "summary": "Delete a measurement",
+            }
+        },
+        "/api/v1/query_range": {
+            "get": {
+                "description": "Answers basic Prometheus query_range requests so that Grafana's Prometheus data source can chart the data. The query is cpu or ram with optional label=\"value\" matchers, where the host label selects the host. Samples are averaged per host over each step.",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Interop"
+                ],
+                "summary": "Prometheus range query",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Measurement ID",
-                        "name": "id",
-                        "in": "path",
+                        "description": "cpu or ram, e.g. cpu{host=\\",
+                        "name": "query",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Unix or RFC3339 start timestamp",
+                        "name": "start",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Unix or RFC3339 end timestamp",
+                        "name": "end",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Resolution as a duration or number of seconds",
+                        "name": "step",
+                        "in": "query",
                         "required": true
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Measurement deleted successfully",
+                        "description": "OK",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/main.PrometheusResponse"
                         }
                     },
-                    "500": {
-                        "description": "Internal server error",
+                    "400": {
+                        "description": "Bad Request",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/main.PrometheusResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.PrometheusResponse"
                         }
                     }
                 }
-            }
-        }
-    },
-    "definitions": {
-        "main.Measurement": {
-            "type": "object",
-            "properties": {
-                "cpu": {
+            },
+            "post": {
+                "description": "Answers basic Prometheus query_range requests so that Grafana's Prometheus data source can chart the data. The query is cpu or ram with optional label=\"value\" matchers, where the host label selects the host. Samples are averaged per host over each step.",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Interop"
+                ],
+                "summary": "Prometheus range query",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "cpu or ram, e.g. cpu{host=\\",
+                        "name": "query",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Unix or RFC3339 start timestamp",
+                        "name": "start",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Unix or RFC3339 end timestamp",
+                        "name": "end",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Resolution as a duration or number of seconds",
+                        "name": "step",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.PrometheusResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.PrometheusResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.PrometheusResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/baselines": {
+            "get": {
+                "description": "Lists the expected average CPU and RAM usage of every host that has a baseline",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Hosts"
+                ],
+                "summary": "List baselines",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/main.Baseline"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "MongoDB unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/baselines/{host}": {
+            "put": {
+                "description": "Creates or replaces the expected average CPU and RAM usage of a host, which /measurements/deviation compares against",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Hosts"
+                ],
+                "summary": "Set the baseline of a host",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Host name",
+                        "name": "host",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Expected usage in percent; host and updated_at are ignored",
+                        "name": "baseline",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.Baseline"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.Baseline"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid baseline",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "MongoDB unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/broker/stats": {
+            "get": {
+                "description": "Returns the latest values of the subscribed MQTT $SYS topics, keyed by topic",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Broker"
+                ],
+                "summary": "Get broker statistics",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "$ref": "#/definitions/main.BrokerStat"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/deadletter": {
+            "get": {
+                "description": "Lists the MQTT messages that could not be decoded or stored, newest first. Requires DEAD_LETTER_COLLECTION.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Broker"
+                ],
+                "summary": "List dead letters",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Only messages received on this topic",
+                        "name": "topic",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of messages (default 100, max 1000)",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/main.DeadLetter"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Dead-lettering disabled",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "MongoDB unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/deadletter/{id}/retry": {
+            "post": {
+                "description": "Processes a dead-lettered MQTT message again, with the current configuration and the time it was originally received. Buffered observer samples are decoded as measurements in JSON. On success the measurement is stored and the dead letter removed; otherwise the dead letter is kept with the new error.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Broker"
+                ],
+                "summary": "Retry a dead letter",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Dead letter ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/main.Measurement"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid ID or payload still not decodable",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Dead letter not found or dead-lettering disabled",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "MongoDB unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/grafana/": {
+            "get": {
+                "description": "Answers the connection test of Grafana's SimpleJSON data source pointed at /grafana",
+                "tags": [
+                    "Interop"
+                ],
+                "summary": "SimpleJSON data source test",
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    }
+                }
+            }
+        },
+        "/grafana/query": {
+            "post": {
+                "description": "Answers the queries of Grafana's SimpleJSON data source: each target is cpu or ram with optional label=\"value\" matchers, e.g. cpu{host=\"web-1\"}, and is averaged per host over each interval of the range. Only time series targets are supported.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Interop"
+                ],
+                "summary": "SimpleJSON query",
+                "parameters": [
+                    {
+                        "description": "Range, interval and targets of the panel",
+                        "name": "query",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.SimpleJSONQuery"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/main.SimpleJSONSeries"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "MongoDB unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/grafana/search": {
+            "post": {
+                "description": "Lists the metrics a SimpleJSON panel can query, optionally those starting with target",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Interop"
+                ],
+                "summary": "SimpleJSON metric search",
+                "parameters": [
+                    {
+                        "description": "What the user typed so far",
+                        "name": "search",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/main.SimpleJSONSearch"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/health": {
+            "get": {
+                "description": "Reports the state of MongoDB, the MQTT connection and, with HEALTH_MAX_DATA_AGE set, whether recent data is being stored. Responds 503 when degraded.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Health"
+                ],
+                "summary": "Health check",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.Health"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.Health"
+                        }
+                    }
+                }
+            }
+        },
+        "/hosts": {
+            "get": {
+                "description": "Lists the distinct hosts that reported measurements, optionally restricted to a time range",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Hosts"
+                ],
+                "summary": "List hosts",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Only hosts active at or after this RFC3339 timestamp",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only hosts active at or before this RFC3339 timestamp",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Include each host's latest measurement timestamp",
+                        "name": "latest",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/main.HostInfo"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "MongoDB unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/ingest": {
+            "get": {
+                "description": "Creates a measurement from query parameters or a form-encoded body, for devices that cannot send JSON. Labels are given as label.\u003cname\u003e=\u003cvalue\u003e and additional metrics as metric.\u003cname\u003e=\u003cnumber\u003e.",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "tags": [
+                    "Measurements"
+                ],
+                "summary": "Ingest a measurement from parameters",
+                "parameters": [
+                    {
+                        "type": "number",
+                        "description": "CPU usage in percent",
+                        "name": "cpu",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "number",
+                        "description": "RAM usage in percent",
+                        "name": "ram",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Host name",
+                        "name": "host",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC3339 timestamp, defaults to now",
+                        "name": "timestamp",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Measurement created successfully",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "MongoDB unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Creates a measurement from query parameters or a form-encoded body, for devices that cannot send JSON. Labels are given as label.\u003cname\u003e=\u003cvalue\u003e and additional metrics as metric.\u003cname\u003e=\u003cnumber\u003e.",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "tags": [
+                    "Measurements"
+                ],
+                "summary": "Ingest a measurement from parameters",
+                "parameters": [
+                    {
+                        "type": "number",
+                        "description": "CPU usage in percent",
+                        "name": "cpu",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "number",
+                        "description": "RAM usage in percent",
+                        "name": "ram",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Host name",
+                        "name": "host",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC3339 timestamp, defaults to now",
+                        "name": "timestamp",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Measurement created successfully",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "MongoDB unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/measurements": {
+            "get": {
+                "description": "Retrieves the CPU and RAM usage in percentages. Accept: application/x-protobuf returns a MeasurementList message of proto/measurement.proto.",
+                "produces": [
+                    "application/json",
+                    "application/x-protobuf"
+                ],
+                "tags": [
+                    "Measurements"
+                ],
+                "summary": "Get CPU and RAM usage",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Only measurements at or after this RFC3339 timestamp",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only measurements at or before this RFC3339 timestamp (defaults to now when from is set)",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only measurements from this host",
+                        "name": "host",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "host",
+                            "self"
+                        ],
+                        "type": "string",
+                        "description": "host (default) for host measurements, self for those of this process",
+                        "name": "source",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Only measurements with CPU usage above this value",
+                        "name": "cpu_gt",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Only measurements with CPU usage below this value",
+                        "name": "cpu_lt",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Only measurements with RAM usage above this value",
+                        "name": "ram_gt",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Only measurements with RAM usage below this value",
+                        "name": "ram_lt",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only measurements having this additional metric, see metric_gt and metric_lt",
+                        "name": "metric",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Only measurements whose metric is above this value",
+                        "name": "metric_gt",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Only measurements whose metric is below this value",
+                        "name": "metric_lt",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "all",
+                            "any"
+                        ],
+                        "type": "string",
+                        "description": "Combine filters with AND (all, default) or OR (any)",
+                        "name": "match",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Serve the most recent measurements from the in-memory cache if MongoDB is unavailable",
+                        "name": "recent",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Include the hourly rollups of compacted measurements, marked by a non-zero Samples (default: when from is older than ROLLUP_AGE and the query is not paginated)",
+                        "name": "rollups",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page size, enables pagination in ID order (default 1000, max 10000)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Return the page after the one whose X-Next-Token header carried this token",
+                        "name": "after_token",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Include soft-deleted measurements, marked by DeletedAt",
+                        "name": "include_deleted",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.Measurement"
+                        },
+                        "headers": {
+                            "X-Data-Source": {
+                                "type": "string",
+                                "description": "raw, or raw, rollups when rollups were included"
+                            },
+                            "X-Next-Token": {
+                                "type": "string",
+                                "description": "Token of the next page, absent on the last page"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "MongoDB unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Create a new measurement record. JSON is the primary format; form-encoded bodies are accepted as for /ingest. A JSON array of up to 1000 measurements, or a text/csv or application/x-ndjson body with up to 1000 rows, is stored as a batch and answered with a BatchResult, with status 207 if some of them failed.",
+                "consumes": [
+                    "application/json",
+                    "application/x-www-form-urlencoded",
+                    "text/csv",
+                    "application/x-ndjson"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Create a new measurement",
+                "parameters": [
+                    {
+                        "description": "Measurement object to be created",
+                        "name": "measurement",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.Measurement"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Key under which a retry returns the original response instead of storing again",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Measurement created successfully",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "207": {
+                        "description": "Batch partially stored",
+                        "schema": {
+                            "$ref": "#/definitions/main.BatchResult"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Idempotency-Key in progress or used with a different body, or the measurement duplicates a unique index key",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "MongoDB unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "description": "Sets the given fields on every measurement matching the usual filters, e.g. to correct a host name. At least one filter is required. Keys are field names as in responses, or map entries such as Labels.rack; ID, Samples and DeletedAt cannot be set. History is not recorded for bulk updates.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Measurements"
+                ],
+                "summary": "Update many measurements",
+                "parameters": [
+                    {
+                        "description": "Fields to set, e.g. {\\",
+                        "name": "fields",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "object"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only measurements at or after this RFC3339 timestamp",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only measurements at or before this RFC3339 timestamp",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only measurements from this host",
+                        "name": "host",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "host",
+                            "self"
+                        ],
+                        "type": "string",
+                        "description": "host (default) for host measurements, self for those of this process",
+                        "name": "source",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.BulkUpdateResult"
+                        }
+                    },
+                    "400": {
+                        "description": "Missing filter or invalid fields",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "MongoDB unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/measurements/around": {
+            "get": {
+                "description": "Returns the measurements immediately before and after a timestamp, oldest first, to give context around a flagged event. A measurement taken exactly at ts counts as after it.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Measurements"
+                ],
+                "summary": "Measurements around a moment",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "RFC3339 timestamp to look around",
+                        "name": "ts",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of measurements before ts (default 5, max 100)",
+                        "name": "before",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of measurements at or after ts (default 5, max 100)",
+                        "name": "after",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only measurements from this host",
+                        "name": "host",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/main.Measurement"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "MongoDB unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/measurements/availability": {
+            "get": {
+                "description": "Turns the gaps between the measurements of a host into an availability percentage and the list of downtime windows. A gap counts as downtime once it exceeds twice the interval the host samples at.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Hosts"
+                ],
+                "summary": "Availability of a host",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Host name",
+                        "name": "host",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Start of the range as an RFC3339 timestamp (default 24 hours before to)",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "End of the range as an RFC3339 timestamp (default now)",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Interval the host samples at as a Go duration (default OBSERVER_INTERVAL)",
+                        "name": "interval",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.Availability"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "MongoDB unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/measurements/by-host": {
+            "get": {
+                "description": "Returns, per host, the latest CPU and RAM usage and their averages over the time range, for a fleet overview",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Hosts"
+                ],
+                "summary": "Load by host",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Only measurements at or after this RFC3339 timestamp",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only measurements at or before this RFC3339 timestamp",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "host",
+                            "cpu",
+                            "avg_cpu"
+                        ],
+                        "type": "string",
+                        "description": "Order by host name (default), latest CPU or average CPU, highest first",
+                        "name": "sort",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/main.HostLoad"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "MongoDB unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/measurements/correlation": {
+            "get": {
+                "description": "Computes the Pearson correlation coefficient between the CPU and RAM usage of the measurements in the time range, e.g. to tell whether memory pressure tracks CPU load on a host. Near 1, RAM usage rises with CPU usage; near -1, it falls; near 0, they are unrelated.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Measurements"
+                ],
+                "summary": "Correlation between CPU and RAM usage",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Only measurements at or after this RFC3339 timestamp",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only measurements at or before this RFC3339 timestamp",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only measurements from this host",
+                        "name": "host",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.Correlation"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "MongoDB unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/measurements/delete-older-than": {
+            "get": {
+                "description": "Reports how many raw measurements, and from which time span, the next compaction run would roll up and delete with the current ROLLUP_AGE, or with older_than if given. Nothing is deleted.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Measurements"
+                ],
+                "summary": "Preview retention",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Age to preview instead of ROLLUP_AGE, e.g. 720h",
+                        "name": "older_than",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.RetentionPreview"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "MongoDB unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/measurements/deviation": {
+            "get": {
+                "description": "Compares the average CPU and RAM usage of every host with a baseline over the time range with that baseline, largest deviation first, to surface machines behaving unlike their own norm",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Hosts"
+                ],
+                "summary": "Deviation from the baselines",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Only measurements at or after this RFC3339 timestamp",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only measurements at or before this RFC3339 timestamp",
+                        "name": "to",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/main.HostDeviation"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "MongoDB unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/measurements/diff": {
+            "get": {
+                "description": "Returns the field-by-field change from measurement a to measurement b: the difference of every numeric field, the time between them and the host and labels that differ.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Measurements"
+                ],
+                "summary": "Compare two measurements",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID of the first measurement",
+                        "name": "a",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ID of the second measurement",
+                        "name": "b",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.MeasurementDiff"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid ID",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Measurement not found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "MongoDB unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/measurements/export": {
+            "get": {
+                "description": "Streams the measurements matching the usual filters as CSV or Parquet",
+                "produces": [
+                    "text/csv",
+                    "application/vnd.apache.parquet"
+                ],
+                "tags": [
+                    "Measurements"
+                ],
+                "summary": "Export measurements",
+                "parameters": [
+                    {
+                        "enum": [
+                            "csv",
+                            "parquet"
+                        ],
+                        "type": "string",
+                        "default": "csv",
+                        "description": "Export format",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only measurements at or after this RFC3339 timestamp",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only measurements at or before this RFC3339 timestamp",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only measurements from this host",
+                        "name": "host",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "host",
+                            "self"
+                        ],
+                        "type": "string",
+                        "description": "host (default) for host measurements, self for those of this process",
+                        "name": "source",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma-separated CSV columns, e.g. timestamp,cpu or label.rack",
+                        "name": "fields",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Include soft-deleted measurements",
+                        "name": "include_deleted",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "MongoDB unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/measurements/forecast": {
+            "get": {
+                "description": "Fits a straight line through the CPU or RAM samples of the window ending now and projects it horizon past now, for rough capacity planning. This is a naive linear model: it ignores daily patterns, bounds such as 100%, and sudden changes, so treat the result as a trend indicator rather than a prediction.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Measurements"
+                ],
+                "summary": "Forecast a field",
+                "parameters": [
+                    {
+                        "enum": [
+                            "cpu",
+                            "ram"
+                        ],
+                        "type": "string",
+                        "description": "Field to project",
+                        "name": "field",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Length of the window to fit as a Go duration (default 24h)",
+                        "name": "window",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "How far past now to project as a Go duration (default 6h)",
+                        "name": "horizon",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only measurements from this host",
+                        "name": "host",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.Forecast"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "MongoDB unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/measurements/import/validate": {
+            "post": {
+                "description": "Checks a body as POST /measurements would, a JSON array of up to 1000 measurements or a single one, or a text/csv or application/x-ndjson body with up to 1000 rows, and reports the total, the number of valid measurements and the errors of each invalid one, without storing anything. Unique index conflicts and database errors can only show up on the actual import.",
+                "consumes": [
+                    "application/json",
+                    "text/csv",
+                    "application/x-ndjson"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Measurements"
+                ],
+                "summary": "Validate measurements before importing them",
+                "parameters": [
+                    {
+                        "description": "Measurements to validate",
+                        "name": "measurements",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/main.Measurement"
+                            }
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.ImportReport"
+                        }
+                    },
+                    "400": {
+                        "description": "Not a JSON measurement, or a JSON array, CSV or NDJSON body of 1 to 1000 measurements",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/measurements/latest": {
+            "get": {
+                "description": "Retrieves the most recent measurement. If MongoDB is unavailable the last cached measurement is returned with the X-Served-From-Cache header set. Accept: application/x-protobuf returns a Measurement message of proto/measurement.proto.",
+                "produces": [
+                    "application/json",
+                    "application/x-protobuf"
+                ],
+                "tags": [
+                    "Measurements"
+                ],
+                "summary": "Get the latest measurement",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.Measurement"
+                        }
+                    },
+                    "404": {
+                        "description": "No measurements",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "MongoDB unavailable and nothing cached",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/measurements/peaks": {
+            "get": {
+                "description": "Returns the measurements with the highest CPU or RAM usage in the time range, highest first, to find when and where usage peaked",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Measurements"
+                ],
+                "summary": "Peak measurements",
+                "parameters": [
+                    {
+                        "enum": [
+                            "cpu",
+                            "ram"
+                        ],
+                        "type": "string",
+                        "description": "Field to rank by",
+                        "name": "field",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of measurements (default 10, max 100)",
+                        "name": "top",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only measurements at or after this RFC3339 timestamp",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only measurements at or before this RFC3339 timestamp",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only measurements from this host",
+                        "name": "host",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/main.Measurement"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "MongoDB unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/measurements/rate": {
+            "get": {
+                "description": "Counts the measurements per interval of the time range, e.g. per minute, for a sparkline of the ingest rate that shows gaps in data collection. Requires MongoDB 5.0.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Measurements"
+                ],
+                "summary": "Ingest rate",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bucket length as a Go duration in whole seconds (default 1m)",
+                        "name": "interval",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Start of the range as an RFC3339 timestamp (default 1 hour before to)",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "End of the range as an RFC3339 timestamp (default now)",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only measurements from this host",
+                        "name": "host",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.IngestRate"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "MongoDB unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/measurements/recent-avg": {
+            "get": {
+                "description": "Returns the average CPU and RAM usage over the window ending now, e.g. for an \"average CPU in the last 5 minutes\" widget. The averages are null when there are no measurements in the window.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Measurements"
+                ],
+                "summary": "Average over a trailing window",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Length of the window as a Go duration (default 5m)",
+                        "name": "window",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only measurements from this host",
+                        "name": "host",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.RecentAverage"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "MongoDB unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/measurements/replay": {
+            "get": {
+                "description": "Reports the progress of the running replay, or the outcome of the last one",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Broker"
+                ],
+                "summary": "Get the replay status",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.ReplayStatus"
+                        }
+                    },
+                    "404": {
+                        "description": "No replay was started",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Re-publishes the stored measurements matching the usual filters to an MQTT topic in timestamp order, for testing downstream consumers. With a speed multiplier the original spacing is kept, scaled down by the multiplier; max publishes as fast as possible. The replay runs in the background; only one runs at a time.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Broker"
+                ],
+                "summary": "Start a replay",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Topic to publish to; must not match MQTT_TOPIC",
+                        "name": "topic",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Playback speed such as 1x or 10x, or max (default 1x)",
+                        "name": "speed",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only measurements at or after this RFC3339 timestamp",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only measurements at or before this RFC3339 timestamp",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only measurements from this host",
+                        "name": "host",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/main.ReplayStatus"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "A replay is already running",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Not connected to the MQTT broker",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Stops the running replay; the measurements published so far are not withdrawn",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Broker"
+                ],
+                "summary": "Cancel the replay",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.ReplayStatus"
+                        }
+                    },
+                    "404": {
+                        "description": "No replay is running",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/measurements/schema": {
+            "get": {
+                "description": "Lists the fields of a measurement with their types and units",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Measurements"
+                ],
+                "summary": "Get the measurement schema",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/main.FieldSchema"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/measurements/tail": {
+            "get": {
+                "description": "Streams measurements as server-sent events, like tail -f: first the latest n measurements, oldest first, then each measurement as it is stored, without a gap or a duplicate in between. Every event is named measurement and carries one measurement as JSON. A client too slow to keep up has its stream closed and should reconnect.",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "Measurements"
+                ],
+                "summary": "Tail measurements",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Number of latest measurements sent first (default 20, max 1000)",
+                        "name": "n",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only measurements from this host",
+                        "name": "host",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.Measurement"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "MongoDB unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/measurements/{id}": {
+            "get": {
+                "description": "Get a measurement record by ID. Accept: application/x-protobuf returns a Measurement message of proto/measurement.proto.",
+                "produces": [
+                    "application/json",
+                    "application/x-protobuf"
+                ],
+                "summary": "Get a measurement by ID",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Measurement ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Also return the measurement if it is soft-deleted",
+                        "name": "include_deleted",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Measurement object",
+                        "schema": {
+                            "$ref": "#/definitions/main.Measurement"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid ID",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Measurement not found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "MongoDB unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Update a measurement record by ID",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Update a measurement",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Measurement ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Measurement object to be updated",
+                        "name": "measurement",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.Measurement"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Measurement updated successfully",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "MongoDB unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Delete a measurement record by ID and return the deleted record. With SOFT_DELETE the record is only marked as deleted and can be restored.",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Delete a measurement",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Measurement ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Deleted measurement",
+                        "schema": {
+                            "$ref": "#/definitions/main.Measurement"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid ID",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Measurement not found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "MongoDB unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/measurements/{id}/history": {
+            "get": {
+                "description": "Lists the previous versions of a measurement, newest first. Versions are only kept while ENABLE_HISTORY is set.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Measurements"
+                ],
+                "summary": "Get the history of a measurement",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Measurement ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/main.MeasurementVersion"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid ID",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "MongoDB unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/measurements/{id}/restore": {
+            "post": {
+                "description": "Undoes the soft delete of a measurement, which makes it visible to queries again",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Measurements"
+                ],
+                "summary": "Restore a measurement",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Measurement ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.Measurement"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid ID",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "No soft-deleted measurement with this ID",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "MongoDB unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/metrics": {
+            "get": {
+                "description": "Returns the service's own metrics in the Prometheus text exposition format",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "Health"
+                ],
+                "summary": "Get metrics",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/rollups": {
+            "get": {
+                "description": "Returns the hourly averages per host and label set of the measurements compacted after ROLLUP_AGE, oldest first. Each carries the number of raw measurements it averages in Samples. Accept: application/x-protobuf returns a MeasurementList message of proto/measurement.proto.",
+                "produces": [
+                    "application/json",
+                    "application/x-protobuf"
+                ],
+                "tags": [
+                    "Measurements"
+                ],
+                "summary": "List rollups",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Only rollups of hours starting at or after this RFC3339 timestamp",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only rollups of hours starting at or before this RFC3339 timestamp",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only rollups of this host",
+                        "name": "host",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/main.Measurement"
+                            }
+                        },
+                        "headers": {
+                            "X-Data-Source": {
+                                "type": "string",
+                                "description": "Always rollups"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "MongoDB unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/topics": {
+            "get": {
+                "description": "Lists the topics measurements were received on since startup, with their message counts and when they were last seen. At most 1000 topics are kept; beyond that the least recently seen ones are dropped and counted in mqtt_topics_evicted_total on GET /metrics.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Broker"
+                ],
+                "summary": "List MQTT topics",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/main.TopicInfo"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/version": {
+            "get": {
+                "description": "Reports the version and commit of the running binary and whether the service is read-only",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Health"
+                ],
+                "summary": "Version",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.VersionInfo"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "main.APIError": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "string"
+                },
+                "details": {
+                    "description": "Details lists the invalid fields of a request body.",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.FieldError"
+                    }
+                },
+                "message": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.Availability": {
+            "type": "object",
+            "properties": {
+                "availability_percent": {
+                    "type": "number"
+                },
+                "downtime": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.DowntimeWindow"
+                    }
+                },
+                "from": {
+                    "type": "string"
+                },
+                "host": {
+                    "type": "string"
+                },
+                "interval": {
+                    "type": "string"
+                },
+                "samples": {
+                    "type": "integer"
+                },
+                "to": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.Baseline": {
+            "type": "object",
+            "properties": {
+                "cpu": {
+                    "type": "number"
+                },
+                "host": {
+                    "type": "string"
+                },
+                "ram": {
+                    "type": "number"
+                },
+                "updated_at": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.BatchFailure": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "$ref": "#/definitions/main.APIError"
+                },
+                "index": {
+                    "type": "integer"
+                }
+            }
+        },
+        "main.BatchResult": {
+            "type": "object",
+            "properties": {
+                "failed": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.BatchFailure"
+                    }
+                },
+                "inserted": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "main.BrokerStat": {
+            "type": "object",
+            "properties": {
+                "updated_at": {
+                    "type": "string"
+                },
+                "value": {}
+            }
+        },
+        "main.BulkUpdateResult": {
+            "type": "object",
+            "properties": {
+                "matched": {
+                    "type": "integer"
+                },
+                "modified": {
+                    "type": "integer"
+                }
+            }
+        },
+        "main.Correlation": {
+            "type": "object",
+            "properties": {
+                "coefficient": {
+                    "description": "Coefficient is between -1 and 1, or null when there are fewer than\ntwo samples or either usage did not vary.",
+                    "type": "number"
+                },
+                "samples": {
+                    "type": "integer"
+                }
+            }
+        },
+        "main.DeadLetter": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "payload": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "received_at": {
+                    "type": "string"
+                },
+                "retries": {
+                    "type": "integer"
+                },
+                "source": {
+                    "type": "string"
+                },
+                "topic": {
+                    "type": "string"
+                },
+                "user_properties": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "main.DowntimeWindow": {
+            "type": "object",
+            "properties": {
+                "duration": {
+                    "type": "string"
+                },
+                "end": {
+                    "type": "string"
+                },
+                "start": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.ErrorResponse": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "$ref": "#/definitions/main.APIError"
+                }
+            }
+        },
+        "main.FieldError": {
+            "type": "object",
+            "properties": {
+                "field": {
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.FieldSchema": {
+            "type": "object",
+            "properties": {
+                "name": {
+                    "description": "Name is the key of the field in API responses.",
+                    "type": "string"
+                },
+                "stored": {
+                    "description": "Stored is the key of the field in MongoDB and in query parameters.",
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string"
+                },
+                "unit": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.Forecast": {
+            "type": "object",
+            "properties": {
+                "at": {
+                    "type": "string"
+                },
+                "field": {
+                    "type": "string"
+                },
+                "from": {
+                    "type": "string"
+                },
+                "projected": {
+                    "type": "number"
+                },
+                "samples": {
+                    "type": "integer"
+                },
+                "slope_per_hour": {
+                    "description": "SlopePerHour is the fitted change of the field in percentage points\nper hour, and Projected the fitted value at At. Both are null when\nthe window holds fewer than two distinct timestamps.",
+                    "type": "number"
+                },
+                "to": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.Health": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "description": "Data is \"fresh\", or \"stale\" when the newest measurement is older\nthan HEALTH_MAX_DATA_AGE. It is empty while the check is disabled or\nMongoDB is unavailable.",
+                    "type": "string"
+                },
+                "last_message_age_seconds": {
+                    "description": "LastMessageAgeSeconds is the time since the last MQTT measurement,\nor null if none was received yet.",
+                    "type": "number"
+                },
+                "latest_measurement_age_seconds": {
+                    "description": "LatestMeasurementAgeSeconds is the age of the newest stored\nmeasurement, or null if it is unknown.",
+                    "type": "number"
+                },
+                "maintenance": {
+                    "description": "Maintenance is true while writes are rejected for maintenance. It\ndoes not degrade the status, since reads are still served.",
+                    "type": "boolean"
+                },
+                "mongo": {
+                    "type": "string"
+                },
+                "mqtt": {
+                    "type": "string"
+                },
+                "observer": {
+                    "description": "Observer is \"running\", or \"paused\" while the resource observer is\npaused. Like maintenance, a pause does not degrade the status.",
+                    "type": "string"
+                },
+                "read_only": {
+                    "description": "ReadOnly is true when READ_ONLY disables every write. MQTT and the\nobserver are then \"disabled\", which does not degrade the status.",
+                    "type": "boolean"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.HostDeviation": {
+            "type": "object",
+            "properties": {
+                "avg_cpu": {
+                    "type": "number"
+                },
+                "avg_ram": {
+                    "type": "number"
+                },
+                "baseline_cpu": {
+                    "type": "number"
+                },
+                "baseline_ram": {
+                    "type": "number"
+                },
+                "cpu_deviation": {
+                    "type": "number"
+                },
+                "host": {
+                    "type": "string"
+                },
+                "ram_deviation": {
+                    "type": "number"
+                },
+                "samples": {
+                    "type": "integer"
+                }
+            }
+        },
+        "main.HostInfo": {
+            "type": "object",
+            "properties": {
+                "host": {
+                    "type": "string"
+                },
+                "last_seen": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.HostLoad": {
+            "type": "object",
+            "properties": {
+                "avg_cpu": {
+                    "type": "number"
+                },
+                "avg_ram": {
+                    "type": "number"
+                },
+                "host": {
+                    "type": "string"
+                },
+                "last_seen": {
+                    "type": "string"
+                },
+                "latest_cpu": {
+                    "type": "number"
+                },
+                "latest_ram": {
                     "type": "number"
                 },
+                "samples": {
+                    "type": "integer"
+                }
+            }
+        },
+        "main.ImportReport": {
+            "type": "object",
+            "properties": {
+                "invalid": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.RowErrors"
+                    }
+                },
+                "total": {
+                    "type": "integer"
+                },
+                "valid": {
+                    "type": "integer"
+                }
+            }
+        },
+        "main.IndexKey": {
+            "type": "object",
+            "properties": {
+                "field": {
+                    "type": "string"
+                },
+                "order": {}
+            }
+        },
+        "main.IndexSpec": {
+            "type": "object",
+            "properties": {
+                "expire_after_seconds": {
+                    "type": "integer"
+                },
+                "keys": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.IndexKey"
+                    }
+                },
+                "name": {
+                    "type": "string"
+                },
+                "sparse": {
+                    "type": "boolean"
+                },
+                "unique": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "main.IngestRate": {
+            "type": "object",
+            "properties": {
+                "buckets": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.RateBucket"
+                    }
+                },
+                "from": {
+                    "type": "string"
+                },
+                "interval": {
+                    "type": "string"
+                },
+                "to": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.MaintenanceMode": {
+            "type": "object",
+            "properties": {
+                "enabled": {
+                    "type": "boolean"
+                },
+                "retry_after_seconds": {
+                    "description": "RetryAfterSeconds is sent as Retry-After with rejected writes.",
+                    "type": "integer"
+                },
+                "since": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.Measurement": {
+            "type": "object",
+            "properties": {
+                "DeletedAt": {
+                    "description": "DeletedAt is set on measurements deleted while SOFT_DELETE is on.",
+                    "type": "string"
+                },
+                "cpu": {
+                    "type": "number",
+                    "maximum": 100,
+                    "minimum": 0
+                },
+                "disks": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "number"
+                    }
+                },
+                "host": {
+                    "type": "string"
+                },
                 "id": {
                     "type": "string"
                 },
+                "labels": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "metrics": {
+                    "description": "Metrics holds additional numeric readings, e.g. from sensors, by name.",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "number"
+                    }
+                },
+                "netBytesRecv": {
+                    "type": "integer"
+                },
+                "netBytesRecvRate": {
+                    "type": "number",
+                    "minimum": 0
+                },
+                "netBytesSent": {
+                    "description": "The observer stores the cumulative network counters along with their\nrate since its previous sample.",
+                    "type": "integer"
+                },
+                "netBytesSentRate": {
+                    "type": "number",
+                    "minimum": 0
+                },
                 "ram": {
-                    "type": "number"
+                    "type": "number",
+                    "maximum": 100,
+                    "minimum": 0
+                },
+                "samples": {
+                    "description": "Samples is the number of raw measurements an hourly rollup averages;\nit is zero for raw measurements.",
+                    "type": "integer"
                 },
                 "timestamp": {
                     "type": "string"
                 }
             }
+        },
+        "main.MeasurementDiff": {
+            "type": "object",
+            "properties": {
+                "a": {
+                    "type": "string"
+                },
+                "b": {
+                    "type": "string"
+                },
+                "changed": {
+                    "description": "Changed lists the non-numeric fields that differ, Host or a label\nsuch as Labels.rack, with A's and B's value.",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        }
+                    }
+                },
+                "cpu": {
+                    "type": "number"
+                },
+                "disks": {
+                    "description": "Disks and Metrics hold the difference for every path or name either\nmeasurement has, null if only one of them has it.",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "number"
+                    }
+                },
+                "metrics": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "number"
+                    }
+                },
+                "net_bytes_recv": {
+                    "type": "integer"
+                },
+                "net_bytes_recv_rate": {
+                    "type": "number"
+                },
+                "net_bytes_sent": {
+                    "type": "integer"
+                },
+                "net_bytes_sent_rate": {
+                    "type": "number"
+                },
+                "ram": {
+                    "type": "number"
+                },
+                "time_gap_seconds": {
+                    "description": "TimeGapSeconds is B's timestamp minus A's.",
+                    "type": "number"
+                }
+            }
+        },
+        "main.MeasurementVersion": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "string"
+                },
+                "measurement": {
+                    "$ref": "#/definitions/main.Measurement"
+                },
+                "measurement_id": {
+                    "type": "string"
+                },
+                "replaced_at": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.ObserverState": {
+            "type": "object",
+            "properties": {
+                "paused": {
+                    "type": "boolean"
+                },
+                "since": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.PrometheusData": {
+            "type": "object",
+            "properties": {
+                "result": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.PrometheusSeries"
+                    }
+                },
+                "resultType": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.PrometheusResponse": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "$ref": "#/definitions/main.PrometheusData"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "errorType": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.PrometheusSeries": {
+            "type": "object",
+            "properties": {
+                "metric": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "values": {
+                    "type": "array",
+                    "items": {
+                        "type": "array",
+                        "items": {}
+                    }
+                }
+            }
+        },
+        "main.RateBucket": {
+            "type": "object",
+            "properties": {
+                "count": {
+                    "type": "integer"
+                },
+                "start": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.RecentAverage": {
+            "type": "object",
+            "properties": {
+                "avg_cpu": {
+                    "type": "number"
+                },
+                "avg_ram": {
+                    "type": "number"
+                },
+                "from": {
+                    "type": "string"
+                },
+                "samples": {
+                    "type": "integer"
+                },
+                "to": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.ReloadResult": {
+            "type": "object",
+            "properties": {
+                "applied": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "requires_restart": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "main.ReplayStatus": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "finished_at": {
+                    "type": "string"
+                },
+                "published": {
+                    "type": "integer"
+                },
+                "speed": {
+                    "type": "string"
+                },
+                "started_at": {
+                    "type": "string"
+                },
+                "state": {
+                    "type": "string"
+                },
+                "topic": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.RetentionPreview": {
+            "type": "object",
+            "properties": {
+                "count": {
+                    "type": "integer"
+                },
+                "cutoff": {
+                    "type": "string"
+                },
+                "enabled": {
+                    "description": "Enabled is false while ROLLUP_AGE is unset and no older_than was\ngiven; nothing is deleted then.",
+                    "type": "boolean"
+                },
+                "newest": {
+                    "type": "string"
+                },
+                "next_run": {
+                    "type": "string"
+                },
+                "older_than": {
+                    "type": "string"
+                },
+                "oldest": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.RowErrors": {
+            "type": "object",
+            "properties": {
+                "errors": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.FieldError"
+                    }
+                },
+                "row": {
+                    "type": "integer"
+                }
+            }
+        },
+        "main.SimpleJSONQuery": {
+            "type": "object",
+            "properties": {
+                "interval": {
+                    "type": "string"
+                },
+                "intervalMs": {
+                    "description": "IntervalMs is the resolution Grafana chose for the panel; Interval\nis the same as a duration, e.g. 30s.",
+                    "type": "integer"
+                },
+                "maxDataPoints": {
+                    "type": "integer"
+                },
+                "range": {
+                    "type": "object",
+                    "properties": {
+                        "from": {
+                            "type": "string"
+                        },
+                        "to": {
+                            "type": "string"
+                        }
+                    }
+                },
+                "targets": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.SimpleJSONTarget"
+                    }
+                }
+            }
+        },
+        "main.SimpleJSONSearch": {
+            "type": "object",
+            "properties": {
+                "target": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.SimpleJSONSeries": {
+            "type": "object",
+            "properties": {
+                "datapoints": {
+                    "type": "array",
+                    "items": {
+                        "type": "array",
+                        "items": {
+                            "type": "number"
+                        }
+                    }
+                },
+                "target": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.SimpleJSONTarget": {
+            "type": "object",
+            "properties": {
+                "refId": {
+                    "type": "string"
+                },
+                "target": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.StorageStats": {
+            "type": "object",
+            "properties": {
+                "avg_document_size_bytes": {
+                    "type": "integer"
+                },
+                "collection": {
+                    "type": "string"
+                },
+                "documents": {
+                    "type": "integer"
+                },
+                "index_sizes_bytes": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "integer"
+                    }
+                },
+                "size_bytes": {
+                    "type": "integer"
+                },
+                "storage_size_bytes": {
+                    "type": "integer"
+                },
+                "total_index_size_bytes": {
+                    "type": "integer"
+                }
+            }
+        },
+        "main.TopicInfo": {
+            "type": "object",
+            "properties": {
+                "last_seen": {
+                    "type": "string"
+                },
+                "messages": {
+                    "type": "integer"
+                },
+                "topic": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.VersionInfo": {
+            "type": "object",
+            "properties": {
+                "go_version": {
+                    "type": "string"
+                },
+                "read_only": {
+                    "description": "ReadOnly is true when READ_ONLY disables every write.",
+                    "type": "boolean"
+                },
+                "revision": {
+                    "description": "Revision is the VCS commit the binary was built from, if known.",
+                    "type": "string"
+                },
+                "version": {
+                    "type": "string"
+                }
+            }
+        }
+    },
+    "securityDefinitions": {
+        "ApiKeyAuth": {
+            "type": "apiKey",
+            "name": "X-API-Key",
+            "in": "header"
         }
     }
 }`
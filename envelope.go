@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The envelope fields copied into the unwrapped measurement when it does not
+// set them itself.
+const (
+	envelopeHostField      = "device"
+	envelopeTimestampField = "ts"
+)
+
+// unwrapEnvelope extracts the measurement at path, a dot-separated list of
+// object keys such as data or payload.reading, from a JSON payload. The
+// device and ts fields of the envelope are returned as the host and
+// timestamp to use when the measurement has none.
+func unwrapEnvelope(payload []byte, path string) ([]byte, string, time.Time, error) {
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &envelope); err != nil {
+		return nil, "", time.Time{}, fmt.Errorf("parsing envelope: %w", err)
+	}
+	var host string
+	if raw, ok := envelope[envelopeHostField]; ok {
+		if err := json.Unmarshal(raw, &host); err != nil {
+			return nil, "", time.Time{}, fmt.Errorf("invalid envelope %s: expected a string", envelopeHostField)
+		}
+	}
+	var ts epochTime
+	if raw, ok := envelope[envelopeTimestampField]; ok {
+		if err := json.Unmarshal(raw, &ts); err != nil {
+			return nil, "", time.Time{}, fmt.Errorf("invalid envelope %s: %w", envelopeTimestampField, err)
+		}
+	}
+
+	keys := strings.Split(path, ".")
+	current := envelope
+	for i, key := range keys {
+		raw, ok := current[key]
+		if !ok {
+			return nil, "", time.Time{}, fmt.Errorf("envelope has no %s", strings.Join(keys[:i+1], "."))
+		}
+		if i == len(keys)-1 {
+			return raw, host, time.Time(ts), nil
+		}
+		current = nil
+		if err := json.Unmarshal(raw, &current); err != nil || current == nil {
+			return nil, "", time.Time{}, fmt.Errorf("envelope %s is not an object", strings.Join(keys[:i+1], "."))
+		}
+	}
+	return nil, "", time.Time{}, nil
+}
+
+// validPayloadPath reports whether MQTT_PAYLOAD_PATH is empty or a
+// dot-separated list of non-empty keys.
+func validPayloadPath(path string) bool {
+	if path == "" {
+		return true
+	}
+	for _, key := range strings.Split(path, ".") {
+		if key == "" {
+			return false
+		}
+	}
+	return true
+}
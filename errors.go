@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Error codes are part of the API and must stay stable; messages may change.
+const (
+	codeInvalidID       = "invalid_id"
+	codeNotFound        = "not_found"
+	codeValidation      = "validation_failed"
+	codeDBUnavailable   = "db_unavailable"
+	codeMQTTUnavailable = "mqtt_unavailable"
+	codeOverloaded      = "overloaded"
+	codeMaintenance     = "maintenance"
+	codeUnauthorized    = "unauthorized"
+	codeForbidden       = "forbidden"
+	codeReadOnly        = "read_only"
+	codeConflict        = "conflict"
+	codeTimeout         = "timeout"
+	codeInternal        = "internal"
+)
+
+// APIError is an error reported to clients with a stable code, a readable
+// message and the HTTP status it is served with.
+type APIError struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+
+	// Details lists the invalid fields of a request body.
+	Details []FieldError `json:"details,omitempty"`
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// ErrorResponse is the body of every error response.
+type ErrorResponse struct {
+	Error *APIError `json:"error"`
+}
+
+var (
+	errInvalidID     = &APIError{http.StatusBadRequest, codeInvalidID, "Invalid ID", nil}
+	errNotFound      = &APIError{http.StatusNotFound, codeNotFound, "Measurement not found", nil}
+	errDBUnavailable = &APIError{http.StatusServiceUnavailable, codeDBUnavailable, "Failed to connect to MongoDB", nil}
+
+	errDuplicateMeasurement = &APIError{http.StatusConflict, codeConflict,
+		"A measurement with the same key already exists in a unique index", nil}
+)
+
+// duplicateMeasurement returns errDuplicateMeasurement for the duplicate key
+// error (code 11000) of a measurement insert rejected by a unique index,
+// such as one created with POST /admin/indexes, and err otherwise.
+func duplicateMeasurement(err error) error {
+	if mongo.IsDuplicateKeyError(err) {
+		return errDuplicateMeasurement
+	}
+	return err
+}
+
+// validationError reports invalid client input. Its message is shown to the
+// client, so err must not come from the database.
+func validationError(err error) *APIError {
+	return &APIError{http.StatusBadRequest, codeValidation, err.Error(), nil}
+}
+
+// internalError reports a failure on our side with a fixed message.
+func internalError(message string) *APIError {
+	return &APIError{http.StatusInternalServerError, codeInternal, message, nil}
+}
+
+// toAPIError maps err to the error reported to clients. Errors that are not
+// an APIError already are logged, with the ID ctx carries, and described
+// generically, so that driver messages do not leak.
+func toAPIError(ctx context.Context, err error) *APIError {
+	var apiErr *APIError
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return errNotFound
+	case isConflictError(err):
+		return &APIError{http.StatusConflict, codeConflict, "Conflicts with existing data", nil}
+	case isTransientMongoError(err):
+		logf(ctx, "MongoDB unavailable: %s\n", err)
+		return errDBUnavailable
+	}
+	logf(ctx, "Error handling request: %s\n", err)
+	return internalError("Internal server error")
+}
+
+// conflictCodes are the MongoDB error codes of writes that conflict with
+// existing data: IndexOptionsConflict, IndexKeySpecsConflict and
+// DuplicateKey.
+var conflictCodes = []int{85, 86, 11000}
+
+func isConflictError(err error) bool {
+	var serverErr mongo.ServerError
+	if !errors.As(err, &serverErr) {
+		return false
+	}
+	for _, code := range conflictCodes {
+		if serverErr.HasErrorCode(code) {
+			return true
+		}
+	}
+	return false
+}
+
+// respondError aborts the request with the error response for err. Any
+// error of a request that exceeded its configured timeout is reported as
+// that timeout, as it is usually a consequence of the cancellation.
+func respondError(c *gin.Context, err error) {
+	apiErr := toAPIError(c.Request.Context(), err)
+	if requestTimedOut(c) {
+		apiErr = errRequestTimeout
+	}
+	c.AbortWithStatusJSON(apiErr.Status, ErrorResponse{Error: apiErr})
+}
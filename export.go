@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xitongsys/parquet-go/writer"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// measurementRow mirrors Measurement in the Parquet export format.
+type measurementRow struct {
+	ID        string             `parquet:"name=id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Timestamp int64              `parquet:"name=timestamp, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	Host      string             `parquet:"name=host, type=BYTE_ARRAY, convertedtype=UTF8"`
+	CPU       float64            `parquet:"name=cpu, type=DOUBLE"`
+	RAM       float64            `parquet:"name=ram, type=DOUBLE"`
+	Disks     map[string]float64 `parquet:"name=disks, type=MAP, convertedtype=MAP, keytype=BYTE_ARRAY, keyconvertedtype=UTF8, valuetype=DOUBLE"`
+	Labels    map[string]string  `parquet:"name=labels, type=MAP, convertedtype=MAP, keytype=BYTE_ARRAY, keyconvertedtype=UTF8, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"`
+	Metrics   map[string]float64 `parquet:"name=metrics, type=MAP, convertedtype=MAP, keytype=BYTE_ARRAY, keyconvertedtype=UTF8, valuetype=DOUBLE"`
+
+	NetBytesSent     int64   `parquet:"name=net_bytes_sent, type=INT64"`
+	NetBytesRecv     int64   `parquet:"name=net_bytes_recv, type=INT64"`
+	NetBytesSentRate float64 `parquet:"name=net_bytes_sent_rate, type=DOUBLE"`
+	NetBytesRecvRate float64 `parquet:"name=net_bytes_recv_rate, type=DOUBLE"`
+}
+
+// newMeasurementRow converts m to a Parquet row, with its percentages
+// rounded as in JSON.
+func newMeasurementRow(m Measurement) measurementRow {
+	m = m.roundedPercents()
+	return measurementRow{
+		ID:        m.ID.Hex(),
+		Timestamp: m.Timestamp.UnixMilli(),
+		Host:      m.Host,
+		CPU:       m.CPU,
+		RAM:       m.RAM,
+		Disks:     m.Disks,
+		Labels:    m.Labels,
+		Metrics:   m.Metrics,
+
+		NetBytesSent:     int64(m.NetBytesSent),
+		NetBytesRecv:     int64(m.NetBytesRecv),
+		NetBytesSentRate: m.NetBytesSentRate,
+		NetBytesRecvRate: m.NetBytesRecvRate,
+	}
+}
+
+// @Summary Export measurements
+// @Description Streams the measurements matching the usual filters as CSV or Parquet
+// @Tags Measurements
+// @Produce text/csv
+// @Produce application/vnd.apache.parquet
+// @Param format query string false "Export format" Enums(csv, parquet) default(csv)
+// @Param from query string false "Only measurements at or after this RFC3339 timestamp"
+// @Param to query string false "Only measurements at or before this RFC3339 timestamp"
+// @Param host query string false "Only measurements from this host"
+// @Param source query string false "host (default) for host measurements, self for those of this process" Enums(host, self)
+// @Param fields query string false "Comma-separated CSV columns, e.g. timestamp,cpu or label.rack"
+// @Param include_deleted query bool false "Include soft-deleted measurements"
+// @Success 200 {file} file
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 503 {object} ErrorResponse "MongoDB unavailable"
+// @Router /measurements/export [get]
+func exportMeasurements(c *gin.Context) {
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "parquet" {
+		respondError(c, validationError(errors.New("invalid format: expected csv or parquet")))
+		return
+	}
+
+	if format != "csv" && c.Query("fields") != "" {
+		respondError(c, validationError(errors.New("fields only applies to the csv format")))
+		return
+	}
+	columns, err := parseCSVFields(c.Query("fields"))
+	if err != nil {
+		respondError(c, validationError(err))
+		return
+	}
+
+	filter, err := measurementFilter(c)
+	if err != nil {
+		respondError(c, validationError(err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Minute)
+	defer cancel()
+
+	collection, err := getMongoCollection()
+	if err != nil {
+		respondError(c, errDBUnavailable)
+		return
+	}
+
+	cur, err := collection.Find(ctx, filter)
+	if err != nil {
+		respondError(c, internalError("Failed to retrieve measurements"))
+		return
+	}
+	defer cur.Close(ctx)
+
+	// The status is committed once streaming starts, so failures from here
+	// on can only be logged.
+	if format == "parquet" {
+		c.Header("Content-Type", "application/vnd.apache.parquet")
+		c.Header("Content-Disposition", `attachment; filename="measurements.parquet"`)
+		err = writeParquet(ctx, c.Writer, cur)
+	} else {
+		c.Header("Content-Type", "text/csv")
+		c.Header("Content-Disposition", `attachment; filename="measurements.csv"`)
+		err = writeCSV(ctx, c.Writer, cur, columns)
+	}
+	if err != nil {
+		log.Printf("Error exporting measurements as %s: %s\n", format, err)
+	}
+}
+
+// csvColumn is a column of the CSV export.
+type csvColumn struct {
+	name  string
+	value func(Measurement) string
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// csvColumns are the fixed columns that can be selected with ?fields=.
+var csvColumns = map[string]func(Measurement) string{
+	"id":                  func(m Measurement) string { return m.ID.Hex() },
+	"timestamp":           func(m Measurement) string { return m.Timestamp.Format(time.RFC3339Nano) },
+	"host":                func(m Measurement) string { return m.Host },
+	"cpu":                 func(m Measurement) string { return formatFloat(m.CPU) },
+	"ram":                 func(m Measurement) string { return formatFloat(m.RAM) },
+	"net_bytes_sent":      func(m Measurement) string { return strconv.FormatUint(m.NetBytesSent, 10) },
+	"net_bytes_recv":      func(m Measurement) string { return strconv.FormatUint(m.NetBytesRecv, 10) },
+	"net_bytes_sent_rate": func(m Measurement) string { return formatFloat(m.NetBytesSentRate) },
+	"net_bytes_recv_rate": func(m Measurement) string { return formatFloat(m.NetBytesRecvRate) },
+}
+
+// defaultCSVFields are the columns exported when ?fields= is not given.
+var defaultCSVFields = []string{"id", "timestamp", "host", "cpu", "ram"}
+
+// parseCSVFields resolves a comma-separated column list. Besides the fixed
+// columns, label.<name>, metric.<name> and disk.<path> select a single
+// label, metric or disk; cells of measurements without it stay empty.
+func parseCSVFields(raw string) ([]csvColumn, error) {
+	names := defaultCSVFields
+	if raw != "" {
+		names = strings.Split(raw, ",")
+	}
+
+	columns := make([]csvColumn, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		column := csvColumn{name: name, value: csvColumns[name]}
+		if label, ok := strings.CutPrefix(name, labelParamPrefix); ok && label != "" {
+			column.value = func(m Measurement) string { return m.Labels[label] }
+		} else if metric, ok := strings.CutPrefix(name, metricParamPrefix); ok && metric != "" {
+			column.value = func(m Measurement) string {
+				if value, ok := m.Metrics[metric]; ok {
+					return formatFloat(value)
+				}
+				return ""
+			}
+		} else if disk, ok := strings.CutPrefix(name, "disk."); ok && disk != "" {
+			column.value = func(m Measurement) string {
+				if value, ok := m.Disks[disk]; ok {
+					return formatFloat(value)
+				}
+				return ""
+			}
+		}
+		if column.value == nil {
+			return nil, fmt.Errorf("invalid fields: unknown column %q", name)
+		}
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
+
+func writeCSV(ctx context.Context, w http.ResponseWriter, cur *mongo.Cursor, columns []csvColumn) error {
+	writer := csv.NewWriter(w)
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.name
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	record := make([]string, len(columns))
+	for cur.Next(ctx) {
+		var m Measurement
+		if err := cur.Decode(&m); err != nil {
+			return err
+		}
+		// Percentages are rounded as in JSON.
+		m = m.roundedPercents()
+		for i, column := range columns {
+			record[i] = column.value(m)
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	return cur.Err()
+}
+
+func writeParquet(ctx context.Context, w http.ResponseWriter, cur *mongo.Cursor) error {
+	pw, err := writer.NewParquetWriterFromWriter(w, new(measurementRow), 1)
+	if err != nil {
+		return err
+	}
+
+	for cur.Next(ctx) {
+		var m Measurement
+		if err := cur.Decode(&m); err != nil {
+			return err
+		}
+		if err := pw.Write(newMeasurementRow(m)); err != nil {
+			return err
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return err
+	}
+	return pw.WriteStop()
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// noisy carries the float noise of computed percentages.
+var noisy = Measurement{CPU: 12.340000000000002, RAM: 56.789, Disks: map[string]float64{"/": 0.1 + 0.2},
+	Metrics: map[string]float64{"temp": 21.456}}
+
+func TestExportCSVRounding(t *testing.T) {
+	testConfig(t)
+	m := noisy
+	m.Timestamp = time.Now()
+	if _, err := insertMeasurement(context.Background(), m); err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.GET("/measurements/export", exportMeasurements)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/measurements/export?fields=cpu,ram,disk./,metric.temp", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	// Metrics are not percentages and keep their precision.
+	if want := "cpu,ram,disk./,metric.temp\n12.34,56.79,0.3,21.456\n"; w.Body.String() != want {
+		t.Errorf("export = %q, want %q", w.Body, want)
+	}
+}
+
+func TestNewMeasurementRowRounding(t *testing.T) {
+	for _, tt := range []struct {
+		decimals int
+		cpu, ram float64
+		disks    map[string]float64
+	}{
+		{decimals: 2, cpu: 12.34, ram: 56.79, disks: map[string]float64{"/": 0.3}},
+		{decimals: -1, cpu: noisy.CPU, ram: noisy.RAM, disks: noisy.Disks},
+	} {
+		config := defaultConfig()
+		config.PercentDecimals = tt.decimals
+		useConfig(t, config)
+
+		row := newMeasurementRow(noisy)
+		if row.CPU != tt.cpu || row.RAM != tt.ram || !reflect.DeepEqual(row.Disks, tt.disks) || row.Metrics["temp"] != 21.456 {
+			t.Errorf("PERCENT_DECIMALS=%d: row = %+v, want CPU %v, RAM %v and disks %v", tt.decimals, row, tt.cpu, tt.ram, tt.disks)
+		}
+	}
+	if noisy.Disks["/"] != 0.1+0.2 {
+		t.Errorf("the disks of the measurement were rounded in place")
+	}
+}
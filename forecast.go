@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Forecast is a linear projection of a field past the end of a window.
+type Forecast struct {
+	Field   string    `json:"field"`
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	At      time.Time `json:"at"`
+	Samples int       `json:"samples"`
+
+	// SlopePerHour is the fitted change of the field in percentage points
+	// per hour, and Projected the fitted value at At. Both are null when
+	// the window holds fewer than two distinct timestamps.
+	SlopePerHour *float64 `json:"slope_per_hour"`
+	Projected    *float64 `json:"projected"`
+}
+
+// forecastFields are the fields /measurements/forecast can project.
+var forecastFields = map[string]bool{"cpu": true, "ram": true}
+
+// linearFit fits y = intercept + slope*x by ordinary least squares. ok is
+// false when x does not vary, which leaves the slope undefined.
+func linearFit(xs, ys []float64) (slope, intercept float64, ok bool) {
+	n := float64(len(xs))
+	if n < 2 {
+		return 0, 0, false
+	}
+	var sumX, sumY float64
+	for i := range xs {
+		sumX += xs[i]
+		sumY += ys[i]
+	}
+	meanX, meanY := sumX/n, sumY/n
+
+	var sxx, sxy float64
+	for i := range xs {
+		dx := xs[i] - meanX
+		sxx += dx * dx
+		sxy += dx * (ys[i] - meanY)
+	}
+	if sxx == 0 {
+		return 0, 0, false
+	}
+	slope = sxy / sxx
+	return slope, meanY - slope*meanX, true
+}
+
+// @Summary Forecast a field
+// @Description Fits a straight line through the CPU or RAM samples of the window ending now and projects it horizon past now, for rough capacity planning. This is a naive linear model: it ignores daily patterns, bounds such as 100%, and sudden changes, so treat the result as a trend indicator rather than a prediction.
+// @Tags Measurements
+// @Produce json
+// @Param field query string true "Field to project" Enums(cpu, ram)
+// @Param window query string false "Length of the window to fit as a Go duration (default 24h)"
+// @Param horizon query string false "How far past now to project as a Go duration (default 6h)"
+// @Param host query string false "Only measurements from this host"
+// @Success 200 {object} Forecast
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 503 {object} ErrorResponse "MongoDB unavailable"
+// @Router /measurements/forecast [get]
+func getForecast(c *gin.Context) {
+	field := c.Query("field")
+	if !forecastFields[field] {
+		respondError(c, validationError(errors.New("invalid field: expected cpu or ram")))
+		return
+	}
+	window, err := time.ParseDuration(c.DefaultQuery("window", "24h"))
+	if err != nil || window <= 0 {
+		respondError(c, validationError(errors.New("invalid window: expected a positive duration such as 24h")))
+		return
+	}
+	horizon, err := time.ParseDuration(c.DefaultQuery("horizon", "6h"))
+	if err != nil || horizon < 0 {
+		respondError(c, validationError(errors.New("invalid horizon: expected a duration such as 6h")))
+		return
+	}
+	to := time.Now()
+	from := to.Add(-window)
+	if err := checkQueryWindow(from, to); err != nil {
+		respondError(c, validationError(err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	collection, err := getMongoCollection()
+	if err != nil {
+		respondError(c, errDBUnavailable)
+		return
+	}
+
+	filter := rangeFilter(from, to)
+	if host := c.Query("host"); host != "" {
+		filter["host"] = host
+	}
+	findOptions := options.Find().SetProjection(bson.M{"timestamp": 1, field: 1})
+	cur, err := collection.Find(ctx, notDeleted(fromSource(filter, hostSource)), findOptions)
+	if err != nil {
+		respondError(c, internalError("Failed to query measurements"))
+		return
+	}
+	defer cur.Close(ctx)
+
+	// x is in hours since the start of the window, which keeps the slope in
+	// the unit reported and the sums well within float64 precision.
+	var xs, ys []float64
+	for cur.Next(ctx) {
+		var m Measurement
+		if err := cur.Decode(&m); err != nil {
+			respondError(c, internalError("Failed to decode measurement"))
+			return
+		}
+		value := m.CPU
+		if field == "ram" {
+			value = m.RAM
+		}
+		xs = append(xs, m.Timestamp.Sub(from).Hours())
+		ys = append(ys, value)
+	}
+	if err := cur.Err(); err != nil {
+		respondError(c, internalError("Failed to query measurements"))
+		return
+	}
+
+	at := to.Add(horizon)
+	result := Forecast{Field: field, From: from, To: to, At: at, Samples: len(xs)}
+	if slope, intercept, ok := linearFit(xs, ys); ok {
+		projected := intercept + slope*at.Sub(from).Hours()
+		result.SlopePerHour, result.Projected = roundPercentPtr(&slope), roundPercentPtr(&projected)
+	}
+
+	c.JSON(http.StatusOK, result)
+}
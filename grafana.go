@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SimpleJSONSearch is the body of a SimpleJSON /search request. Target is
+// what the user typed so far.
+type SimpleJSONSearch struct {
+	Target string `json:"target"`
+}
+
+// SimpleJSONQuery is the body of a SimpleJSON /query request.
+type SimpleJSONQuery struct {
+	Range struct {
+		From time.Time `json:"from"`
+		To   time.Time `json:"to"`
+	} `json:"range"`
+	// IntervalMs is the resolution Grafana chose for the panel; Interval
+	// is the same as a duration, e.g. 30s.
+	IntervalMs    int64              `json:"intervalMs"`
+	Interval      string             `json:"interval"`
+	MaxDataPoints int64              `json:"maxDataPoints"`
+	Targets       []SimpleJSONTarget `json:"targets"`
+}
+
+// SimpleJSONTarget is a query of a panel: cpu or ram with optional
+// label="value" matchers, as for /api/v1/query_range.
+type SimpleJSONTarget struct {
+	Target string `json:"target"`
+	RefID  string `json:"refId"`
+	Type   string `json:"type"`
+}
+
+// SimpleJSONSeries is a time series of a SimpleJSON response. Each
+// datapoint is a pair of the value and a Unix timestamp in milliseconds.
+type SimpleJSONSeries struct {
+	Target     string       `json:"target"`
+	Datapoints [][2]float64 `json:"datapoints"`
+}
+
+// @Summary SimpleJSON data source test
+// @Description Answers the connection test of Grafana's SimpleJSON data source pointed at /grafana
+// @Tags Interop
+// @Success 200
+// @Router /grafana/ [get]
+func simpleJSONHealth(c *gin.Context) {
+	c.Status(http.StatusOK)
+}
+
+// @Summary SimpleJSON metric search
+// @Description Lists the metrics a SimpleJSON panel can query, optionally those starting with target
+// @Tags Interop
+// @Accept json
+// @Produce json
+// @Param search body SimpleJSONSearch false "What the user typed so far"
+// @Success 200 {array} string
+// @Router /grafana/search [post]
+func simpleJSONSearch(c *gin.Context) {
+	var search SimpleJSONSearch
+	// Grafana may send an empty body.
+	_ = c.ShouldBindJSON(&search)
+	names := []string{}
+	for _, name := range []string{"cpu", "ram"} {
+		if strings.HasPrefix(name, search.Target) {
+			names = append(names, name)
+		}
+	}
+	c.JSON(http.StatusOK, names)
+}
+
+// @Summary SimpleJSON query
+// @Description Answers the queries of Grafana's SimpleJSON data source: each target is cpu or ram with optional label="value" matchers, e.g. cpu{host="web-1"}, and is averaged per host over each interval of the range. Only time series targets are supported.
+// @Tags Interop
+// @Accept json
+// @Produce json
+// @Param query body SimpleJSONQuery true "Range, interval and targets of the panel"
+// @Success 200 {array} SimpleJSONSeries
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 503 {object} ErrorResponse "MongoDB unavailable"
+// @Router /grafana/query [post]
+func simpleJSONQuery(c *gin.Context) {
+	var query SimpleJSONQuery
+	if err := c.ShouldBindJSON(&query); err != nil {
+		respondError(c, validationError(err))
+		return
+	}
+	start, end := query.Range.From, query.Range.To
+	step, err := simpleJSONStep(query)
+	if err == nil && (start.IsZero() || end.Before(start)) {
+		err = errors.New("invalid range: expected from before to")
+	}
+	if err == nil && end.Sub(start)/step >= maxPrometheusPoints {
+		err = fmt.Errorf("exceeded maximum resolution of %d points per series", maxPrometheusPoints)
+	}
+	if err == nil {
+		err = checkQueryWindow(start, end)
+	}
+	if err != nil {
+		respondError(c, validationError(err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	collection, err := getMongoCollection()
+	if err != nil {
+		respondError(c, errDBUnavailable)
+		return
+	}
+
+	result := []SimpleJSONSeries{}
+	for _, target := range query.Targets {
+		if target.Type != "" && target.Type != "timeserie" {
+			respondError(c, validationError(fmt.Errorf("unsupported target type %q: expected timeserie", target.Type)))
+			return
+		}
+		name, field, filter, err := parsePrometheusSelector(target.Target)
+		if err != nil {
+			respondError(c, validationError(err))
+			return
+		}
+		points, err := stepAverages(ctx, collection, field, filter, start, end, step)
+		if err != nil {
+			respondError(c, internalError(err.Error()))
+			return
+		}
+		for _, point := range points {
+			if len(result) == 0 || result[len(result)-1].Target != simpleJSONSeriesName(name, point.Host) {
+				result = append(result, SimpleJSONSeries{Target: simpleJSONSeriesName(name, point.Host)})
+			}
+			series := &result[len(result)-1]
+			series.Datapoints = append(series.Datapoints, [2]float64{roundPercent(point.Value), float64(point.At.UnixMilli())})
+		}
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// simpleJSONStep returns the resolution of a query: intervalMs, or else
+// interval, or else the range split into maxDataPoints steps.
+func simpleJSONStep(query SimpleJSONQuery) (time.Duration, error) {
+	step := time.Duration(query.IntervalMs) * time.Millisecond
+	if step <= 0 && query.Interval != "" {
+		var err error
+		if step, err = time.ParseDuration(query.Interval); err != nil {
+			return 0, errors.New("invalid interval: expected a duration such as 30s")
+		}
+	}
+	if step <= 0 && query.MaxDataPoints > 0 {
+		step = query.Range.To.Sub(query.Range.From) / time.Duration(query.MaxDataPoints)
+	}
+	// Buckets are computed in milliseconds.
+	if step < time.Millisecond {
+		return 0, errors.New("invalid interval: expected intervalMs, interval or maxDataPoints giving at least 1ms")
+	}
+	return step, nil
+}
+
+// simpleJSONSeriesName names the series of a host, e.g. cpu{host="web-1"},
+// which is also a target selecting just that series.
+func simpleJSONSeriesName(name, host string) string {
+	return fmt.Sprintf("%s{host=%q}", name, host)
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// responseHeaders sets the headers every response carries. Reads are sent
+// with Cache-Control: no-cache, since measurements keep arriving, so that
+// caches revalidate them; every other method gets no-store. With
+// SECURITY_HEADERS on, responses also tell browsers not to sniff content
+// types or render the API in a frame.
+func responseHeaders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.Writer.Header()
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			header.Set("Cache-Control", "no-cache")
+		} else {
+			header.Set("Cache-Control", "no-store")
+		}
+		if cfg().SecurityHeaders {
+			header.Set("X-Content-Type-Options", "nosniff")
+			header.Set("X-Frame-Options", "DENY")
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Health is the body of the /health response. Status is "ok" when every
+// dependency is usable and "degraded" otherwise.
+type Health struct {
+	Status string `json:"status"`
+	Mongo  string `json:"mongo"`
+	MQTT   string `json:"mqtt"`
+
+	// LastMessageAgeSeconds is the time since the last MQTT measurement,
+	// or null if none was received yet.
+	LastMessageAgeSeconds *float64 `json:"last_message_age_seconds"`
+
+	// Data is "fresh", or "stale" when the newest measurement is older
+	// than HEALTH_MAX_DATA_AGE. It is empty while the check is disabled or
+	// MongoDB is unavailable.
+	Data string `json:"data,omitempty"`
+	// LatestMeasurementAgeSeconds is the age of the newest stored
+	// measurement, or null if it is unknown.
+	LatestMeasurementAgeSeconds *float64 `json:"latest_measurement_age_seconds"`
+
+	// Maintenance is true while writes are rejected for maintenance. It
+	// does not degrade the status, since reads are still served.
+	Maintenance bool `json:"maintenance"`
+	// Observer is "running", or "paused" while the resource observer is
+	// paused. Like maintenance, a pause does not degrade the status.
+	Observer string `json:"observer"`
+	// ReadOnly is true when READ_ONLY disables every write. MQTT and the
+	// observer are then "disabled", which does not degrade the status.
+	ReadOnly bool `json:"read_only"`
+}
+
+// @Summary Health check
+// @Description Reports the state of MongoDB, the MQTT connection and, with HEALTH_MAX_DATA_AGE set, whether recent data is being stored. Responds 503 when degraded.
+// @Tags Health
+// @Produce json
+// @Success 200 {object} Health
+// @Failure 503 {object} Health
+// @Router /health [get]
+func getHealth(c *gin.Context) {
+	health := Health{Status: "ok", Mongo: "ok", MQTT: "connected", Maintenance: currentMaintenance().Enabled, Observer: "running"}
+	if currentObserverState().Paused {
+		health.Observer = "paused"
+	}
+	if cfg().ReadOnly {
+		health.ReadOnly = true
+		health.Observer = "disabled"
+	}
+
+	// getMongoCollection pings the server before returning.
+	collection, err := getMongoCollection()
+	if err != nil {
+		health.Status = "degraded"
+		health.Mongo = "unavailable"
+	} else {
+		checkDataAge(collection, &health)
+	}
+
+	switch client := currentMQTTClient(); {
+	case cfg().ReadOnly:
+		health.MQTT = "disabled"
+	case client == nil || !client.IsConnectionOpen():
+		health.Status = "degraded"
+		health.MQTT = "disconnected"
+	}
+	if age, ok := lastMQTTMessageAge(); ok {
+		seconds := age.Seconds()
+		health.LastMessageAgeSeconds = &seconds
+	}
+
+	status := http.StatusOK
+	if health.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, health)
+}
+
+// checkDataAge records the age of the newest measurement and marks health
+// degraded when it exceeds HEALTH_MAX_DATA_AGE, which catches an observer or
+// ingestion that stalled while the process keeps running. No measurement at
+// all counts as stale too.
+func checkDataAge(collection *mongo.Collection, health *Health) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	maxAge := cfg().HealthMaxDataAge
+	measurement, err := latestMeasurement(ctx, collection)
+	switch {
+	case err == nil:
+		seconds := time.Since(measurement.Timestamp).Seconds()
+		health.LatestMeasurementAgeSeconds = &seconds
+		if maxAge <= 0 {
+			return
+		}
+		if time.Since(measurement.Timestamp) <= maxAge {
+			health.Data = "fresh"
+			return
+		}
+	case err != mongo.ErrNoDocuments:
+		log.Println("Error checking the latest measurement:", err)
+		return
+	}
+	if maxAge > 0 {
+		health.Status = "degraded"
+		health.Data = "stale"
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MeasurementVersion is a previous version of a measurement, kept when
+// history is enabled.
+type MeasurementVersion struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	MeasurementID primitive.ObjectID `bson:"measurement_id" json:"measurement_id"`
+	ReplacedAt    time.Time          `bson:"replaced_at" json:"replaced_at"`
+	Measurement   Measurement        `bson:"measurement" json:"measurement"`
+}
+
+// historyCollection holds the previous versions of the measurements stored
+// in collection.
+func historyCollection(collection *mongo.Collection) *mongo.Collection {
+	return collection.Database().Collection(collection.Name() + "-history")
+}
+
+// replaceWithHistory replaces the measurement with the given ID and keeps the
+// version it replaced. The previous version is read and replaced atomically,
+// so the history records exactly what was overwritten. Once ctx is done,
+// e.g. when the request timed out, the replacement is abandoned.
+func replaceWithHistory(ctx context.Context, collection *mongo.Collection, id primitive.ObjectID, measurement Measurement) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var previous Measurement
+	err := collection.FindOneAndReplace(ctx, notDeleted(bson.M{"_id": id}), measurement).Decode(&previous)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = historyCollection(collection).InsertOne(ctx, MeasurementVersion{
+		MeasurementID: id,
+		ReplacedAt:    time.Now(),
+		Measurement:   previous,
+	})
+	return err
+}
+
+// @Summary Get the history of a measurement
+// @Description Lists the previous versions of a measurement, newest first. Versions are only kept while ENABLE_HISTORY is set.
+// @Tags Measurements
+// @Produce json
+// @Param id path string true "Measurement ID"
+// @Success 200 {array} MeasurementVersion
+// @Failure 400 {object} ErrorResponse "Invalid ID"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 503 {object} ErrorResponse "MongoDB unavailable"
+// @Router /measurements/{id}/history [get]
+func getMeasurementHistory(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		respondError(c, errInvalidID)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	collection, err := getMongoCollection()
+	if err != nil {
+		respondError(c, errDBUnavailable)
+		return
+	}
+
+	opts := options.Find().SetSort(bson.M{"replaced_at": -1})
+	cur, err := historyCollection(collection).Find(ctx, bson.M{"measurement_id": objectID}, opts)
+	if err != nil {
+		respondError(c, internalError("Failed to retrieve history"))
+		return
+	}
+	defer cur.Close(ctx)
+
+	versions := []MeasurementVersion{}
+	if err := cur.All(ctx, &versions); err != nil {
+		respondError(c, internalError("Failed to decode history"))
+		return
+	}
+
+	c.JSON(http.StatusOK, versions)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestReplaceWithHistory(t *testing.T) {
+	testConfig(t)
+	collection := testCollection(t)
+	history := historyCollection(collection)
+	t.Cleanup(func() { _ = history.Drop(context.Background()) })
+	stored, err := insertMeasurement(context.Background(), Measurement{Timestamp: time.Now(), CPU: 1, RAM: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A request that is gone, e.g. timed out, replaces nothing.
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	replacement := Measurement{Timestamp: stored.Timestamp, CPU: 3, RAM: 4}
+	if err := replaceWithHistory(cancelled, collection, stored.ID, replacement); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want %v", err, context.Canceled)
+	}
+	if err := replaceWithHistory(context.Background(), collection, stored.ID, replacement); err != nil {
+		t.Fatal(err)
+	}
+
+	var versions []MeasurementVersion
+	cur, err := history.Find(context.Background(), bson.M{"measurement_id": stored.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cur.All(context.Background(), &versions); err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 1 || versions[0].Measurement.CPU != 1 {
+		t.Errorf("versions = %+v, want only the one of CPU 1", versions)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// HostInfo describes a host that has reported measurements.
+type HostInfo struct {
+	Host     string    `bson:"_id" json:"host"`
+	LastSeen time.Time `bson:"last_seen" json:"last_seen"`
+}
+
+// @Summary List hosts
+// @Description Lists the distinct hosts that reported measurements, optionally restricted to a time range
+// @Tags Hosts
+// @Produce json
+// @Param from query string false "Only hosts active at or after this RFC3339 timestamp"
+// @Param to query string false "Only hosts active at or before this RFC3339 timestamp"
+// @Param latest query bool false "Include each host's latest measurement timestamp"
+// @Success 200 {array} HostInfo
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 503 {object} ErrorResponse "MongoDB unavailable"
+// @Router /hosts [get]
+func getHosts(c *gin.Context) {
+	filter, err := timeRangeFilter(c)
+	if err != nil {
+		respondError(c, validationError(err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	collection, err := getMongoCollection()
+	if err != nil {
+		respondError(c, errDBUnavailable)
+		return
+	}
+
+	if c.Query("latest") != "true" {
+		values, err := collection.Distinct(ctx, "host", notDeleted(fromSource(filter, hostSource)))
+		if err != nil {
+			respondError(c, internalError("Failed to retrieve hosts"))
+			return
+		}
+
+		hosts := make([]string, 0, len(values))
+		for _, value := range values {
+			if host, ok := value.(string); ok && host != "" {
+				hosts = append(hosts, host)
+			}
+		}
+		c.JSON(http.StatusOK, hosts)
+		return
+	}
+
+	filter["host"] = bson.M{"$exists": true, "$ne": ""}
+	pipeline := []bson.M{
+		{"$match": notDeleted(fromSource(filter, hostSource))},
+		{"$group": bson.M{"_id": "$host", "last_seen": bson.M{"$max": "$timestamp"}}},
+		{"$sort": bson.M{"_id": 1}},
+	}
+	cur, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		respondError(c, internalError("Failed to retrieve hosts"))
+		return
+	}
+	defer cur.Close(ctx)
+
+	hosts := []HostInfo{}
+	if err := cur.All(ctx, &hosts); err != nil {
+		respondError(c, internalError("Failed to decode hosts"))
+		return
+	}
+
+	c.JSON(http.StatusOK, hosts)
+}
+
+// HostLoad summarizes the load of one host over a time range.
+type HostLoad struct {
+	Host      string    `bson:"_id" json:"host"`
+	LastSeen  time.Time `bson:"last_seen" json:"last_seen"`
+	LatestCPU float64   `bson:"latest_cpu" json:"latest_cpu"`
+	LatestRAM float64   `bson:"latest_ram" json:"latest_ram"`
+	AvgCPU    float64   `bson:"avg_cpu" json:"avg_cpu"`
+	AvgRAM    float64   `bson:"avg_ram" json:"avg_ram"`
+	Samples   int       `bson:"samples" json:"samples"`
+}
+
+// hostLoadSorts maps the sort parameter of /measurements/by-host to the
+// order of the result. Load is sorted highest first.
+var hostLoadSorts = map[string]bson.D{
+	"host":    {{Key: "_id", Value: 1}},
+	"cpu":     {{Key: "latest_cpu", Value: -1}, {Key: "_id", Value: 1}},
+	"avg_cpu": {{Key: "avg_cpu", Value: -1}, {Key: "_id", Value: 1}},
+}
+
+// @Summary Load by host
+// @Description Returns, per host, the latest CPU and RAM usage and their averages over the time range, for a fleet overview
+// @Tags Hosts
+// @Produce json
+// @Param from query string false "Only measurements at or after this RFC3339 timestamp"
+// @Param to query string false "Only measurements at or before this RFC3339 timestamp"
+// @Param sort query string false "Order by host name (default), latest CPU or average CPU, highest first" Enums(host, cpu, avg_cpu)
+// @Success 200 {array} HostLoad
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 503 {object} ErrorResponse "MongoDB unavailable"
+// @Router /measurements/by-host [get]
+func getLoadByHost(c *gin.Context) {
+	sort, ok := hostLoadSorts[c.DefaultQuery("sort", "host")]
+	if !ok {
+		respondError(c, validationError(errors.New("invalid sort: expected host, cpu or avg_cpu")))
+		return
+	}
+
+	from, to, err := parseTimeRange(c)
+	if err == nil {
+		err = checkQueryWindow(from, to)
+	}
+	if err != nil {
+		respondError(c, validationError(err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	collection, err := getMongoCollection()
+	if err != nil {
+		respondError(c, errDBUnavailable)
+		return
+	}
+
+	filter := rangeFilter(from, to)
+	filter["host"] = bson.M{"$exists": true, "$ne": ""}
+	// $last relies on the documents reaching $group in timestamp order.
+	pipeline := []bson.M{
+		{"$match": notDeleted(fromSource(filter, hostSource))},
+		{"$sort": bson.M{"timestamp": 1}},
+		{"$group": bson.M{
+			"_id":        "$host",
+			"last_seen":  bson.M{"$last": "$timestamp"},
+			"latest_cpu": bson.M{"$last": "$cpu"},
+			"latest_ram": bson.M{"$last": "$ram"},
+			"avg_cpu":    bson.M{"$avg": "$cpu"},
+			"avg_ram":    bson.M{"$avg": "$ram"},
+			"samples":    bson.M{"$sum": 1},
+		}},
+		{"$sort": sort},
+	}
+	cur, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		respondError(c, internalError("Failed to retrieve host load"))
+		return
+	}
+	defer cur.Close(ctx)
+
+	loads := []HostLoad{}
+	if err := cur.All(ctx, &loads); err != nil {
+		respondError(c, internalError("Failed to decode host load"))
+		return
+	}
+	for i := range loads {
+		load := &loads[i]
+		load.LatestCPU, load.LatestRAM = roundPercent(load.LatestCPU), roundPercent(load.LatestRAM)
+		load.AvgCPU, load.AvgRAM = roundPercent(load.AvgCPU), roundPercent(load.AvgRAM)
+	}
+
+	c.JSON(http.StatusOK, loads)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	// idempotentReplayHeader marks a response repeated for a known key.
+	idempotentReplayHeader = "Idempotent-Replayed"
+
+	// pendingIdempotencyTTL bounds how long a key stays claimed by a
+	// request that never completed, e.g. because the process stopped.
+	pendingIdempotencyTTL = 5 * time.Minute
+	// maxIdempotentBody is the largest response kept for a key, enough for
+	// the result of a full batch.
+	maxIdempotentBody = 1 << 20
+)
+
+var (
+	errIdempotencyInProgress = &APIError{http.StatusConflict, codeConflict,
+		"A request with this Idempotency-Key is still in progress", nil}
+	errIdempotencyMismatch = &APIError{http.StatusConflict, codeConflict,
+		"The Idempotency-Key was already used with a different body", nil}
+)
+
+// idempotencyRecord is the stored outcome of a request with an
+// Idempotency-Key. Status is zero while the request is in progress.
+type idempotencyRecord struct {
+	Key         string    `bson:"_id"`
+	RequestHash string    `bson:"request_hash"`
+	Status      int       `bson:"status,omitempty"`
+	ContentType string    `bson:"content_type,omitempty"`
+	Body        []byte    `bson:"body,omitempty"`
+	ExpiresAt   time.Time `bson:"expires_at"`
+}
+
+func idempotencyCollection(collection *mongo.Collection) *mongo.Collection {
+	return collection.Database().Collection(collection.Name() + "-idempotency")
+}
+
+// idempotencyIndexed is set once the creation of the TTL index of the
+// idempotency collection was attempted.
+var idempotencyIndexed atomic.Bool
+
+// ensureIdempotencyIndex lets MongoDB remove records once they expire. It
+// is attempted once per process; without the index, keys keep working but
+// are never removed.
+func ensureIdempotencyIndex(ctx context.Context, keys *mongo.Collection) {
+	if !idempotencyIndexed.CompareAndSwap(false, true) {
+		return
+	}
+	_, err := keys.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		logf(ctx, "Error creating the TTL index of %s: %v\n", keys.Name(), err)
+	}
+}
+
+// idempotent makes a request carrying an Idempotency-Key take effect once:
+// the first successful response is stored for IDEMPOTENCY_KEY_TTL, and a
+// repeat with the same key and body gets that response again instead of
+// being handled. Failed requests are not stored, so they can be retried.
+// Without the header, or with a zero TTL, requests pass through.
+func idempotent() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(idempotencyKeyHeader)
+		ttl := cfg().IdempotencyKeyTTL
+		if key == "" || ttl <= 0 {
+			c.Next()
+			return
+		}
+		if !validRequestID(key) {
+			respondError(c, validationError(errors.New("invalid Idempotency-Key: expected up to 128 printable ASCII characters")))
+			return
+		}
+		body, err := c.GetRawData()
+		if err != nil {
+			respondError(c, validationError(err))
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(body)
+		hash := hex.EncodeToString(sum[:])
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+
+		collection, err := getMongoCollection()
+		if err != nil {
+			respondError(c, errDBUnavailable)
+			return
+		}
+		keys := idempotencyCollection(collection)
+		ensureIdempotencyIndex(ctx, keys)
+
+		// Claiming the key first keeps concurrent repeats from both being
+		// handled.
+		claim := idempotencyRecord{Key: key, RequestHash: hash, ExpiresAt: time.Now().Add(pendingIdempotencyTTL)}
+		if _, err := keys.InsertOne(ctx, claim); mongo.IsDuplicateKeyError(err) {
+			var record idempotencyRecord
+			if err := keys.FindOne(ctx, bson.M{"_id": key}).Decode(&record); err != nil {
+				respondError(c, err)
+				return
+			}
+			switch {
+			case record.RequestHash != hash:
+				respondError(c, errIdempotencyMismatch)
+			case record.Status == 0:
+				respondError(c, errIdempotencyInProgress)
+			default:
+				c.Header(idempotentReplayHeader, "true")
+				c.Data(record.Status, record.ContentType, record.Body)
+				c.Abort()
+			}
+			return
+		} else if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		recorder := &bodyRecorder{ResponseWriter: c.Writer, limit: maxIdempotentBody}
+		c.Writer = recorder
+		c.Next()
+
+		// The request may have run out of time, but its outcome must still
+		// be recorded.
+		ctx, cancel = context.WithTimeout(detachLogID(c.Request.Context()), 10*time.Second)
+		defer cancel()
+		status := recorder.Status()
+		if status < 200 || status > 299 {
+			if _, err := keys.DeleteOne(ctx, bson.M{"_id": key}); err != nil {
+				logf(ctx, "Error releasing idempotency key %q: %v\n", key, err)
+			}
+			return
+		}
+		_, err = keys.UpdateOne(ctx, bson.M{"_id": key}, bson.M{"$set": bson.M{
+			"status":       status,
+			"content_type": recorder.Header().Get("Content-Type"),
+			"body":         recorder.body.Bytes(),
+			"expires_at":   time.Now().Add(ttl),
+		}})
+		if err != nil {
+			logf(ctx, "Error storing the response for idempotency key %q: %v\n", key, err)
+		}
+	}
+}
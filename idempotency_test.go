@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestIdempotent(t *testing.T) {
+	testConfig(t)
+	keys := idempotencyCollection(testCollection(t))
+	t.Cleanup(func() { _ = keys.Drop(context.Background()) })
+	// A request that claimed its key but did not finish yet.
+	pending := idempotencyRecord{Key: "pending", RequestHash: "unknown", ExpiresAt: time.Now().Add(time.Minute)}
+	if _, err := keys.InsertOne(context.Background(), pending); err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.POST("/measurements", idempotent(), createMeasurement)
+
+	const (
+		body      = `{"CPU": 1, "RAM": 2}`
+		otherBody = `{"CPU": 3, "RAM": 4}`
+		batch     = `[{"CPU": 1, "RAM": 2}, {"CPU": 3, "RAM": 4}]`
+	)
+	// Each step runs on the state the previous ones left.
+	steps := []struct {
+		name         string
+		key          string
+		body         string
+		zeroTTL      bool
+		wantStatus   int
+		wantReplayed bool
+		// wantStored is the number of stored measurements after the step.
+		wantStored int64
+	}{
+		{name: "first", key: "a", body: body, wantStatus: http.StatusCreated, wantStored: 1},
+		{name: "replay", key: "a", body: body, wantStatus: http.StatusCreated, wantReplayed: true, wantStored: 1},
+		{name: "replay again", key: "a", body: body, wantStatus: http.StatusCreated, wantReplayed: true, wantStored: 1},
+		{name: "other body", key: "a", body: otherBody, wantStatus: http.StatusConflict, wantStored: 1},
+		{name: "in progress", key: "pending", body: body, wantStatus: http.StatusConflict, wantStored: 1},
+		{name: "failed", key: "b", body: `{"CPU": 200, "RAM": 2}`, wantStatus: http.StatusBadRequest, wantStored: 1},
+		{name: "retry after failure", key: "b", body: body, wantStatus: http.StatusCreated, wantStored: 2},
+		{name: "batch", key: "c", body: batch, wantStatus: http.StatusCreated, wantStored: 4},
+		{name: "batch replay", key: "c", body: batch, wantStatus: http.StatusCreated, wantReplayed: true, wantStored: 4},
+		{name: "without key", body: body, wantStatus: http.StatusCreated, wantStored: 5},
+		{name: "without key again", body: body, wantStatus: http.StatusCreated, wantStored: 6},
+		{name: "invalid key", key: strings.Repeat("k", 129), body: body, wantStatus: http.StatusBadRequest, wantStored: 6},
+		{name: "zero ttl ignores the key", key: "a", body: body, zeroTTL: true, wantStatus: http.StatusCreated, wantStored: 7},
+	}
+	first := ""
+	for _, step := range steps {
+		config := *cfg()
+		config.IdempotencyKeyTTL = time.Hour
+		if step.zeroTTL {
+			config.IdempotencyKeyTTL = 0
+		}
+		useConfig(t, config)
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/measurements", strings.NewReader(step.body))
+		req.Header.Set("Content-Type", "application/json")
+		if step.key != "" {
+			req.Header.Set(idempotencyKeyHeader, step.key)
+		}
+		router.ServeHTTP(w, req)
+
+		if w.Code != step.wantStatus {
+			t.Fatalf("%s: status = %d, want %d: %s", step.name, w.Code, step.wantStatus, w.Body)
+		}
+		if replayed := w.Header().Get(idempotentReplayHeader) == "true"; replayed != step.wantReplayed {
+			t.Errorf("%s: replayed = %v, want %v", step.name, replayed, step.wantReplayed)
+		}
+		if step.key == "c" {
+			// The replay repeats the inserted IDs of the original batch.
+			if first == "" {
+				first = w.Body.String()
+			} else if w.Body.String() != first {
+				t.Errorf("%s: body = %s, want the original %s", step.name, w.Body, first)
+			}
+		}
+		n, err := testCollection(t).CountDocuments(context.Background(), bson.M{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != step.wantStored {
+			t.Errorf("%s: %d measurements stored, want %d", step.name, n, step.wantStored)
+		}
+	}
+}
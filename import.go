@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ImportReport is the result of validating measurements before importing
+// them. Valid counts the measurements that passed; Invalid lists the others
+// by position, with every invalid field.
+type ImportReport struct {
+	Total   int         `json:"total"`
+	Valid   int         `json:"valid"`
+	Invalid []RowErrors `json:"invalid"`
+}
+
+// @Summary Validate measurements before importing them
+// @Description Checks a body as POST /measurements would, a JSON array of up to 1000 measurements or a single one, or a text/csv or application/x-ndjson body with up to 1000 rows, and reports the total, the number of valid measurements and the errors of each invalid one, without storing anything. Unique index conflicts and database errors can only show up on the actual import.
+// @Tags Measurements
+// @Accept json
+// @Accept text/csv
+// @Accept application/x-ndjson
+// @Produce json
+// @Param measurements body []Measurement true "Measurements to validate"
+// @Success 200 {object} ImportReport
+// @Failure 400 {object} ErrorResponse "Not a JSON measurement, or a JSON array, CSV or NDJSON body of 1 to 1000 measurements"
+// @Router /measurements/import/validate [post]
+func validateImport(c *gin.Context) {
+	body, err := c.GetRawData()
+	if err != nil {
+		respondError(c, validationError(err))
+		return
+	}
+	contentType := c.ContentType()
+	if !isImportFormat(contentType) && !isJSONArray(body) {
+		// A single measurement is a batch of one; it is decoded the same
+		// way as the rows of a batch.
+		body = append(append([]byte("["), body...), ']')
+	}
+	batch, invalid, err := parseImport(contentType, body)
+	if err != nil {
+		respondError(c, validationError(err))
+		return
+	}
+	if invalid == nil {
+		invalid = []RowErrors{}
+	}
+	c.JSON(http.StatusOK, ImportReport{Total: len(batch), Valid: len(batch) - len(invalid), Invalid: invalid})
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// IndexKey is one field of an index. Order is 1 or -1 for ascending or
+// descending, or an index type such as "hashed".
+type IndexKey struct {
+	Field string      `json:"field"`
+	Order interface{} `json:"order"`
+}
+
+// IndexSpec describes an index of the measurement collection.
+type IndexSpec struct {
+	Name               string     `json:"name"`
+	Keys               []IndexKey `json:"keys"`
+	Unique             bool       `json:"unique,omitempty"`
+	Sparse             bool       `json:"sparse,omitempty"`
+	ExpireAfterSeconds *int32     `json:"expire_after_seconds,omitempty"`
+}
+
+// indexTypes are the index types accepted as a key order besides 1 and -1.
+var indexTypes = map[string]bool{"hashed": true, "text": true, "2dsphere": true}
+
+// validate checks the spec and normalizes numeric orders to int32.
+func (s *IndexSpec) validate() error {
+	if s.Name == "" {
+		return errors.New("name is required")
+	}
+	if len(s.Keys) == 0 {
+		return errors.New("keys must list at least one field")
+	}
+	for i, key := range s.Keys {
+		if !isIndexableField(key.Field) {
+			return fmt.Errorf("keys[%d]: unknown field %q", i, key.Field)
+		}
+		switch order := key.Order.(type) {
+		case float64:
+			if order != 1 && order != -1 {
+				return fmt.Errorf("keys[%d]: order must be 1, -1 or an index type", i)
+			}
+			s.Keys[i].Order = int32(order)
+		case string:
+			if !indexTypes[order] {
+				return fmt.Errorf("keys[%d]: unknown index type %q", i, order)
+			}
+		default:
+			return fmt.Errorf("keys[%d]: order must be 1, -1 or an index type", i)
+		}
+	}
+	if s.ExpireAfterSeconds != nil && *s.ExpireAfterSeconds < 0 {
+		return errors.New("expire_after_seconds must not be negative")
+	}
+	return nil
+}
+
+// isIndexableField reports whether field is a stored measurement field or
+// a key of one of its maps, e.g. labels.rack.
+func isIndexableField(field string) bool {
+	top, sub, nested := strings.Cut(field, ".")
+	if nested && (sub == "" || strings.HasPrefix(sub, "$")) {
+		return false
+	}
+	for _, f := range measurementSchema {
+		if f.Stored == top && (!nested || f.Type == "object") {
+			return true
+		}
+	}
+	return false
+}
+
+// indexDocument is an index as listed by MongoDB.
+type indexDocument struct {
+	Name               string `bson:"name"`
+	Key                bson.D `bson:"key"`
+	Unique             bool   `bson:"unique"`
+	Sparse             bool   `bson:"sparse"`
+	ExpireAfterSeconds *int32 `bson:"expireAfterSeconds"`
+}
+
+func (d indexDocument) spec() IndexSpec {
+	spec := IndexSpec{
+		Name:               d.Name,
+		Unique:             d.Unique,
+		Sparse:             d.Sparse,
+		ExpireAfterSeconds: d.ExpireAfterSeconds,
+	}
+	for _, key := range d.Key {
+		spec.Keys = append(spec.Keys, IndexKey{Field: key.Key, Order: key.Value})
+	}
+	return spec
+}
+
+// @Summary List indexes
+// @Description Lists the indexes of the measurement collection
+// @Tags Admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {array} IndexSpec
+// @Failure 401 {object} ErrorResponse "Invalid API key"
+// @Failure 403 {object} ErrorResponse "Admin API disabled"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 503 {object} ErrorResponse "MongoDB unavailable"
+// @Router /admin/indexes [get]
+func listIndexes(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	collection, err := getMongoCollection()
+	if err != nil {
+		respondError(c, errDBUnavailable)
+		return
+	}
+
+	cur, err := collection.Indexes().List(ctx)
+	if err != nil {
+		respondError(c, internalError("Failed to list indexes"))
+		return
+	}
+	defer cur.Close(ctx)
+
+	var docs []indexDocument
+	if err := cur.All(ctx, &docs); err != nil {
+		respondError(c, internalError("Failed to decode indexes"))
+		return
+	}
+	specs := make([]IndexSpec, 0, len(docs))
+	for _, doc := range docs {
+		specs = append(specs, doc.spec())
+	}
+
+	c.JSON(http.StatusOK, specs)
+}
+
+// @Summary Create an index
+// @Description Creates a named index on the measurement collection. Keys are indexed in the given order.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param index body IndexSpec true "Index to create"
+// @Success 201 {object} IndexSpec
+// @Failure 400 {object} ErrorResponse "Invalid index"
+// @Failure 401 {object} ErrorResponse "Invalid API key"
+// @Failure 403 {object} ErrorResponse "Admin API disabled"
+// @Failure 409 {object} ErrorResponse "Conflicting index"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 503 {object} ErrorResponse "MongoDB unavailable"
+// @Router /admin/indexes [post]
+func createIndex(c *gin.Context) {
+	var spec IndexSpec
+	if err := c.ShouldBindJSON(&spec); err != nil {
+		respondError(c, validationError(err))
+		return
+	}
+	if err := spec.validate(); err != nil {
+		respondError(c, validationError(err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Minute)
+	defer cancel()
+
+	collection, err := getMongoCollection()
+	if err != nil {
+		respondError(c, errDBUnavailable)
+		return
+	}
+
+	keys := bson.D{}
+	for _, key := range spec.Keys {
+		keys = append(keys, bson.E{Key: key.Field, Value: key.Order})
+	}
+	opts := options.Index().SetName(spec.Name).SetUnique(spec.Unique).SetSparse(spec.Sparse)
+	if spec.ExpireAfterSeconds != nil {
+		opts.SetExpireAfterSeconds(*spec.ExpireAfterSeconds)
+	}
+	_, err = collection.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: keys, Options: opts})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, spec)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// measurementFromForm builds a measurement from query parameters and
+// form-encoded body fields, see measurementFromValues.
+func measurementFromForm(c *gin.Context) (Measurement, error) {
+	if err := c.Request.ParseForm(); err != nil {
+		return Measurement{}, fmt.Errorf("invalid form: %w", err)
+	}
+	return measurementFromValues(c.Request.Form)
+}
+
+// measurementFromValues builds a measurement from the fields cpu and ram
+// (required), host, timestamp (RFC3339, defaults to now), label.<name> and
+// metric.<name>. Other fields are ignored. The fields of a CSV import row
+// are decoded this way too.
+func measurementFromValues(form url.Values) (Measurement, error) {
+	measurement := Measurement{Timestamp: time.Now(), Host: form.Get("host")}
+	for _, field := range []struct {
+		name  string
+		value *float64
+	}{
+		{"cpu", &measurement.CPU},
+		{"ram", &measurement.RAM},
+	} {
+		raw := form.Get(field.name)
+		if raw == "" {
+			return measurement, fmt.Errorf("missing %s", field.name)
+		}
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return measurement, fmt.Errorf("invalid %s: expected a number", field.name)
+		}
+		*field.value = value
+	}
+
+	if raw := form.Get("timestamp"); raw != "" {
+		ts, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return measurement, fmt.Errorf("invalid timestamp: expected RFC3339 timestamp")
+		}
+		measurement.Timestamp = ts
+	}
+
+	for key := range form {
+		if name := strings.TrimPrefix(key, labelParamPrefix); name != key && name != "" {
+			if measurement.Labels == nil {
+				measurement.Labels = map[string]string{}
+			}
+			measurement.Labels[name] = form.Get(key)
+		}
+		if name := strings.TrimPrefix(key, metricParamPrefix); name != key {
+			if !isValidMetricName(name) {
+				return measurement, fmt.Errorf("invalid metric name %q", name)
+			}
+			value, err := strconv.ParseFloat(form.Get(key), 64)
+			if err != nil {
+				return measurement, fmt.Errorf("invalid %s: expected a number", key)
+			}
+			if measurement.Metrics == nil {
+				measurement.Metrics = map[string]float64{}
+			}
+			measurement.Metrics[name] = value
+		}
+	}
+	return measurement, nil
+}
+
+// @Summary Ingest a measurement from parameters
+// @Description Creates a measurement from query parameters or a form-encoded body, for devices that cannot send JSON. Labels are given as label.<name>=<value> and additional metrics as metric.<name>=<number>.
+// @Tags Measurements
+// @Accept x-www-form-urlencoded
+// @Param cpu query number true "CPU usage in percent"
+// @Param ram query number true "RAM usage in percent"
+// @Param host query string false "Host name"
+// @Param timestamp query string false "RFC3339 timestamp, defaults to now"
+// @Success 201 {string} string "Measurement created successfully"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 503 {object} ErrorResponse "MongoDB unavailable"
+// @Router /ingest [post]
+// @Router /ingest [get]
+func ingestMeasurement(c *gin.Context) {
+	measurement, err := measurementFromForm(c)
+	if err != nil {
+		respondError(c, validationError(err))
+		return
+	}
+
+	if _, err := insertMeasurement(c.Request.Context(), measurement); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Status(http.StatusCreated)
+}
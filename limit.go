@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/sync/semaphore"
+)
+
+// mongoInFlight counts the requests currently holding a MongoDB slot.
+var mongoInFlight atomic.Int64
+
+func init() {
+	newGauge("mongo_requests_in_flight", "Number of requests currently running MongoDB operations.",
+		func() float64 { return float64(mongoInFlight.Load()) })
+}
+
+// limitMongoOps bounds the requests running MongoDB operations at once to
+// MONGO_MAX_CONCURRENT. Requests beyond the limit are rejected with 503
+// right away instead of queueing, so a burst cannot exhaust the connection
+// pool. Zero disables the limit.
+func limitMongoOps(limit int) gin.HandlerFunc {
+	var sem *semaphore.Weighted
+	if limit > 0 {
+		sem = semaphore.NewWeighted(int64(limit))
+	}
+	return func(c *gin.Context) {
+		if sem != nil {
+			if !sem.TryAcquire(1) {
+				respondError(c, &APIError{http.StatusServiceUnavailable, codeOverloaded,
+					"Too many concurrent database requests, retry later", nil})
+				return
+			}
+			defer sem.Release(1)
+		}
+		mongoInFlight.Add(1)
+		defer mongoInFlight.Add(-1)
+		c.Next()
+	}
+}
@@ -1,17 +1,25 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
+	"math/rand"
 	"net/http"
+	"os"
 	"sync"
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/shirou/gopsutil/cpu"
 	"github.com/shirou/gopsutil/mem"
 	swaggerFiles "github.com/swaggo/files"
@@ -20,19 +28,45 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
 	"monitoring.com/monitoring-app/docs"
 )
 
+// Measurement is a single resource usage sample. The unit tag documents the
+// unit of numeric fields and is reported by GET /measurements/schema.
 type Measurement struct {
 	ID        primitive.ObjectID `bson:"_id,omitempty"`
 	Timestamp time.Time          `bson:"timestamp"`
-	CPU       float64            `bson:"cpu"`
-	RAM       float64            `bson:"ram"`
+	Host      string             `bson:"host,omitempty"`
+	CPU       float64            `bson:"cpu" unit:"percent" binding:"gte=0,lte=100"`
+	RAM       float64            `bson:"ram" unit:"percent" binding:"gte=0,lte=100"`
+	Disks     map[string]float64 `bson:"disks,omitempty" unit:"percent" binding:"dive,gte=0,lte=100"`
+	Labels    map[string]string  `bson:"labels,omitempty"`
+
+	// Metrics holds additional numeric readings, e.g. from sensors, by name.
+	Metrics map[string]float64 `bson:"metrics,omitempty"`
+
+	// The observer stores the cumulative network counters along with their
+	// rate since its previous sample.
+	NetBytesSent     uint64  `bson:"net_bytes_sent,omitempty" unit:"bytes"`
+	NetBytesRecv     uint64  `bson:"net_bytes_recv,omitempty" unit:"bytes"`
+	NetBytesSentRate float64 `bson:"net_bytes_sent_rate,omitempty" unit:"bytes/s" binding:"gte=0"`
+	NetBytesRecvRate float64 `bson:"net_bytes_recv_rate,omitempty" unit:"bytes/s" binding:"gte=0"`
+
+	// Samples is the number of raw measurements an hourly rollup averages;
+	// it is zero for raw measurements.
+	Samples int `bson:"samples,omitempty"`
+
+	// DeletedAt is set on measurements deleted while SOFT_DELETE is on.
+	DeletedAt *time.Time `bson:"deleted_at,omitempty" json:"DeletedAt,omitempty"`
 }
 
-func getCPURAMUsage() (float64, float64, error) {
+// getCPURAMUsage samples the CPU usage over window and the current RAM usage
+// of this machine.
+func getCPURAMUsage(window time.Duration) (float64, float64, error) {
 	// Get CPU usage percentage
-	percent, err := cpu.Percent(time.Second, false)
+	percent, err := cpu.Percent(window, false)
 	if err != nil {
 		return 0.0, 0.0, err
 	}
@@ -58,86 +92,273 @@ func getCPURAMUsage() (float64, float64, error) {
 // var client *mongo.Client
 // var collection *mongo.Collection
 
+// serveRecentFromCache answers a ?recent=true request from the in-memory
+// cache when MongoDB cannot be reached. It reports whether it responded.
+func serveRecentFromCache(c *gin.Context) bool {
+	if c.Query("recent") != "true" {
+		return false
+	}
+	recent := recentCache.Recent()
+	if len(recent) == 0 {
+		return false
+	}
+	c.Header(cacheHeader, "true")
+	respondMeasurements(c, recent)
+	return true
+}
+
 // @Summary Get CPU and RAM usage
-// @Description Retrieves the CPU and RAM usage in percentages
+// @Description Retrieves the CPU and RAM usage in percentages. Accept: application/x-protobuf returns a MeasurementList message of proto/measurement.proto.
 // @Tags Measurements
 // @Produce json
+// @Produce application/x-protobuf
+// @Param from query string false "Only measurements at or after this RFC3339 timestamp"
+// @Param to query string false "Only measurements at or before this RFC3339 timestamp (defaults to now when from is set)"
+// @Param host query string false "Only measurements from this host"
+// @Param source query string false "host (default) for host measurements, self for those of this process" Enums(host, self)
+// @Param cpu_gt query number false "Only measurements with CPU usage above this value"
+// @Param cpu_lt query number false "Only measurements with CPU usage below this value"
+// @Param ram_gt query number false "Only measurements with RAM usage above this value"
+// @Param ram_lt query number false "Only measurements with RAM usage below this value"
+// @Param metric query string false "Only measurements having this additional metric, see metric_gt and metric_lt"
+// @Param metric_gt query number false "Only measurements whose metric is above this value"
+// @Param metric_lt query number false "Only measurements whose metric is below this value"
+// @Param match query string false "Combine filters with AND (all, default) or OR (any)" Enums(all, any)
+// @Param recent query bool false "Serve the most recent measurements from the in-memory cache if MongoDB is unavailable"
+// @Param rollups query bool false "Include the hourly rollups of compacted measurements, marked by a non-zero Samples (default: when from is older than ROLLUP_AGE and the query is not paginated)"
+// @Param limit query int false "Page size, enables pagination in ID order (default 1000, max 10000)"
+// @Param after_token query string false "Return the page after the one whose X-Next-Token header carried this token"
+// @Param include_deleted query bool false "Include soft-deleted measurements, marked by DeletedAt"
 // @Success 200 {object} Measurement
+// @Header 200 {string} X-Next-Token "Token of the next page, absent on the last page"
+// @Header 200 {string} X-Data-Source "raw, or raw, rollups when rollups were included"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 503 {object} ErrorResponse "MongoDB unavailable"
 // @Router /measurements [get]
 func getMeasurements(c *gin.Context) {
-	ctx, cancel := context.WithTimeout(context.Background(),
+	filter, err := measurementFilter(c)
+	if err != nil {
+		respondError(c, validationError(err))
+		return
+	}
+	page, paginated, err := parsePage(c)
+	if err != nil {
+		respondError(c, validationError(err))
+		return
+	}
+	withRollups, err := includeRollups(c, paginated)
+	if err != nil {
+		respondError(c, validationError(err))
+		return
+	}
+	if paginated && withRollups {
+		respondError(c, validationError(errors.New("rollups cannot be combined with pagination")))
+		return
+	}
+	findOptions := options.Find()
+	if paginated {
+		filter, findOptions = page.apply(filter)
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(),
 		10*time.Second)
 	defer cancel()
 
-	client, err := mongo.Connect(ctx,
-		options.Client().ApplyURI("mongodb://mongodb:27017"))
+	collection, err := getMongoCollection()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError,
-			gin.H{"error": "Failed to connect to MongoDB"})
+		if serveRecentFromCache(c) {
+			return
+		}
+		respondError(c, errDBUnavailable)
 		return
 	}
-	defer func() {
-		if err = client.Disconnect(ctx); err != nil {
-			log.Fatal(err)
-		}
-	}()
 
-	collection :=
-		client.Database("go-database").Collection("resource-mon")
-
-	cur, err := collection.Find(ctx, bson.M{})
+	cur, err := collection.Find(ctx, filter, findOptions)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError,
-			gin.H{"error": "Failed to retrieve measurements"})
+		if serveRecentFromCache(c) {
+			return
+		}
+		respondError(c, internalError("Failed to retrieve measurements"))
 		return
 	}
 	defer cur.Close(ctx)
 
 	var measurements []Measurement
 	if err := cur.All(ctx, &measurements); err != nil {
-		c.JSON(http.StatusInternalServerError,
-			gin.H{"error": "Failed to decode measurements"})
+		respondError(c, internalError("Failed to decode measurements"))
+		return
+	}
+
+	if withRollups {
+		// Rollups keep the labels and average the metrics, so the same
+		// filter selects them.
+		rollups, err := findRollups(ctx, collection, filter)
+		if err != nil {
+			respondError(c, internalError("Failed to retrieve rollups"))
+			return
+		}
+		// Rollups only cover data older than the raw measurements.
+		measurements = append(rollups, measurements...)
+		c.Header(dataSourceHeader, "raw, rollups")
+	} else {
+		c.Header(dataSourceHeader, "raw")
+	}
+	if paginated {
+		if token := page.nextToken(measurements); token != "" {
+			c.Header(nextTokenHeader, token)
+		}
+	}
+	respondMeasurements(c, measurements)
+}
+
+// @Summary Get the latest measurement
+// @Description Retrieves the most recent measurement. If MongoDB is unavailable the last cached measurement is returned with the X-Served-From-Cache header set. Accept: application/x-protobuf returns a Measurement message of proto/measurement.proto.
+// @Tags Measurements
+// @Produce json
+// @Produce application/x-protobuf
+// @Success 200 {object} Measurement
+// @Failure 404 {object} ErrorResponse "No measurements"
+// @Failure 503 {object} ErrorResponse "MongoDB unavailable and nothing cached"
+// @Router /measurements/latest [get]
+func getLatestMeasurement(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	var measurement Measurement
+	collection, err := getMongoCollection()
+	if err == nil {
+		measurement, err = latestMeasurement(ctx, collection)
+	}
+	if err == mongo.ErrNoDocuments {
+		respondError(c, &APIError{http.StatusNotFound, codeNotFound, "No measurements", nil})
 		return
 	}
+	if err != nil {
+		if cached, ok := recentCache.Latest(); ok {
+			c.Header(cacheHeader, "true")
+			respondMeasurement(c, cached)
+			return
+		}
+		respondError(c, &APIError{http.StatusServiceUnavailable, codeDBUnavailable,
+			"Failed to retrieve the latest measurement", nil})
+		return
+	}
+
+	respondMeasurement(c, measurement)
+}
 
-	c.JSON(http.StatusOK, measurements)
+// latestMeasurement returns the measurement with the newest timestamp, or
+// mongo.ErrNoDocuments if there is none.
+func latestMeasurement(ctx context.Context, collection *mongo.Collection) (Measurement, error) {
+	var measurement Measurement
+	opts := options.FindOne().SetSort(bson.M{"timestamp": -1})
+	err := collection.FindOne(ctx, notDeleted(fromSource(bson.M{}, hostSource)), opts).Decode(&measurement)
+	return measurement, err
 }
 
 // @Summary Create a new measurement
-// @Description Create a new measurement record
+// @Description Create a new measurement record. JSON is the primary format; form-encoded bodies are accepted as for /ingest. A JSON array of up to 1000 measurements, or a text/csv or application/x-ndjson body with up to 1000 rows, is stored as a batch and answered with a BatchResult, with status 207 if some of them failed.
 // @Accept json
+// @Accept x-www-form-urlencoded
+// @Accept text/csv
+// @Accept application/x-ndjson
 // @Produce json
 // @Param measurement body Measurement true "Measurement object to be created"
+// @Param Idempotency-Key header string false "Key under which a retry returns the original response instead of storing again"
 // @Success 201 {string} string "Measurement created successfully"
-// @Failure 400 {object} string "Bad request"
-// @Failure 500 {object} string "Internal server error"
+// @Success 207 {object} BatchResult "Batch partially stored"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 409 {object} ErrorResponse "Idempotency-Key in progress or used with a different body, or the measurement duplicates a unique index key"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 503 {object} ErrorResponse "MongoDB unavailable"
 // @Router /measurements [post]
 func createMeasurement(c *gin.Context) {
-	var measurement Measurement
-	if err := c.ShouldBindJSON(&measurement); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if c.ContentType() == gin.MIMEPOSTForm {
+		ingestMeasurement(c)
 		return
 	}
 
-	collection, err := getMongoCollection()
+	body, err := c.GetRawData()
 	if err != nil {
-		log.Fatal(err)
+		respondError(c, validationError(err))
+		return
+	}
+	if contentType := c.ContentType(); isImportFormat(contentType) || isJSONArray(body) {
+		createMeasurementBatch(c, contentType, body)
+		return
 	}
 
-	_, err = collection.InsertOne(nil, measurement)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	var measurement Measurement
+	if err := json.Unmarshal(body, &measurement); err != nil {
+		respondError(c, validationError(err))
+		return
+	}
+
+	if _, err := insertMeasurement(c.Request.Context(), measurement); err != nil {
+		respondError(c, err)
 		return
 	}
 
 	c.Status(http.StatusCreated)
 }
-func getMongoCollection() (*mongo.Collection, error) {
-	// Set MongoDB connection options
-	clientOptions := options.Client().ApplyURI("mongodb://mongodb:27017")
 
-	// Connect to MongoDB
-	client, err := mongo.Connect(context.Background(), clientOptions)
+// mongoClientOptions returns the options every MongoDB client is created
+// with. All options come from MONGO_URI, except that a set
+// MONGO_READ_PREFERENCE overrides the URI's readPreference and a set
+// MONGO_MAX_CONCURRENT its maxPoolSize. The read preference only routes
+// reads; writes always go to the primary.
+func mongoClientOptions() *options.ClientOptions {
+	clientOptions := options.Client().ApplyURI(cfg().MongoURI)
+	// The pool bounds the concurrent operations of MQTT ingest, the
+	// observers, rollups and replay too, which wait for a connection
+	// instead of being rejected as API requests are.
+	if cfg().MongoMaxConcurrent > 0 {
+		clientOptions.SetMaxPoolSize(uint64(cfg().MongoMaxConcurrent))
+	}
+	if cfg().MongoReadPref != "" {
+		mode, _ := readpref.ModeFromString(cfg().MongoReadPref) // validated at startup
+		readPref, _ := readpref.New(mode)
+		clientOptions.SetReadPreference(readPref)
+	}
+	return clientOptions
+}
+
+// mongoClient is the client shared by all MongoDB operations, so that they
+// reuse one connection pool. It is connected on first use and disconnected
+// last on shutdown.
+var mongoClient struct {
+	sync.Mutex
+	client *mongo.Client
+}
+
+// sharedMongoClient returns the shared client, creating it on first use.
+func sharedMongoClient() (*mongo.Client, error) {
+	mongoClient.Lock()
+	defer mongoClient.Unlock()
+	if mongoClient.client == nil {
+		client, err := mongo.Connect(context.Background(), mongoClientOptions())
+		if err != nil {
+			return nil, err
+		}
+		mongoClient.client = client
+	}
+	return mongoClient.client, nil
+}
+
+// disconnectMongo closes the connections of the shared client, if it was
+// created, once nothing writes any more.
+func disconnectMongo(ctx context.Context) error {
+	mongoClient.Lock()
+	defer mongoClient.Unlock()
+	if mongoClient.client == nil {
+		return nil
+	}
+	return mongoClient.client.Disconnect(ctx)
+}
+
+func getMongoCollection() (*mongo.Collection, error) {
+	client, err := sharedMongoClient()
 	if err != nil {
 		return nil, err
 	}
@@ -149,46 +370,51 @@ func getMongoCollection() (*mongo.Collection, error) {
 	}
 
 	// Set the collection
-	collection := client.Database("go-database").Collection("resource-mon")
+	collection := client.Database(cfg().MongoDatabase).Collection(cfg().MongoCollection)
 
 	return collection, nil
 }
 
 // @Summary Get a measurement by ID
-// @Description Get a measurement record by ID
+// @Description Get a measurement record by ID. Accept: application/x-protobuf returns a Measurement message of proto/measurement.proto.
 // @Produce json
+// @Produce application/x-protobuf
 // @Param id path string true "Measurement ID"
+// @Param include_deleted query bool false "Also return the measurement if it is soft-deleted"
 // @Success 200 {object} Measurement "Measurement object"
-// @Failure 404 {object} string "Measurement not found"
-// @Failure 500 {object} string "Internal server error"
+// @Failure 400 {object} ErrorResponse "Invalid ID"
+// @Failure 404 {object} ErrorResponse "Measurement not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 503 {object} ErrorResponse "MongoDB unavailable"
 // @Router /measurements/{id} [get]
 func getMeasurement(c *gin.Context) {
 	id := c.Param("id")
 
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		respondError(c, errInvalidID)
 		return
 	}
 	collection, err := getMongoCollection()
 	if err != nil {
-		log.Fatal(err)
+		respondError(c, errDBUnavailable)
+		return
 	}
 
+	filter := bson.M{"_id": objectID}
+	if !includeDeleted(c) {
+		filter = notDeleted(filter)
+	}
 	var measurement Measurement
-	err = collection.FindOne(nil, bson.M{"_id": objectID}).Decode(&measurement)
+	err = collection.FindOne(c.Request.Context(), filter).Decode(&measurement)
 
 	log.Println(measurement)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			c.Status(http.StatusNotFound)
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		}
+		respondError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, measurement)
+	respondMeasurement(c, measurement)
 }
 
 // @Summary Update a measurement
@@ -198,28 +424,40 @@ func getMeasurement(c *gin.Context) {
 // @Param id path string true "Measurement ID"
 // @Param measurement body Measurement true "Measurement object to be updated"
 // @Success 200 {string} string "Measurement updated successfully"
-// @Failure 400 {object} string "Bad request"
-// @Failure 500 {object} string "Internal server error"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 503 {object} ErrorResponse "MongoDB unavailable"
 // @Router /measurements/{id} [put]
 func updateMeasurement(c *gin.Context) {
 	id := c.Param("id")
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		respondError(c, errInvalidID)
 		return
 	}
 	collection, err := getMongoCollection()
 	if err != nil {
-		log.Fatal(err)
+		respondError(c, errDBUnavailable)
+		return
 	}
+	// Decoded without binding, which would stop at the first invalid field.
 	var measurement Measurement
-	if err := c.ShouldBindJSON(&measurement); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := json.NewDecoder(c.Request.Body).Decode(&measurement); err != nil {
+		respondError(c, validationError(err))
+		return
+	}
+	if details := measurement.validate(); len(details) > 0 {
+		respondError(c, invalidMeasurement(details))
 		return
 	}
-	_, err = collection.ReplaceOne(nil, bson.M{"_id": objectID}, measurement)
+	measurement = withEnvironment(measurement)
+	if cfg().EnableHistory {
+		err = replaceWithHistory(c.Request.Context(), collection, objectID, measurement)
+	} else {
+		_, err = collection.ReplaceOne(c.Request.Context(), notDeleted(bson.M{"_id": objectID}), measurement)
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
@@ -227,80 +465,273 @@ func updateMeasurement(c *gin.Context) {
 }
 
 // @Summary Delete a measurement
-// @Description Delete a measurement record by ID
+// @Description Delete a measurement record by ID and return the deleted record. With SOFT_DELETE the record is only marked as deleted and can be restored.
+// @Produce json
 // @Param id path string true "Measurement ID"
-// @Success 200 {string} string "Measurement deleted successfully"
-// @Failure 500 {object} string "Internal server error"
+// @Success 200 {object} Measurement "Deleted measurement"
+// @Failure 400 {object} ErrorResponse "Invalid ID"
+// @Failure 404 {object} ErrorResponse "Measurement not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 503 {object} ErrorResponse "MongoDB unavailable"
 // @Router /measurements/{id} [delete]
 func deleteMeasurement(c *gin.Context) {
 	id := c.Param("id")
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		respondError(c, errInvalidID)
+		return
+	}
+	if cfg().SoftDelete {
+		measurement, err := softDeleteMeasurement(c, objectID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, responseMeasurement(measurement))
 		return
 	}
+
 	collection, err := getMongoCollection()
 	if err != nil {
-		log.Fatal(err)
+		respondError(c, errDBUnavailable)
+		return
 	}
 
-	_, err = collection.DeleteOne(nil, bson.M{"_id": objectID})
+	var measurement Measurement
+	err = collection.FindOneAndDelete(c.Request.Context(), bson.M{"_id": objectID}).Decode(&measurement)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
-	c.Status(http.StatusOK)
+	c.JSON(http.StatusOK, responseMeasurement(measurement))
 }
 
-func storeLocalMeasurement(cpu float64, ram float64) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-	collection, err := getMongoCollection()
-	measurement := Measurement{
-		Timestamp: time.Now(),
-		CPU:       cpu,
-		RAM:       ram,
-	}
-	log.Println("a new record is inserted")
+func storeLocalMeasurement(measurement Measurement) error {
+	measurement.Timestamp = time.Now()
+	measurement.Host = hostname
 
-	_, err = collection.InsertOne(ctx, measurement)
+	stored, err := insertMeasurement(context.Background(), measurement)
+	if errors.Is(err, errWriteRateExceeded) {
+		// Buffering would only defer the excess writes, not drop them.
+		return err
+	}
 	if err != nil {
+		// Publishing does not depend on MongoDB.
+		publishMeasurement(measurement)
+		if observerBuffer != nil {
+			if berr := observerBuffer.Append(measurement); berr != nil {
+				log.Println("Error buffering measurement:", berr)
+			}
+		}
 		return err
 	}
+	log.Println("a new record is inserted")
+	publishMeasurement(stored)
 
+	// MongoDB is reachable again, so flush what piled up while it was not.
+	replayObserverBuffer()
 	return nil
 }
 
-func runResourceObserver() {
-	ticker := time.NewTicker(10 * time.Second) // Change the interval  as per your requirement.
-	go func() {
-		for range ticker.C {
-			cpu, ram, err := getCPURAMUsage()
-			if err != nil {
-				log.Println("Error getting CPU and RAM usage:",
-					err)
-				continue
-			}
+// insertMeasurement stores measurement, retrying transient Mongo errors, and
+// adds it to the recent cache. The stored measurement, including its
+// generated ID, is returned. Every code path that creates measurements goes
+// through here, so this is where MAX_WRITE_RATE is enforced.
+func insertMeasurement(ctx context.Context, measurement Measurement) (Measurement, error) {
+	return insertMeasurementWithConcern(ctx, measurement, nil)
+}
 
-			err = storeLocalMeasurement(cpu, ram)
-			if err != nil {
-				log.Println("Error storing measurement:", err)
-			}
+// insertMeasurementWithConcern is insertMeasurement with the write concern
+// wc, or the one of the connection if nil. An unacknowledged write counts
+// as stored once it was sent. Once ctx is done, e.g. when a request timed
+// out, the insert is abandoned.
+func insertMeasurementWithConcern(ctx context.Context, measurement Measurement, wc *writeconcern.WriteConcern) (Measurement, error) {
+	// Every write path but batches goes through here, so that a reading
+	// rejected on one path is not stored through another.
+	if details := measurement.validate(); len(details) > 0 {
+		return measurement, invalidMeasurement(details)
+	}
+	if !allowWrites(1) {
+		return measurement, errWriteRateExceeded
+	}
+	measurement = withEnvironment(measurement)
+	var result *mongo.InsertOneResult
+	err := retryTransient(ctx, "insert measurement", func() error {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+
+		collection, err := getMongoCollection()
+		if err != nil {
+			return err
 		}
-	}()
+		if wc != nil {
+			collection = collection.Database().Collection(collection.Name(), options.Collection().SetWriteConcern(wc))
+		}
+		result, err = collection.InsertOne(ctx, measurement)
+		if errors.Is(err, mongo.ErrUnacknowledgedWrite) {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return measurement, duplicateMeasurement(err)
+	}
+
+	measurement.ID, _ = result.InsertedID.(primitive.ObjectID)
+	recentCache.Add(measurement)
+	broadcastMeasurement(measurement)
+	invalidateQueryCacheFor(measurement)
+	return measurement, nil
 }
 
-var wg sync.WaitGroup
+// environmentLabel is the label set to APP_ENV on stored measurements.
+const environmentLabel = "environment"
+
+// withEnvironment returns measurement labeled with the APP_ENV environment,
+// if set, so that data of several environments sharing a database stays
+// distinguishable. The configured environment replaces any label the
+// sender set. The labels are copied, as the caller may still use them.
+func withEnvironment(measurement Measurement) Measurement {
+	env := cfg().AppEnv
+	if env == "" {
+		return measurement
+	}
+	labels := make(map[string]string, len(measurement.Labels)+1)
+	for name, value := range measurement.Labels {
+		labels[name] = value
+	}
+	labels[environmentLabel] = env
+	measurement.Labels = labels
+	return measurement
+}
+
+// jitteredDelay returns a random offset within ±jitter*interval. A jitter of
+// zero always returns zero.
+func jitteredDelay(interval time.Duration, jitter float64) time.Duration {
+	if jitter <= 0 {
+		return 0
+	}
+	return time.Duration((rand.Float64()*2 - 1) * jitter * float64(interval))
+}
+
+// hostname identifies this machine on the measurements the observer stores.
+var hostname, _ = os.Hostname()
+
+// runResourceObserver stores a measurement of this machine, taken from
+// sampler, on every observer tick until stopping is closed.
+func runResourceObserver(sampler Sampler, stopping <-chan struct{}) {
+	// Samples buffered by a previous run are stored before new ones.
+	replayObserverBuffer()
+
+	// Ticks stay anchored to the base schedule so that jitter does not
+	// accumulate drift over time.
+	next := time.Now()
+	var changes changeFilter
+	var backoff samplingBackoff
+	var prevNet *netCounters
+	for {
+		// The interval and jitter are read on every tick so that a
+		// configuration reload applies without a restart. The jitter
+		// spreads the writes of many instances sharing the same
+		// interval; it is a fraction of the interval, e.g. 0.1 for ±10%.
+		interval := backoff.next()
+		next = next.Add(interval)
+		if sleepOrStop(stopping, time.Until(next.Add(jitteredDelay(interval, cfg().ObserverJitter)))) {
+			return
+		}
+
+		// A resumed observer starts a new schedule, and its network
+		// rates do not span the pause.
+		if awaitObserverResume(stopping) {
+			next = time.Now()
+			prevNet = nil
+			continue
+		}
+
+		cpu, ram, err := sampler.Sample()
+		if err != nil {
+			log.Println("Error getting CPU and RAM usage:",
+				err)
+			continue
+		}
+		backoff.observe(cpu)
+
+		now := time.Now()
+		if !changes.shouldStore(cpu, ram, now, cfg().ObserverChangeDelta, cfg().ObserverMaxUnchanged) {
+			continue
+		}
+		// A sample that could not be inserted is buffered, so it still
+		// counts as stored.
+		changes.record(cpu, ram, now)
+
+		measurement := Measurement{CPU: cpu, RAM: ram}
+		metrics := cfg().Metrics
+		if collects(metrics, "disk") {
+			measurement.Disks = getDiskUsage(cfg().DiskPaths, cfg().DiskSampleWorkers)
+		}
+		if !collects(metrics, "net") {
+			// Rates resume from the next sample once net is selected again.
+			prevNet = nil
+		} else if counters, err := readNetCounters(); err != nil {
+			log.Println("Error getting network counters:", err)
+		} else {
+			counters.apply(&measurement, prevNet)
+			prevNet = &counters
+		}
+
+		err = storeLocalMeasurement(measurement.roundedPercents())
+		if err != nil {
+			log.Println("Error storing measurement:", err)
+		}
+	}
+}
 
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-API-Key
 func main() {
-	// Start MQTT in a separate goroutine
-	wg.Add(1)
-	go runMQTT()
-	// Run other tasks or code here
-	go runResourceObserver()
+	check := flag.Bool("check", false,
+		"verify the MongoDB and MQTT connections and exit instead of serving")
+	flag.Parse()
+
+	config, err := loadConfig()
+	if err != nil {
+		log.Fatal("Invalid configuration: ", err)
+	}
+	liveConfig.Store(&config)
+	recentCache = newMeasurementCache(cfg().RecentCacheSize)
+	observerBuffer = newDiskBuffer(cfg().ObserverBufferFile, cfg().ObserverBufferMaxBytes)
 
-	router := gin.Default()
+	if *check || cfg().Check {
+		os.Exit(runSelfCheck())
+	}
+
+	// A read-only service only queries the data that is already stored, so
+	// nothing that writes measurements is started.
+	if cfg().ReadOnly {
+		log.Println("Read-only mode: MQTT, UDP, the observers and rollups are disabled")
+	} else {
+		udpConn, err := listenUDP()
+		if err != nil {
+			log.Fatal("Error listening for UDP measurements: ", err)
+		}
+
+		// Start MQTT in a separate goroutine
+		go runMQTT()
+		if udpConn != nil {
+			go serveUDP(udpConn)
+		}
+		// Run other tasks or code here
+		startTask("resource observer", func(stopping <-chan struct{}) {
+			runResourceObserver(gopsutilSampler{}, stopping)
+		})
+		startTask("rollups", runRollups)
+		startTask("self observer", runSelfObserver)
+	}
+
+	router := gin.New()
+	router.Use(gin.LoggerWithFormatter(requestLogFormatter), assignRequestID(cfg().RequestIDHeader), responseHeaders(), recoverPanics(), cacheQueries())
 
 	// Initialize Swagger documentation
 	docs.SwaggerInfo.Title = "Your API Title"
@@ -310,44 +741,118 @@ func main() {
 	docs.SwaggerInfo.BasePath = "/"
 
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
-	router.GET("/measurements", getMeasurements)
-	router.POST("/measurements", createMeasurement)
-	router.GET("/measurements/:id", getMeasurement)
-	router.PUT("/measurements/:id", updateMeasurement)
-	router.DELETE("/measurements/:id", deleteMeasurement)
+	router.GET("/openapi.json", getOpenAPISpec)
 
-	router.GET("/")
+	limitMongo := limitMongoOps(cfg().MongoMaxConcurrent)
+	measurements := router.Group("/measurements", limitMongo)
+	if cfg().DebugHTTP {
+		measurements.Use(debugBodyLogger(cfg().DebugHTTPRedact, cfg().DebugHTTPMaxBody))
+	}
 
-	log.Println("server started")
-	router.Run(":8080")
-	// Wait for MQTT goroutine to finish
-	wg.Wait()
-}
+	// Each class of endpoint has its own timeout: plain reads and writes,
+	// aggregations over time ranges, and exports.
+	standardTimeout := requestTimeout(func(c *Config) time.Duration { return c.RequestTimeout })
+	aggregationTimeout := requestTimeout(func(c *Config) time.Duration { return c.AggregationTimeout })
+	exportTimeout := requestTimeout(func(c *Config) time.Duration { return c.ExportTimeout })
 
-func runMQTT() {
-	defer wg.Done()
+	// Writes are rejected in read-only mode and during maintenance.
+	writable := rejectWrites()
 
-	// MQTT broker URL
-	brokerURL := "tcp://mqtt-broker:1883"
+	crud := measurements.Group("", standardTimeout)
+	crud.GET("", getMeasurements)
+	crud.POST("", writable, idempotent(), createMeasurement)
+	crud.PATCH("", writable, updateMeasurements)
+	crud.POST("/import/validate", validateImport)
+	crud.GET("/latest", getLatestMeasurement)
+	crud.GET("/schema", getMeasurementSchema)
+	crud.GET("/diff", getMeasurementDiff)
+	crud.GET("/around", getMeasurementsAround)
+	crud.GET("/replay", getReplayStatus)
+	crud.POST("/replay", writable, startReplay)
+	crud.DELETE("/replay", writable, cancelReplay)
+	crud.GET("/:id", getMeasurement)
+	crud.GET("/:id/history", getMeasurementHistory)
+	crud.PUT("/:id", writable, updateMeasurement)
+	crud.DELETE("/:id", writable, deleteMeasurement)
+	crud.POST("/:id/restore", writable, restoreMeasurement)
 
-	// MQTT client options
-	opts := mqtt.NewClientOptions()
-	opts.AddBroker(brokerURL)
-	opts.SetClientID("mqtt-client")
-	opts.SetDefaultPublishHandler(messageHandler)
+	aggregations := measurements.Group("", aggregationTimeout)
+	aggregations.GET("/by-host", getLoadByHost)
+	aggregations.GET("/recent-avg", getRecentAverage)
+	aggregations.GET("/forecast", getForecast)
+	aggregations.GET("/deviation", getDeviation)
+	aggregations.GET("/availability", getAvailability)
+	aggregations.GET("/peaks", getPeaks)
+	aggregations.GET("/correlation", getCorrelation)
+	aggregations.GET("/rate", getIngestRate)
+	aggregations.GET("/delete-older-than", previewRetention)
 
-	// Create MQTT client
-	client := mqtt.NewClient(opts)
+	measurements.GET("/export", exportTimeout, exportMeasurements)
+	// Streams run until the client leaves, so they neither hold a MongoDB
+	// slot nor have a timeout.
+	router.GET("/measurements/tail", tailMeasurements)
 
-	// Connect to the MQTT broker
-	if token := client.Connect(); token.Wait() && token.Error() != nil {
-		log.Fatal(token.Error())
+	router.GET("/ingest", writable, limitMongo, standardTimeout, ingestMeasurement)
+	router.POST("/ingest", writable, limitMongo, standardTimeout, ingestMeasurement)
+	router.GET("/health", getHealth)
+	router.GET("/version", getVersion)
+	router.GET("/hosts", limitMongo, standardTimeout, getHosts)
+	router.GET("/rollups", limitMongo, standardTimeout, getRollups)
+	router.GET("/baselines", limitMongo, standardTimeout, listBaselines)
+	router.PUT("/baselines/:host", writable, limitMongo, standardTimeout, putBaseline)
+	router.GET("/broker/stats", getBrokerStats)
+	router.GET("/topics", getTopics)
+	router.GET("/deadletter", limitMongo, standardTimeout, listDeadLetters)
+	router.POST("/deadletter/:id/retry", writable, limitMongo, standardTimeout, retryDeadLetter)
+	router.GET("/metrics", getMetrics)
+	router.GET("/api/v1/query_range", limitMongo, aggregationTimeout, prometheusQueryRange)
+	router.POST("/api/v1/query_range", limitMongo, aggregationTimeout, prometheusQueryRange)
+
+	// Grafana's SimpleJSON data source, with its URL set to /grafana.
+	grafana := router.Group("/grafana")
+	grafana.GET("/", simpleJSONHealth)
+	grafana.POST("/search", simpleJSONSearch)
+	grafana.POST("/query", limitMongo, aggregationTimeout, simpleJSONQuery)
+
+	admin := router.Group("/admin", requireAdmin())
+	admin.GET("/config", getConfig)
+	admin.POST("/reload", reloadConfig)
+	admin.GET("/indexes", listIndexes)
+	admin.POST("/indexes", writable, createIndex)
+	admin.GET("/storage", getStorageStats)
+	admin.POST("/maintenance", setMaintenance)
+	admin.POST("/observer/pause", pauseObserver)
+	admin.POST("/observer/resume", resumeObserver)
+
+	router.GET("/")
+
+	log.Println("server started")
+	server := &http.Server{Handler: router}
+	server.RegisterOnShutdown(closeTailStreams)
+	go func() {
+		if err := serveHTTP(server); !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+	os.Exit(awaitShutdown(server))
+}
+
+func runMQTT() {
+	client, err := connectMQTT(cfg().MQTTClientID)
+	if err != nil {
+		log.Fatal(err)
 	}
+	mqttClient.Store(client)
+	startMQTTWorkers(cfg().MQTTWorkers, cfg().MQTTQueueSize)
 
 	// Subscribe to MQTT topics and set the message handler
-	if token := client.Subscribe("my-topic", 0, nil); token.Wait() && token.Error() != nil {
-		log.Fatal(token.Error())
+	if err := subscribeMeasurements(client); err != nil {
+		log.Fatal(err)
+	}
+	if err := subscribeBrokerStats(client); err != nil {
+		log.Fatal(err)
 	}
+	go runMQTTWatchdog(client)
 
 	// Keep the application running
 	select {}
@@ -356,11 +861,9 @@ func runMQTT() {
 
 func sendMessage() {
 	// Create MQTT client
-	// MQTT broker URL
-	brokerURL := "tcp://mqtt-broker:1883"
 	opts := mqtt.NewClientOptions()
-	opts.AddBroker(brokerURL)
-	opts.SetClientID("mqtt-client")
+	opts.AddBroker(cfg().MQTTBrokerURL)
+	opts.SetClientID(cfg().MQTTClientID)
 	client := mqtt.NewClient(opts)
 	// Connect to the MQTT broker
 	if token := client.Connect(); token.Wait() && token.Error() != nil {
@@ -369,35 +872,153 @@ func sendMessage() {
 
 }
 
-func messageHandler(client mqtt.Client, msg mqtt.Message) {
-	fmt.Printf("Received message: %s from topic: %s\n", msg.Payload(), msg.Topic())
-	var measurement Measurement
-	err := json.Unmarshal(msg.Payload(), &measurement)
-	if err != nil {
-		log.Printf("Error parsing JSON: %s\n", err)
+// subscribeMeasurements subscribes messageHandler to the measurement topic.
+func subscribeMeasurements(client MQTTClient) error {
+	return client.Subscribe(cfg().MQTTTopic, byte(cfg().MQTTSubscribeQoS), messageHandler)
+}
+
+func messageHandler(msg mqttMessage) {
+	if cfg().MQTTPublishAck && isAckTopic(msg.Topic) {
 		return
 	}
+	receivedAt := time.Now()
+	lastMQTTMessage.Store(receivedAt.UnixNano())
+	recordTopic(msg.Topic)
+	if !queueMessage(msg, receivedAt) {
+		handleMessage(msg, receivedAt)
+	}
+}
 
-	measurement.Timestamp = time.Now()
+// handleMessage decodes, stores and acknowledges a measurement message
+// received at receivedAt, either right away or on an MQTT worker.
+func handleMessage(msg mqttMessage, receivedAt time.Time) {
+	// The ingest ID ties together the log lines of one message.
+	ctx := withLogID(context.Background(), "ingest_id", uuid.NewString())
+	logf(ctx, "Received message: %s from topic: %s\n", msg.Payload, msg.Topic)
+
+	measurement, err := decodeMessage(msg, receivedAt)
+	if err != nil {
+		logf(ctx, "Error decoding payload: %s\n", err)
+		deadLetter(msg, receivedAt, err)
+		publishAck(ctx, msg.Topic, Measurement{}, err)
+		return
+	}
 
-	err = storeMQTTMeasurement(measurement)
+	stored, err := storeMQTTMeasurement(ctx, measurement)
+	publishAck(ctx, msg.Topic, stored, err)
+	if errors.Is(err, errWriteRateExceeded) {
+		// Dropped on purpose, so there is nothing to replay.
+		logf(ctx, "Dropping measurement: %s\n", err)
+		return
+	}
 	if err != nil {
-		log.Printf("Error storing measurement: %s\n", err)
+		logf(ctx, "Error storing measurement: %s\n", err)
+		deadLetter(msg, receivedAt, err)
 		return
 	}
 
-	fmt.Println("Measurement stored successfully:", measurement)
+	logf(ctx, "Measurement stored successfully: %v\n", measurement)
 }
 
-func storeMQTTMeasurement(measurement Measurement) error {
-	collection, err := getMongoCollection()
+// decodeMessage turns a message received at receivedAt into the measurement
+// to store.
+func decodeMessage(msg mqttMessage, receivedAt time.Time) (Measurement, error) {
+	payload, err := decompressPayload(msg.Payload)
 	if err != nil {
-		log.Fatal(err)
+		return Measurement{}, fmt.Errorf("decompressing: %w", err)
 	}
-	_, err = collection.InsertOne(nil, measurement)
+	payload, err = payloadToJSON(msg.Topic, payload)
 	if err != nil {
-		return err
+		return Measurement{}, err
+	}
+	var envelopeHost string
+	var envelopeTime time.Time
+	if path := cfg().MQTTPayloadPath; path != "" {
+		payload, envelopeHost, envelopeTime, err = unwrapEnvelope(payload, path)
+		if err != nil {
+			return Measurement{}, err
+		}
+	}
+
+	var measurement Measurement
+	if err := json.Unmarshal(payload, &measurement); err != nil {
+		return Measurement{}, fmt.Errorf("parsing JSON: %w", err)
+	}
+
+	if measurement.Host == "" {
+		measurement.Host = envelopeHost
+	}
+	if measurement.Host == "" {
+		measurement.Host, _ = hostFromTopic(cfg().MQTTHostTopic, msg.Topic)
+	}
+	if measurement.Timestamp.IsZero() {
+		measurement.Timestamp = envelopeTime
+	}
+	measurement.Labels = withUserProperties(measurement.Labels, msg.UserProperties)
+	// Devices that buffer readings and send them late know best when they
+	// were taken, but their clocks are only trusted on request, and not
+	// with readings from the future.
+	if measurement.Timestamp.IsZero() || !cfg().MQTTTrustTimestamp ||
+		measurement.Timestamp.After(receivedAt.Add(maxTimestampSkew)) {
+		measurement.Timestamp = receivedAt
+	}
+	return measurement, nil
+}
+
+// maxTimestampSkew is how far ahead of the receive time a trusted payload
+// timestamp may be, to allow for devices whose clocks run slightly fast.
+const maxTimestampSkew = time.Minute
+
+// gzipMagic is the two-byte header every gzip stream starts with.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// decompressPayload returns the payload unchanged unless it is gzip
+// compressed, in which case the decompressed bytes are returned.
+func decompressPayload(payload []byte) ([]byte, error) {
+	if !bytes.HasPrefix(payload, gzipMagic) {
+		return payload, nil
 	}
 
+	reader, err := gzip.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return io.ReadAll(reader)
+}
+
+// withUserProperties adds the MQTT 5 user properties of a message, such as
+// device metadata, to the labels of its measurement. Labels set in the
+// payload win over user properties of the same name.
+func withUserProperties(labels map[string]string, properties map[string]string) map[string]string {
+	for name, value := range properties {
+		if _, ok := labels[name]; ok {
+			continue
+		}
+		if labels == nil {
+			labels = make(map[string]string, len(properties))
+		}
+		labels[name] = value
+	}
+	return labels
+}
+
+func storeMQTTMeasurement(ctx context.Context, measurement Measurement) (Measurement, error) {
+	return insertMeasurementWithConcern(ctx, measurement, ingestWriteConcern(cfg().IngestAck))
+}
+
+// ingestWriteConcern returns the write concern INGEST_ACK selects for MQTT
+// ingest: none for unacknowledged writes, 1 for the primary alone or
+// majority. It is nil when unset, keeping the one of MONGO_URI.
+func ingestWriteConcern(ack string) *writeconcern.WriteConcern {
+	switch ack {
+	case "none":
+		return writeconcern.New(writeconcern.W(0))
+	case "1":
+		return writeconcern.New(writeconcern.W(1))
+	case "majority":
+		return writeconcern.New(writeconcern.WMajority())
+	}
 	return nil
 }
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultMaintenanceRetryAfter is the Retry-After sent during maintenance
+// when the request enabling it does not set one.
+const defaultMaintenanceRetryAfter = 60
+
+// MaintenanceMode describes whether write endpoints are currently rejected.
+type MaintenanceMode struct {
+	Enabled bool `json:"enabled"`
+	// RetryAfterSeconds is sent as Retry-After with rejected writes.
+	RetryAfterSeconds int        `json:"retry_after_seconds,omitempty"`
+	Since             *time.Time `json:"since,omitempty"`
+}
+
+// maintenance is the current mode. It is kept in memory only, so a restart
+// always leaves maintenance.
+var maintenance struct {
+	mu   sync.RWMutex
+	mode MaintenanceMode
+}
+
+func currentMaintenance() MaintenanceMode {
+	maintenance.mu.RLock()
+	defer maintenance.mu.RUnlock()
+	return maintenance.mode
+}
+
+// rejectDuringMaintenance answers 503 with Retry-After while maintenance
+// mode is on. It guards the write endpoints; reads are served throughout.
+func rejectDuringMaintenance() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		mode := currentMaintenance()
+		if mode.Enabled {
+			c.Header("Retry-After", strconv.Itoa(mode.RetryAfterSeconds))
+			respondError(c, &APIError{http.StatusServiceUnavailable, codeMaintenance,
+				"Writes are disabled during maintenance, retry later", nil})
+			return
+		}
+		c.Next()
+	}
+}
+
+// @Summary Toggle maintenance mode
+// @Description Enables or disables maintenance mode. While enabled, the write endpoints answer 503 with Retry-After and reads keep working, e.g. during a backup or migration. The mode is kept in memory and ends with a restart.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param mode body MaintenanceMode true "enabled and, optionally, retry_after_seconds (default 60); since is ignored"
+// @Success 200 {object} MaintenanceMode
+// @Failure 400 {object} ErrorResponse "Invalid request"
+// @Failure 401 {object} ErrorResponse "Invalid API key"
+// @Failure 403 {object} ErrorResponse "Admin API disabled"
+// @Router /admin/maintenance [post]
+func setMaintenance(c *gin.Context) {
+	var mode MaintenanceMode
+	if err := c.ShouldBindJSON(&mode); err != nil {
+		respondError(c, validationError(err))
+		return
+	}
+	if mode.RetryAfterSeconds < 0 {
+		respondError(c, validationError(errors.New("retry_after_seconds must not be negative")))
+		return
+	}
+
+	maintenance.mu.Lock()
+	defer maintenance.mu.Unlock()
+	switch {
+	case !mode.Enabled:
+		mode = MaintenanceMode{}
+	case maintenance.mode.Enabled:
+		// Staying in maintenance keeps the original start.
+		mode.Since = maintenance.mode.Since
+	default:
+		now := time.Now()
+		mode.Since = &now
+	}
+	if mode.Enabled && mode.RetryAfterSeconds == 0 {
+		mode.RetryAfterSeconds = defaultMaintenanceRetryAfter
+	}
+	maintenance.mode = mode
+	logf(c.Request.Context(), "Maintenance mode enabled: %t\n", mode.Enabled)
+
+	c.JSON(http.StatusOK, mode)
+}
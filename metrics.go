@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// counter is a monotonically increasing metric exposed on GET /metrics.
+type counter struct {
+	name, help string
+	value      atomic.Int64
+}
+
+// Inc increments the counter by one.
+func (c *counter) Inc() {
+	c.value.Add(1)
+}
+
+// Add increments the counter by n.
+func (c *counter) Add(n int) {
+	c.value.Add(int64(n))
+}
+
+// gauge is a metric whose current value is read when GET /metrics is served.
+type gauge struct {
+	name, help string
+	value      func() float64
+}
+
+// registeredMetrics lists the metrics in registration order.
+var registeredMetrics struct {
+	sync.Mutex
+	counters []*counter
+	gauges   []*gauge
+}
+
+// newCounter creates a counter and registers it for GET /metrics.
+func newCounter(name, help string) *counter {
+	c := &counter{name: name, help: help}
+	registeredMetrics.Lock()
+	registeredMetrics.counters = append(registeredMetrics.counters, c)
+	registeredMetrics.Unlock()
+	return c
+}
+
+// newGauge registers a gauge for GET /metrics whose value is read by calling
+// value.
+func newGauge(name, help string, value func() float64) {
+	registeredMetrics.Lock()
+	registeredMetrics.gauges = append(registeredMetrics.gauges, &gauge{name: name, help: help, value: value})
+	registeredMetrics.Unlock()
+}
+
+// @Summary Get metrics
+// @Description Returns the service's own metrics in the Prometheus text exposition format
+// @Tags Health
+// @Produce plain
+// @Success 200 {string} string
+// @Router /metrics [get]
+func getMetrics(c *gin.Context) {
+	registeredMetrics.Lock()
+	counters := append([]*counter{}, registeredMetrics.counters...)
+	gauges := append([]*gauge{}, registeredMetrics.gauges...)
+	registeredMetrics.Unlock()
+
+	var b strings.Builder
+	for _, counter := range counters {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s counter\n%s %d\n",
+			counter.name, counter.help, counter.name, counter.name, counter.value.Load())
+	}
+	for _, gauge := range gauges {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n%s %g\n",
+			gauge.name, gauge.help, gauge.name, gauge.name, gauge.value())
+	}
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(b.String()))
+}
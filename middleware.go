@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// redactedValue replaces the values of redacted fields in debug logs.
+const redactedValue = "[REDACTED]"
+
+// bodyRecorder captures up to limit bytes of the response body while still
+// writing everything to the client. A negative limit captures all of it.
+type bodyRecorder struct {
+	gin.ResponseWriter
+	body  bytes.Buffer
+	limit int
+}
+
+func (w *bodyRecorder) Write(b []byte) (int, error) {
+	if w.limit < 0 {
+		w.body.Write(b)
+	} else if room := w.limit - w.body.Len(); room > 0 {
+		if len(b) < room {
+			room = len(b)
+		}
+		w.body.Write(b[:room])
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// debugBodyLogger logs request and response bodies, which helps diagnose
+// client serialization issues. JSON fields whose name is in redact (matched
+// case-insensitively, at any depth) are masked, and each logged body is
+// capped at maxBody bytes. With fields to redact the whole response is
+// recorded, since a truncated body cannot be parsed to mask them.
+func debugBodyLogger(redact []string, maxBody int) gin.HandlerFunc {
+	redacted := make(map[string]bool, len(redact))
+	for _, field := range redact {
+		redacted[strings.ToLower(field)] = true
+	}
+
+	return func(c *gin.Context) {
+		var requestBody []byte
+		if c.Request.Body != nil {
+			requestBody, _ = io.ReadAll(c.Request.Body)
+			c.Request.Body = io.NopCloser(bytes.NewReader(requestBody))
+		}
+
+		// One byte more than logged tells truncated responses apart.
+		limit := maxBody + 1
+		if len(redacted) > 0 {
+			limit = -1
+		}
+		recorder := &bodyRecorder{ResponseWriter: c.Writer, limit: limit}
+		c.Writer = recorder
+
+		c.Next()
+
+		logf(c.Request.Context(), "DEBUG %s %s request=%s status=%d response=%s\n",
+			c.Request.Method, c.Request.URL.RequestURI(),
+			redactBody(requestBody, redacted, maxBody),
+			recorder.Status(),
+			redactBody(recorder.body.Bytes(), redacted, maxBody))
+	}
+}
+
+// redactBody masks the redacted fields of a JSON body and truncates the
+// result to maxBody bytes. With fields to redact, bodies that are not valid
+// JSON are replaced by a placeholder, as they might contain them unmasked.
+func redactBody(body []byte, redacted map[string]bool, maxBody int) string {
+	if len(redacted) > 0 && len(body) > 0 {
+		var value interface{}
+		if err := json.Unmarshal(body, &value); err != nil {
+			return fmt.Sprintf("<unparseable body, %d bytes>", len(body))
+		}
+		masked, err := json.Marshal(redactValue(value, redacted))
+		if err != nil {
+			return fmt.Sprintf("<unparseable body, %d bytes>", len(body))
+		}
+		body = masked
+	}
+
+	if len(body) > maxBody {
+		return string(body[:maxBody]) + "...(truncated)"
+	}
+	return string(body)
+}
+
+func redactValue(value interface{}, redacted map[string]bool) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if redacted[strings.ToLower(key)] {
+				v[key] = redactedValue
+			} else {
+				v[key] = redactValue(field, redacted)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactValue(item, redacted)
+		}
+	}
+	return value
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDebugBodyLogger(t *testing.T) {
+	const maxBody = 64
+	// The secret comes first in each item, so that it would be logged
+	// within the cap if the response was not redacted.
+	var many []map[string]string
+	for i := 0; i < 20; i++ {
+		many = append(many, map[string]string{"token": "s3cret", "value": strings.Repeat("v", maxBody)})
+	}
+	tests := []struct {
+		name     string
+		redact   []string
+		body     interface{}
+		raw      string
+		want     []string
+		wantNone []string
+	}{
+		{name: "small response", redact: []string{"Token"}, body: gin.H{"labels": gin.H{"token": "s3cret"}},
+			want: []string{redactedValue}, wantNone: []string{"s3cret"}},
+		{name: "response larger than the cap", redact: []string{"token"}, body: many,
+			want: []string{redactedValue, "...(truncated)"}, wantNone: []string{"s3cret"}},
+		{name: "unparseable response", redact: []string{"token"}, raw: `host,token` + "\n" + `web-1,s3cret`,
+			want: []string{"<unparseable body, 23 bytes>"}, wantNone: []string{"s3cret"}},
+		{name: "nothing to redact", raw: `host,token` + "\n" + `web-1,s3cret`,
+			want: []string{"s3cret"}},
+		{name: "nothing to redact, truncated", body: many,
+			want: []string{"s3cret", "...(truncated)"}, wantNone: []string{redactedValue}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			log.SetOutput(&logs)
+			t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+			router := gin.New()
+			router.Use(debugBodyLogger(tt.redact, maxBody))
+			router.GET("/measurements", func(c *gin.Context) {
+				if tt.raw != "" {
+					c.String(http.StatusOK, tt.raw)
+					return
+				}
+				c.JSON(http.StatusOK, tt.body)
+			})
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", "/measurements", nil))
+
+			// The client always gets the whole, unredacted response.
+			if !strings.Contains(w.Body.String(), "s3cret") {
+				t.Errorf("response = %s, want it unredacted", w.Body)
+			}
+			for _, s := range tt.want {
+				if !strings.Contains(logs.String(), s) {
+					t.Errorf("log = %s, want it to contain %q", logs.String(), s)
+				}
+			}
+			for _, s := range tt.wantNone {
+				if strings.Contains(logs.String(), s) {
+					t.Errorf("log = %s, want it without %q", logs.String(), s)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/paho"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// mqttTimeout bounds connecting and subscribing to the broker.
+const mqttTimeout = 10 * time.Second
+
+// mqttMessage is a message received on a subscription.
+type mqttMessage struct {
+	Topic   string
+	Payload []byte
+	// QoS is the QoS the message was delivered with.
+	QoS byte
+
+	// UserProperties are the MQTT 5 user properties of the message. They
+	// are always empty with MQTT 3.1.1.
+	UserProperties map[string]string
+}
+
+// mqttHandler handles the messages of a subscription.
+type mqttHandler func(msg mqttMessage)
+
+// MQTTClient is the part of an MQTT client the service uses, so that either
+// protocol version can back it.
+type MQTTClient interface {
+	Subscribe(topic string, qos byte, handler mqttHandler) error
+	// Publish returns once the broker acknowledged the message as far as
+	// the QoS requires, or publishTimeout elapsed.
+	Publish(topic string, qos byte, retained bool, payload []byte) error
+	IsConnectionOpen() bool
+	Disconnect()
+}
+
+// connectMQTT creates a client with the given ID and connects it to the
+// broker, using the protocol version set by MQTT_PROTOCOL_VERSION.
+func connectMQTT(clientID string) (MQTTClient, error) {
+	if cfg().MQTTProtocolVersion == 5 {
+		return connectMQTTv5(clientID)
+	}
+	return connectMQTTv3(clientID)
+}
+
+// mqttV3Client is an MQTT 3.1.1 client.
+type mqttV3Client struct {
+	client mqtt.Client
+}
+
+func connectMQTTv3(clientID string) (MQTTClient, error) {
+	// MQTT client options
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(cfg().MQTTBrokerURL)
+	opts.SetClientID(clientID)
+	opts.SetKeepAlive(cfg().MQTTKeepAlive)
+	opts.SetPingTimeout(cfg().MQTTPingTimeout)
+
+	// Create MQTT client
+	client := mqtt.NewClient(opts)
+
+	// Connect to the MQTT broker
+	if err := waitMQTTToken(client.Connect(), mqttTimeout); err != nil {
+		return nil, err
+	}
+	return mqttV3Client{client}, nil
+}
+
+func (c mqttV3Client) Subscribe(topic string, qos byte, handler mqttHandler) error {
+	token := c.client.Subscribe(topic, qos, func(_ mqtt.Client, msg mqtt.Message) {
+		handler(mqttMessage{Topic: msg.Topic(), Payload: msg.Payload(), QoS: msg.Qos()})
+	})
+	return waitMQTTToken(token, mqttTimeout)
+}
+
+func (c mqttV3Client) Publish(topic string, qos byte, retained bool, payload []byte) error {
+	return waitMQTTToken(c.client.Publish(topic, qos, retained, payload), publishTimeout)
+}
+
+func (c mqttV3Client) IsConnectionOpen() bool {
+	return c.client.IsConnectionOpen()
+}
+
+func (c mqttV3Client) Disconnect() {
+	c.client.Disconnect(250)
+}
+
+func waitMQTTToken(token mqtt.Token, timeout time.Duration) error {
+	if !token.WaitTimeout(timeout) {
+		return fmt.Errorf("timed out after %s", timeout)
+	}
+	return token.Error()
+}
+
+// mqttV5Client is an MQTT 5 client. It reconnects on its own and renews its
+// subscriptions on every new connection.
+type mqttV5Client struct {
+	conn   *autopaho.ConnectionManager
+	router *paho.StandardRouter
+	open   atomic.Bool
+
+	mu            sync.Mutex
+	subscriptions map[string]byte
+}
+
+func connectMQTTv5(clientID string) (MQTTClient, error) {
+	brokerURL, err := url.Parse(cfg().MQTTBrokerURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MQTT_BROKER_URL: %w", err)
+	}
+
+	// paho.golang waits half a keep-alive period for a ping response and
+	// has no separate ping timeout.
+	keepAlive := uint16(cfg().MQTTKeepAlive / time.Second)
+
+	c := &mqttV5Client{router: paho.NewStandardRouter(), subscriptions: map[string]byte{}}
+	lost := func() { c.open.Store(false) }
+	conn, err := autopaho.NewConnection(context.Background(), autopaho.ClientConfig{
+		BrokerUrls:     []*url.URL{brokerURL},
+		KeepAlive:      keepAlive,
+		ConnectTimeout: mqttTimeout,
+		OnConnectionUp: func(*autopaho.ConnectionManager, *paho.Connack) {
+			c.open.Store(true)
+			c.resubscribe()
+		},
+		OnConnectError: func(err error) {
+			log.Println("Error connecting to the MQTT broker:", err)
+		},
+		ClientConfig: paho.ClientConfig{
+			ClientID:           clientID,
+			Router:             c.router,
+			OnClientError:      func(error) { lost() },
+			OnServerDisconnect: func(*paho.Disconnect) { lost() },
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.conn = conn
+
+	ctx, cancel := context.WithTimeout(context.Background(), mqttTimeout)
+	defer cancel()
+	if err := conn.AwaitConnection(ctx); err != nil {
+		c.Disconnect()
+		return nil, fmt.Errorf("connecting to %s: %w", brokerURL.Redacted(), err)
+	}
+	return c, nil
+}
+
+func (c *mqttV5Client) Subscribe(topic string, qos byte, handler mqttHandler) error {
+	c.router.RegisterHandler(topic, func(p *paho.Publish) {
+		msg := mqttMessage{Topic: p.Topic, Payload: p.Payload, QoS: p.QoS}
+		if p.Properties != nil && len(p.Properties.User) > 0 {
+			msg.UserProperties = make(map[string]string, len(p.Properties.User))
+			for _, property := range p.Properties.User {
+				msg.UserProperties[property.Key] = property.Value
+			}
+		}
+		handler(msg)
+	})
+
+	c.mu.Lock()
+	c.subscriptions[topic] = qos
+	c.mu.Unlock()
+	return c.subscribe(map[string]byte{topic: qos})
+}
+
+// resubscribe renews the subscriptions after a reconnect, as the session
+// does not outlive the connection.
+func (c *mqttV5Client) resubscribe() {
+	c.mu.Lock()
+	subscriptions := make(map[string]byte, len(c.subscriptions))
+	for topic, qos := range c.subscriptions {
+		subscriptions[topic] = qos
+	}
+	c.mu.Unlock()
+
+	if len(subscriptions) == 0 {
+		return
+	}
+	if err := c.subscribe(subscriptions); err != nil {
+		log.Println("Error renewing MQTT subscriptions:", err)
+	}
+}
+
+func (c *mqttV5Client) subscribe(subscriptions map[string]byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), mqttTimeout)
+	defer cancel()
+
+	options := make(map[string]paho.SubscribeOptions, len(subscriptions))
+	for topic, qos := range subscriptions {
+		options[topic] = paho.SubscribeOptions{QoS: qos}
+	}
+	_, err := c.conn.Subscribe(ctx, &paho.Subscribe{Subscriptions: options})
+	return err
+}
+
+func (c *mqttV5Client) Publish(topic string, qos byte, retained bool, payload []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+
+	_, err := c.conn.Publish(ctx, &paho.Publish{Topic: topic, QoS: qos, Retain: retained, Payload: payload})
+	return err
+}
+
+func (c *mqttV5Client) IsConnectionOpen() bool {
+	return c.open.Load()
+}
+
+func (c *mqttV5Client) Disconnect() {
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	_ = c.conn.Disconnect(ctx)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestRunResourceObserver(t *testing.T) {
+	samples := []scriptedSample{
+		{CPU: 10.123, RAM: 20.456},
+		{Err: errors.New("sampling failed")},
+		{CPU: 30, RAM: 40},
+		{CPU: 50.006, RAM: 60},
+	}
+	// The failed sample is skipped, the others are stored rounded.
+	want := []struct{ cpu, ram float64 }{{10.12, 20.46}, {30, 40}, {50.01, 60}}
+
+	tests := []struct {
+		name      string
+		metrics   []string
+		wantDisks bool
+		wantNet   bool
+	}{
+		{name: "all collectors", wantDisks: true, wantNet: true},
+		{name: "cpu and ram", metrics: []string{"cpu", "ram"}},
+		{name: "disk", metrics: []string{"cpu", "ram", "disk"}, wantDisks: true},
+		{name: "net", metrics: []string{"cpu", "ram", "net"}, wantNet: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := testConfig(t)
+			config.ObserverInterval = 20 * time.Millisecond
+			config.ObserverMaxInterval = time.Second
+			config.Metrics = tt.metrics
+			useConfig(t, config)
+
+			sampler := &scriptedSampler{samples: append([]scriptedSample(nil), samples...)}
+			stopping := make(chan struct{})
+			done := make(chan struct{})
+			go func() {
+				runResourceObserver(sampler, stopping)
+				close(done)
+			}()
+			// Once the samples are exhausted, every tick fails and stores
+			// nothing more.
+			deadline := time.Now().Add(5 * time.Second)
+			for time.Now().Before(deadline) {
+				n, err := testCollection(t).CountDocuments(context.Background(), bson.M{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if n >= int64(len(want)) {
+					break
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			close(stopping)
+			<-done
+
+			cur, err := testCollection(t).Find(context.Background(), bson.M{},
+				options.Find().SetSort(bson.D{{Key: "timestamp", Value: 1}}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var stored []Measurement
+			if err := cur.All(context.Background(), &stored); err != nil {
+				t.Fatal(err)
+			}
+			if len(stored) != len(want) {
+				t.Fatalf("stored %d measurements, want %d", len(stored), len(want))
+			}
+			for i, m := range stored {
+				if m.CPU != want[i].cpu || m.RAM != want[i].ram {
+					t.Errorf("tick %d: stored cpu %v ram %v, want cpu %v ram %v",
+						i, m.CPU, m.RAM, want[i].cpu, want[i].ram)
+				}
+				if m.Host != hostname {
+					t.Errorf("tick %d: stored host %q, want %q", i, m.Host, hostname)
+				}
+				if _, ok := m.Disks["/"]; ok != tt.wantDisks {
+					t.Errorf("tick %d: disk usage of / stored: %v, want %v", i, ok, tt.wantDisks)
+				}
+				if hasNet := m.NetBytesSent > 0 || m.NetBytesRecv > 0; hasNet != tt.wantNet {
+					t.Errorf("tick %d: network counters stored: %v, want %v", i, hasNet, tt.wantNet)
+				}
+				if i == 0 && (m.NetBytesSentRate != 0 || m.NetBytesRecvRate != 0) {
+					t.Errorf("tick 0: network rates stored without a previous sample")
+				}
+				if i > 0 && m.NetBytesSent < stored[i-1].NetBytesSent {
+					t.Errorf("tick %d: network counter went backwards", i)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ObserverState describes whether the resource observer is sampling.
+type ObserverState struct {
+	Paused bool       `json:"paused"`
+	Since  *time.Time `json:"since,omitempty"`
+}
+
+// observer is the current state. It is kept in memory only, so a restart
+// always resumes the observer. resumed is closed when a pause ends.
+var observer struct {
+	mu      sync.RWMutex
+	state   ObserverState
+	resumed chan struct{}
+}
+
+func init() {
+	newGauge("observer_paused", "Whether the resource observer is paused (1) or sampling (0).",
+		func() float64 {
+			if currentObserverState().Paused {
+				return 1
+			}
+			return 0
+		})
+}
+
+func currentObserverState() ObserverState {
+	observer.mu.RLock()
+	defer observer.mu.RUnlock()
+	return observer.state
+}
+
+// awaitObserverResume blocks while the observer is paused, or until
+// stopping is closed, and reports whether it was paused.
+func awaitObserverResume(stopping <-chan struct{}) bool {
+	observer.mu.RLock()
+	resumed := observer.resumed
+	observer.mu.RUnlock()
+	if resumed == nil {
+		return false
+	}
+	select {
+	case <-resumed:
+	case <-stopping:
+	}
+	return true
+}
+
+// @Summary Pause the resource observer
+// @Description Stops the resource observer from sampling this machine until it is resumed, e.g. during a noisy maintenance window that should not be recorded. MQTT and API ingestion carry on. The state is kept in memory and a restart resumes the observer.
+// @Tags Admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} ObserverState
+// @Failure 401 {object} ErrorResponse "Invalid API key"
+// @Failure 403 {object} ErrorResponse "Admin API disabled"
+// @Router /admin/observer/pause [post]
+func pauseObserver(c *gin.Context) {
+	observer.mu.Lock()
+	defer observer.mu.Unlock()
+	if !observer.state.Paused {
+		now := time.Now()
+		observer.state = ObserverState{Paused: true, Since: &now}
+		observer.resumed = make(chan struct{})
+		logf(c.Request.Context(), "Resource observer paused\n")
+	}
+	c.JSON(http.StatusOK, observer.state)
+}
+
+// @Summary Resume the resource observer
+// @Description Restarts the sampling of a paused resource observer; the next sample is taken one OBSERVER_INTERVAL later.
+// @Tags Admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} ObserverState
+// @Failure 401 {object} ErrorResponse "Invalid API key"
+// @Failure 403 {object} ErrorResponse "Admin API disabled"
+// @Router /admin/observer/resume [post]
+func resumeObserver(c *gin.Context) {
+	observer.mu.Lock()
+	defer observer.mu.Unlock()
+	if observer.state.Paused {
+		close(observer.resumed)
+		observer.resumed = nil
+		observer.state = ObserverState{}
+		logf(c.Request.Context(), "Resource observer resumed\n")
+	}
+	c.JSON(http.StatusOK, observer.state)
+}
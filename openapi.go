@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/getkin/kin-openapi/openapi2"
+	"github.com/getkin/kin-openapi/openapi2conv"
+	"github.com/gin-gonic/gin"
+	"monitoring.com/monitoring-app/docs"
+)
+
+// openAPISpec is the OpenAPI 3 version of the generated Swagger 2 docs,
+// converted on first use so it always matches the handler annotations.
+var openAPISpec struct {
+	once sync.Once
+	body []byte
+	err  error
+}
+
+func convertOpenAPISpec() ([]byte, error) {
+	var v2 openapi2.T
+	if err := json.Unmarshal([]byte(docs.SwaggerInfo.ReadDoc()), &v2); err != nil {
+		return nil, err
+	}
+	v3, err := openapi2conv.ToV3(&v2)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v3)
+}
+
+// getOpenAPISpec serves the API description as OpenAPI 3.0.
+func getOpenAPISpec(c *gin.Context) {
+	openAPISpec.once.Do(func() {
+		openAPISpec.body, openAPISpec.err = convertOpenAPISpec()
+	})
+	if openAPISpec.err != nil {
+		respondError(c, internalError("Failed to convert the API description to OpenAPI 3: "+openAPISpec.err.Error()))
+		return
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", openAPISpec.body)
+}
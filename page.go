@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// nextTokenHeader carries the token of the next page of a paginated
+// measurement query. It is absent on the last page.
+const nextTokenHeader = "X-Next-Token"
+
+const (
+	defaultPageSize = 1000
+	maxPageSize     = 10000
+)
+
+// errInvalidToken is returned for page tokens that were not issued by us.
+var errInvalidToken = errors.New("invalid after_token")
+
+// page describes the requested page of a measurement query. Pages are
+// ordered by _id, which grows with insertion time, so that measurements
+// written while a client pages through the results never shift the pages
+// it has yet to fetch.
+type page struct {
+	after primitive.ObjectID
+	size  int64
+}
+
+// parsePage reads the limit and after_token parameters. ok is false when
+// neither is given, in which case the query is not paginated.
+func parsePage(c *gin.Context) (p page, ok bool, err error) {
+	limit, token := c.Query("limit"), c.Query("after_token")
+	if limit == "" && token == "" {
+		return page{}, false, nil
+	}
+
+	p.size = defaultPageSize
+	if limit != "" {
+		p.size, err = strconv.ParseInt(limit, 10, 64)
+		if err != nil || p.size < 1 || p.size > maxPageSize {
+			return page{}, false, fmt.Errorf("invalid limit: expected a number between 1 and %d", maxPageSize)
+		}
+	}
+	if token != "" {
+		if p.after, err = decodePageToken(token); err != nil {
+			return page{}, false, err
+		}
+	}
+	return p, true, nil
+}
+
+// apply restricts filter to the page and returns the matching find options.
+func (p page) apply(filter bson.M) (bson.M, *options.FindOptions) {
+	if !p.after.IsZero() {
+		filter = bson.M{"$and": []bson.M{filter, {"_id": bson.M{"$gt": p.after}}}}
+	}
+	return filter, options.Find().SetSort(bson.M{"_id": 1}).SetLimit(p.size)
+}
+
+// nextToken returns the token of the page after measurements, or "" if
+// measurements is the last page.
+func (p page) nextToken(measurements []Measurement) string {
+	if int64(len(measurements)) < p.size {
+		return ""
+	}
+	return encodePageToken(measurements[len(measurements)-1].ID)
+}
+
+func encodePageToken(id primitive.ObjectID) string {
+	return base64.RawURLEncoding.EncodeToString(id[:])
+}
+
+func decodePageToken(token string) (primitive.ObjectID, error) {
+	var id primitive.ObjectID
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(raw) != len(id) {
+		return id, errInvalidToken
+	}
+	copy(id[:], raw)
+	return id, nil
+}
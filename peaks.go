@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultPeaks = 10
+	maxPeaks     = 100
+)
+
+// peakFields are the fields /measurements/peaks can rank by.
+var peakFields = map[string]bool{"cpu": true, "ram": true}
+
+// @Summary Peak measurements
+// @Description Returns the measurements with the highest CPU or RAM usage in the time range, highest first, to find when and where usage peaked
+// @Tags Measurements
+// @Produce json
+// @Param field query string true "Field to rank by" Enums(cpu, ram)
+// @Param top query int false "Number of measurements (default 10, max 100)"
+// @Param from query string false "Only measurements at or after this RFC3339 timestamp"
+// @Param to query string false "Only measurements at or before this RFC3339 timestamp"
+// @Param host query string false "Only measurements from this host"
+// @Success 200 {array} Measurement
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 503 {object} ErrorResponse "MongoDB unavailable"
+// @Router /measurements/peaks [get]
+func getPeaks(c *gin.Context) {
+	field := c.Query("field")
+	if !peakFields[field] {
+		respondError(c, validationError(errors.New("invalid field: expected cpu or ram")))
+		return
+	}
+	top := int64(defaultPeaks)
+	if raw := c.Query("top"); raw != "" {
+		var err error
+		top, err = strconv.ParseInt(raw, 10, 64)
+		if err != nil || top < 1 || top > maxPeaks {
+			respondError(c, validationError(fmt.Errorf("invalid top: expected a number between 1 and %d", maxPeaks)))
+			return
+		}
+	}
+	from, to, err := parseTimeRange(c)
+	if err == nil {
+		err = checkQueryWindow(from, to)
+	}
+	if err != nil {
+		respondError(c, validationError(err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	collection, err := getMongoCollection()
+	if err != nil {
+		respondError(c, errDBUnavailable)
+		return
+	}
+
+	filter := rangeFilter(from, to)
+	if host := c.Query("host"); host != "" {
+		filter["host"] = host
+	}
+	// Ties are broken by time so that the result is stable.
+	findOptions := options.Find().SetSort(bson.D{{Key: field, Value: -1}, {Key: "timestamp", Value: -1}}).SetLimit(top)
+	cur, err := collection.Find(ctx, notDeleted(fromSource(filter, hostSource)), findOptions)
+	if err != nil {
+		respondError(c, internalError("Failed to query measurements"))
+		return
+	}
+	defer cur.Close(ctx)
+
+	peaks := []Measurement{}
+	if err := cur.All(ctx, &peaks); err != nil {
+		respondError(c, internalError("Failed to decode measurements"))
+		return
+	}
+
+	c.JSON(http.StatusOK, responseMeasurements(peaks))
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// PrometheusResponse is the envelope of the Prometheus HTTP API.
+type PrometheusResponse struct {
+	Status    string          `json:"status"`
+	Data      *PrometheusData `json:"data,omitempty"`
+	ErrorType string          `json:"errorType,omitempty"`
+	Error     string          `json:"error,omitempty"`
+}
+
+// PrometheusData holds the result of a range query.
+type PrometheusData struct {
+	ResultType string             `json:"resultType"`
+	Result     []PrometheusSeries `json:"result"`
+}
+
+// PrometheusSeries is one series of a matrix result. Each value is a pair
+// of a Unix timestamp in seconds and the sample value as a string.
+type PrometheusSeries struct {
+	Metric map[string]string `json:"metric"`
+	Values [][2]interface{}  `json:"values"`
+}
+
+// prometheusMetrics maps the metric names of range queries to measurement
+// fields.
+var prometheusMetrics = map[string]string{"cpu": "cpu", "ram": "ram"}
+
+// maxPrometheusPoints bounds the samples per series, like Prometheus does.
+const maxPrometheusPoints = 11000
+
+var (
+	selectorPattern = regexp.MustCompile(`^\s*([a-zA-Z_:][a-zA-Z0-9_:]*)\s*(?:\{(.*)\})?\s*$`)
+	matcherPattern  = regexp.MustCompile(`^\s*([a-zA-Z_][a-zA-Z0-9_]*)\s*=\s*"([^"]*)"\s*$`)
+)
+
+// parsePrometheusSelector parses a query of the form cpu or
+// ram{host="web-1",rack="r1"} into the measurement field and a filter. The
+// host label selects the host, any other label a measurement label. Only
+// equality matchers are supported.
+func parsePrometheusSelector(query string) (name, field string, filter bson.M, err error) {
+	m := selectorPattern.FindStringSubmatch(query)
+	if m == nil {
+		return "", "", nil, fmt.Errorf("unsupported query %q: expected cpu or ram with optional label matchers", query)
+	}
+	name = m[1]
+	field, ok := prometheusMetrics[name]
+	if !ok {
+		return "", "", nil, fmt.Errorf("unknown metric %q: expected cpu or ram", name)
+	}
+
+	filter = bson.M{}
+	if strings.TrimSpace(m[2]) == "" {
+		return name, field, filter, nil
+	}
+	for _, matcher := range strings.Split(m[2], ",") {
+		lm := matcherPattern.FindStringSubmatch(matcher)
+		if lm == nil {
+			return "", "", nil, fmt.Errorf("unsupported matcher %q: only label=\"value\" is supported", strings.TrimSpace(matcher))
+		}
+		if lm[1] == "host" {
+			filter["host"] = lm[2]
+		} else {
+			filter["labels."+lm[1]] = lm[2]
+		}
+	}
+	return name, field, filter, nil
+}
+
+// parsePrometheusTime accepts a Unix timestamp in seconds or an RFC3339
+// timestamp, as Prometheus does.
+func parsePrometheusTime(param, raw string) (time.Time, error) {
+	if seconds, err := strconv.ParseFloat(raw, 64); err == nil {
+		sec, frac := math.Modf(seconds)
+		return time.Unix(int64(sec), int64(frac*1e9)), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, raw)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s: expected a Unix or RFC3339 timestamp", param)
+	}
+	return t, nil
+}
+
+// parsePrometheusStep accepts a number of seconds or a duration such as 30s.
+func parsePrometheusStep(raw string) (time.Duration, error) {
+	step, err := time.ParseDuration(raw)
+	if seconds, ferr := strconv.ParseFloat(raw, 64); ferr == nil {
+		step, err = time.Duration(seconds*float64(time.Second)), nil
+	}
+	if err != nil || step <= 0 {
+		return 0, errors.New("invalid step: expected a positive duration or number of seconds")
+	}
+	return step, nil
+}
+
+func prometheusError(c *gin.Context, status int, errorType string, err error) {
+	c.JSON(status, PrometheusResponse{Status: "error", ErrorType: errorType, Error: err.Error()})
+}
+
+// @Summary Prometheus range query
+// @Description Answers basic Prometheus query_range requests so that Grafana's Prometheus data source can chart the data. The query is cpu or ram with optional label="value" matchers, where the host label selects the host. Samples are averaged per host over each step.
+// @Tags Interop
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param query query string true "cpu or ram, e.g. cpu{host=\"web-1\"}"
+// @Param start query string true "Unix or RFC3339 start timestamp"
+// @Param end query string true "Unix or RFC3339 end timestamp"
+// @Param step query string true "Resolution as a duration or number of seconds"
+// @Success 200 {object} PrometheusResponse
+// @Failure 400 {object} PrometheusResponse
+// @Failure 503 {object} PrometheusResponse
+// @Router /api/v1/query_range [get]
+// @Router /api/v1/query_range [post]
+func prometheusQueryRange(c *gin.Context) {
+	name, field, filter, err := parsePrometheusSelector(c.Request.FormValue("query"))
+	var start, end time.Time
+	var step time.Duration
+	if err == nil {
+		start, err = parsePrometheusTime("start", c.Request.FormValue("start"))
+	}
+	if err == nil {
+		end, err = parsePrometheusTime("end", c.Request.FormValue("end"))
+	}
+	if err == nil {
+		step, err = parsePrometheusStep(c.Request.FormValue("step"))
+	}
+	if err == nil && end.Before(start) {
+		err = errors.New("end must not be before start")
+	}
+	if err == nil && end.Sub(start)/step >= maxPrometheusPoints {
+		err = fmt.Errorf("exceeded maximum resolution of %d points per series", maxPrometheusPoints)
+	}
+	if err == nil {
+		err = checkQueryWindow(start, end)
+	}
+	if err != nil {
+		prometheusError(c, http.StatusBadRequest, "bad_data", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	collection, err := getMongoCollection()
+	if err != nil {
+		prometheusError(c, http.StatusServiceUnavailable, "unavailable", errors.New("Failed to connect to MongoDB"))
+		return
+	}
+
+	points, err := stepAverages(ctx, collection, field, filter, start, end, step)
+	if err != nil {
+		prometheusError(c, http.StatusInternalServerError, "internal", err)
+		return
+	}
+
+	result := []PrometheusSeries{}
+	for _, point := range points {
+		if len(result) == 0 || result[len(result)-1].Metric["host"] != point.Host {
+			result = append(result, PrometheusSeries{
+				Metric: map[string]string{"__name__": name, "host": point.Host},
+			})
+		}
+		series := &result[len(result)-1]
+		series.Values = append(series.Values, [2]interface{}{
+			float64(point.At.UnixMilli()) / 1000,
+			strconv.FormatFloat(roundPercent(point.Value), 'f', -1, 64),
+		})
+	}
+
+	c.JSON(http.StatusOK, PrometheusResponse{
+		Status: "success",
+		Data:   &PrometheusData{ResultType: "matrix", Result: result},
+	})
+}
+
+// stepAverage is the average of a field over the measurements of a host in
+// the step starting at At.
+type stepAverage struct {
+	Host  string
+	At    time.Time
+	Value float64
+}
+
+// stepAverages averages field per host over each step from start to end
+// for the measurements matching filter, ordered by host and time. Steps
+// without measurements are left out. Grafana's Prometheus and SimpleJSON
+// data sources are both served from it.
+func stepAverages(ctx context.Context, collection *mongo.Collection, field string, filter bson.M,
+	start, end time.Time, step time.Duration) ([]stepAverage, error) {
+	filter["timestamp"] = bson.M{"$gte": start, "$lte": end}
+	bucket := bson.M{"$floor": bson.M{"$divide": bson.A{
+		bson.M{"$subtract": bson.A{"$timestamp", start}},
+		step.Milliseconds(),
+	}}}
+	pipeline := []bson.M{
+		{"$match": notDeleted(fromSource(filter, hostSource))},
+		{"$group": bson.M{
+			"_id":   bson.M{"host": bson.M{"$ifNull": bson.A{"$host", ""}}, "bucket": bucket},
+			"value": bson.M{"$avg": "$" + field},
+		}},
+		{"$sort": bson.D{{Key: "_id.host", Value: 1}, {Key: "_id.bucket", Value: 1}}},
+	}
+	cur, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, errors.New("Failed to query measurements")
+	}
+	defer cur.Close(ctx)
+
+	var points []struct {
+		ID struct {
+			Host   string  `bson:"host"`
+			Bucket float64 `bson:"bucket"`
+		} `bson:"_id"`
+		Value float64 `bson:"value"`
+	}
+	if err := cur.All(ctx, &points); err != nil {
+		return nil, errors.New("Failed to decode measurements")
+	}
+
+	averages := make([]stepAverage, len(points))
+	for i, point := range points {
+		averages[i] = stepAverage{point.ID.Host, start.Add(time.Duration(point.ID.Bucket) * step), point.Value}
+	}
+	return averages, nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// mimeProtobuf is the content type of measurements encoded as the messages
+// of proto/measurement.proto.
+const mimeProtobuf = "application/x-protobuf"
+
+// wantsProtobuf reports whether the Accept header prefers protobuf to JSON,
+// which stays the default.
+func wantsProtobuf(c *gin.Context) bool {
+	return c.NegotiateFormat(gin.MIMEJSON, mimeProtobuf) == mimeProtobuf
+}
+
+// respondMeasurement writes m as a Measurement message or as JSON.
+func respondMeasurement(c *gin.Context, m Measurement) {
+	if !wantsProtobuf(c) {
+		c.JSON(http.StatusOK, responseMeasurement(m))
+		return
+	}
+	c.Data(http.StatusOK, mimeProtobuf, appendMeasurement(nil, m))
+}
+
+// respondMeasurements writes measurements as a MeasurementList message or as
+// JSON.
+func respondMeasurements(c *gin.Context, measurements []Measurement) {
+	if !wantsProtobuf(c) {
+		c.JSON(http.StatusOK, responseMeasurements(measurements))
+		return
+	}
+	var b []byte
+	for _, m := range measurements {
+		b = appendMessage(b, 1, appendMeasurement(nil, m))
+	}
+	c.Data(http.StatusOK, mimeProtobuf, b)
+}
+
+// appendMeasurement encodes m as a Measurement message, with its
+// percentages rounded as in JSON. Fields holding their zero value are
+// omitted, as proto3 does.
+func appendMeasurement(b []byte, m Measurement) []byte {
+	m = m.roundedPercents()
+	if !m.ID.IsZero() {
+		b = appendString(b, 1, m.ID.Hex())
+	}
+	b = appendMessage(b, 2, appendTimestamp(nil, m.Timestamp))
+	b = appendString(b, 3, m.Host)
+	b = appendDouble(b, 4, m.CPU)
+	b = appendDouble(b, 5, m.RAM)
+	b = appendDoubleMap(b, 6, m.Disks)
+	labels := labelNames(m.Labels)
+	sort.Strings(labels)
+	for _, name := range labels {
+		entry := appendString(appendString(nil, 1, name), 2, m.Labels[name])
+		b = appendMessage(b, 7, entry)
+	}
+	b = appendDoubleMap(b, 8, m.Metrics)
+	b = appendVarint(b, 9, m.NetBytesSent)
+	b = appendVarint(b, 10, m.NetBytesRecv)
+	b = appendDouble(b, 11, m.NetBytesSentRate)
+	b = appendDouble(b, 12, m.NetBytesRecvRate)
+	b = appendVarint(b, 13, uint64(m.Samples))
+	if m.DeletedAt != nil {
+		b = appendMessage(b, 14, appendTimestamp(nil, *m.DeletedAt))
+	}
+	return b
+}
+
+// appendTimestamp encodes t as a google.protobuf.Timestamp.
+func appendTimestamp(b []byte, t time.Time) []byte {
+	b = appendVarint(b, 1, uint64(t.Unix()))
+	return appendVarint(b, 2, uint64(t.Nanosecond()))
+}
+
+func appendMessage(b []byte, num protowire.Number, message []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, message)
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendDouble(b []byte, num protowire.Number, v float64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, math.Float64bits(v))
+}
+
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+// appendDoubleMap encodes a map<string, double> field, one entry message
+// per key.
+func appendDoubleMap(b []byte, num protowire.Number, values map[string]float64) []byte {
+	names := metricNames(values)
+	sort.Strings(names)
+	for _, name := range names {
+		entry := appendDouble(appendString(nil, 1, name), 2, values[name])
+		b = appendMessage(b, num, entry)
+	}
+	return b
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	_ "google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// measurementProto is proto/measurement.proto as a FileDescriptorProto, so
+// that the hand-written encoder can be checked with the library decoder.
+const measurementProto = `
+name: "measurement.proto"
+package: "monitoring"
+dependency: "google/protobuf/timestamp.proto"
+syntax: "proto3"
+message_type {
+  name: "Measurement"
+  field { name: "id" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING json_name: "id" }
+  field { name: "timestamp" number: 2 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".google.protobuf.Timestamp" json_name: "timestamp" }
+  field { name: "host" number: 3 label: LABEL_OPTIONAL type: TYPE_STRING json_name: "host" }
+  field { name: "cpu" number: 4 label: LABEL_OPTIONAL type: TYPE_DOUBLE json_name: "cpu" }
+  field { name: "ram" number: 5 label: LABEL_OPTIONAL type: TYPE_DOUBLE json_name: "ram" }
+  field { name: "disks" number: 6 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".monitoring.Measurement.DisksEntry" json_name: "disks" }
+  field { name: "labels" number: 7 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".monitoring.Measurement.LabelsEntry" json_name: "labels" }
+  field { name: "metrics" number: 8 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".monitoring.Measurement.MetricsEntry" json_name: "metrics" }
+  field { name: "net_bytes_sent" number: 9 label: LABEL_OPTIONAL type: TYPE_UINT64 json_name: "netBytesSent" }
+  field { name: "net_bytes_recv" number: 10 label: LABEL_OPTIONAL type: TYPE_UINT64 json_name: "netBytesRecv" }
+  field { name: "net_bytes_sent_rate" number: 11 label: LABEL_OPTIONAL type: TYPE_DOUBLE json_name: "netBytesSentRate" }
+  field { name: "net_bytes_recv_rate" number: 12 label: LABEL_OPTIONAL type: TYPE_DOUBLE json_name: "netBytesRecvRate" }
+  field { name: "samples" number: 13 label: LABEL_OPTIONAL type: TYPE_INT64 json_name: "samples" }
+  field { name: "deleted_at" number: 14 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".google.protobuf.Timestamp" json_name: "deletedAt" }
+  nested_type {
+    name: "DisksEntry"
+    field { name: "key" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING json_name: "key" }
+    field { name: "value" number: 2 label: LABEL_OPTIONAL type: TYPE_DOUBLE json_name: "value" }
+    options { map_entry: true }
+  }
+  nested_type {
+    name: "LabelsEntry"
+    field { name: "key" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING json_name: "key" }
+    field { name: "value" number: 2 label: LABEL_OPTIONAL type: TYPE_STRING json_name: "value" }
+    options { map_entry: true }
+  }
+  nested_type {
+    name: "MetricsEntry"
+    field { name: "key" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING json_name: "key" }
+    field { name: "value" number: 2 label: LABEL_OPTIONAL type: TYPE_DOUBLE json_name: "value" }
+    options { map_entry: true }
+  }
+}
+message_type {
+  name: "MeasurementList"
+  field { name: "measurements" number: 1 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".monitoring.Measurement" json_name: "measurements" }
+}
+`
+
+// measurementDescriptors returns the Measurement and MeasurementList
+// message descriptors.
+func measurementDescriptors(t *testing.T) (protoreflect.MessageDescriptor, protoreflect.MessageDescriptor) {
+	t.Helper()
+	var fdp descriptorpb.FileDescriptorProto
+	if err := prototext.Unmarshal([]byte(measurementProto), &fdp); err != nil {
+		t.Fatal(err)
+	}
+	file, err := protodesc.NewFile(&fdp, protoregistry.GlobalFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file.Messages().ByName("Measurement"), file.Messages().ByName("MeasurementList")
+}
+
+// decodeMeasurement decodes b as a Measurement message with the library
+// decoder, which rejects fields of the wrong wire type. Fields the spec
+// does not define fail the test.
+func decodeMeasurement(t *testing.T, desc protoreflect.MessageDescriptor, b []byte) protoreflect.Message {
+	t.Helper()
+	msg := dynamicpb.NewMessage(desc)
+	if err := proto.Unmarshal(b, msg); err != nil {
+		t.Fatal(err)
+	}
+	if unknown := msg.GetUnknown(); len(unknown) > 0 {
+		t.Fatalf("fields unknown to proto/measurement.proto: %x", unknown)
+	}
+	return msg
+}
+
+func timestampOf(msg protoreflect.Message) time.Time {
+	desc := msg.Descriptor().Fields()
+	return time.Unix(msg.Get(desc.ByName("seconds")).Int(), msg.Get(desc.ByName("nanos")).Int()).UTC()
+}
+
+func TestAppendMeasurement(t *testing.T) {
+	measurementDesc, _ := measurementDescriptors(t)
+	fields := measurementDesc.Fields()
+	field := func(msg protoreflect.Message, name protoreflect.Name) protoreflect.Value {
+		return msg.Get(fields.ByName(name))
+	}
+
+	deletedAt := time.Date(2026, 2, 3, 4, 5, 6, 0, time.UTC)
+	full := Measurement{
+		ID:               primitive.NewObjectID(),
+		Timestamp:        time.Date(2026, 1, 2, 3, 4, 5, 123456789, time.UTC),
+		Host:             "web-1",
+		CPU:              12.345,
+		RAM:              40,
+		Disks:            map[string]float64{"/": 50.555, "/data": 75},
+		Labels:           map[string]string{"rack": "r1", "zone": "a"},
+		Metrics:          map[string]float64{"temperature": 21.5, "fan": -3},
+		NetBytesSent:     math.MaxUint64,
+		NetBytesRecv:     1 << 40,
+		NetBytesSentRate: 1024.5,
+		NetBytesRecvRate: 0.25,
+		Samples:          60,
+		DeletedAt:        &deletedAt,
+	}
+
+	tests := []struct {
+		name string
+		m    Measurement
+	}{
+		{"every field", full},
+		{"zero values", Measurement{}},
+		{"timestamp before 1970", Measurement{Timestamp: time.Date(1969, 12, 31, 23, 59, 59, 500, time.UTC)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := decodeMeasurement(t, measurementDesc, appendMeasurement(nil, tt.m))
+			want := tt.m.roundedPercents()
+
+			wantID := ""
+			if !want.ID.IsZero() {
+				wantID = want.ID.Hex()
+			}
+			if got := field(msg, "id").String(); got != wantID {
+				t.Errorf("id = %q, want %q", got, wantID)
+			}
+			if got := timestampOf(field(msg, "timestamp").Message()); !got.Equal(want.Timestamp) {
+				t.Errorf("timestamp = %s, want %s", got, want.Timestamp)
+			}
+			if got := field(msg, "host").String(); got != want.Host {
+				t.Errorf("host = %q, want %q", got, want.Host)
+			}
+			for name, value := range map[protoreflect.Name]float64{
+				"cpu": want.CPU, "ram": want.RAM,
+				"net_bytes_sent_rate": want.NetBytesSentRate, "net_bytes_recv_rate": want.NetBytesRecvRate,
+			} {
+				if got := field(msg, name).Float(); got != value {
+					t.Errorf("%s = %v, want %v", name, got, value)
+				}
+			}
+			for name, value := range map[protoreflect.Name]uint64{
+				"net_bytes_sent": want.NetBytesSent, "net_bytes_recv": want.NetBytesRecv,
+			} {
+				if got := field(msg, name).Uint(); got != value {
+					t.Errorf("%s = %v, want %v", name, got, value)
+				}
+			}
+			if got := field(msg, "samples").Int(); got != int64(want.Samples) {
+				t.Errorf("samples = %d, want %d", got, want.Samples)
+			}
+
+			for name, values := range map[protoreflect.Name]map[string]float64{"disks": want.Disks, "metrics": want.Metrics} {
+				entries := field(msg, name).Map()
+				if entries.Len() != len(values) {
+					t.Errorf("%s has %d entries, want %d", name, entries.Len(), len(values))
+				}
+				for key, value := range values {
+					if got := entries.Get(protoreflect.ValueOfString(key).MapKey()); !got.IsValid() || got.Float() != value {
+						t.Errorf("%s[%s] = %v, want %v", name, key, got, value)
+					}
+				}
+			}
+			labels := field(msg, "labels").Map()
+			if labels.Len() != len(want.Labels) {
+				t.Errorf("labels has %d entries, want %d", labels.Len(), len(want.Labels))
+			}
+			for key, value := range want.Labels {
+				if got := labels.Get(protoreflect.ValueOfString(key).MapKey()); !got.IsValid() || got.String() != value {
+					t.Errorf("labels[%s] = %v, want %q", key, got, value)
+				}
+			}
+
+			hasDeletedAt := msg.Has(fields.ByName("deleted_at"))
+			if hasDeletedAt != (want.DeletedAt != nil) {
+				t.Errorf("deleted_at set: %v, want %v", hasDeletedAt, want.DeletedAt != nil)
+			}
+			if hasDeletedAt {
+				if got := timestampOf(field(msg, "deleted_at").Message()); !got.Equal(*want.DeletedAt) {
+					t.Errorf("deleted_at = %s, want %s", got, *want.DeletedAt)
+				}
+			}
+		})
+	}
+}
+
+func TestAppendMeasurementList(t *testing.T) {
+	measurementDesc, listDesc := measurementDescriptors(t)
+	hosts := []string{"web-1", "web-2", "web-3"}
+	var b []byte
+	for _, host := range hosts {
+		b = appendMessage(b, 1, appendMeasurement(nil, Measurement{Host: host, CPU: 1}))
+	}
+
+	list := dynamicpb.NewMessage(listDesc)
+	if err := proto.Unmarshal(b, list); err != nil {
+		t.Fatal(err)
+	}
+	measurements := list.Get(listDesc.Fields().ByName("measurements")).List()
+	if measurements.Len() != len(hosts) {
+		t.Fatalf("decoded %d measurements, want %d", measurements.Len(), len(hosts))
+	}
+	for i, host := range hosts {
+		got := measurements.Get(i).Message().Get(measurementDesc.Fields().ByName("host")).String()
+		if got != host {
+			t.Errorf("measurement %d: host = %q, want %q", i, got, host)
+		}
+	}
+}
+
+// The encoding is deterministic, as the spec promises sorted map keys.
+func TestAppendMeasurementSortsMaps(t *testing.T) {
+	m := Measurement{
+		Labels:  map[string]string{"c": "3", "a": "1", "b": "2"},
+		Metrics: map[string]float64{"z": 1, "y": 2, "x": 3},
+	}
+	first := appendMeasurement(nil, m)
+	for i := 0; i < 20; i++ {
+		if got := appendMeasurement(nil, m); string(got) != string(first) {
+			t.Fatalf("encoding %d differs: %x, want %x", i, got, first)
+		}
+	}
+}
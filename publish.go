@@ -0,0 +1,36 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// publishTimeout bounds how long a publish may take before it is reported
+// as failed.
+const publishTimeout = 10 * time.Second
+
+// publishMeasurement publishes an observer measurement to
+// MQTT_PUBLISH_TOPIC, if set, with the configured QoS and retained flag.
+// The publish completes in the background so that a slow broker never
+// delays sampling.
+func publishMeasurement(measurement Measurement) {
+	topic := cfg().MQTTPublishTopic
+	client := currentMQTTClient()
+	if topic == "" || client == nil {
+		return
+	}
+
+	payload, err := json.Marshal(measurement)
+	if err != nil {
+		log.Println("Error encoding measurement for publishing:", err)
+		return
+	}
+
+	qos, retained := byte(cfg().MQTTPublishQoS), cfg().MQTTRetainMetrics
+	go func() {
+		if err := client.Publish(topic, qos, retained, payload); err != nil {
+			log.Println("Error publishing measurement:", err)
+		}
+	}()
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// parseTimeRange reads the optional "from" and "to" query parameters, both
+// given in RFC3339 format with optional fractional seconds, e.g.
+// 2024-05-01T10:00:00.250Z. Unset bounds are returned as the zero time.
+func parseTimeRange(c *gin.Context) (from, to time.Time, err error) {
+	if value := c.Query("from"); value != "" {
+		if from, err = time.Parse(time.RFC3339Nano, value); err != nil {
+			return from, to, fmt.Errorf("invalid from: expected RFC3339 timestamp")
+		}
+	}
+	if value := c.Query("to"); value != "" {
+		if to, err = time.Parse(time.RFC3339Nano, value); err != nil {
+			return from, to, fmt.Errorf("invalid to: expected RFC3339 timestamp")
+		}
+	}
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		return from, to, fmt.Errorf("invalid range: to is before from")
+	}
+	return from, to, nil
+}
+
+// rangeFilter builds a filter on the timestamp field from the given bounds,
+// ignoring zero values. Both bounds are inclusive. MongoDB stores
+// timestamps in milliseconds, truncating any finer part, so from is rounded
+// up to the next millisecond: the driver would otherwise truncate it and
+// match samples taken before it. Truncating to is already exact.
+func rangeFilter(from, to time.Time) bson.M {
+	rng := bson.M{}
+	if !from.IsZero() {
+		if rounded := from.Truncate(time.Millisecond); rounded.Before(from) {
+			from = rounded.Add(time.Millisecond)
+		}
+		rng["$gte"] = from
+	}
+	if !to.IsZero() {
+		rng["$lte"] = to.Truncate(time.Millisecond)
+	}
+
+	if len(rng) == 0 {
+		return bson.M{}
+	}
+	return bson.M{"timestamp": rng}
+}
+
+// timeRangeFilter builds a filter on the timestamp field from the optional
+// "from" and "to" query parameters. An empty filter is returned when neither
+// parameter is set.
+func timeRangeFilter(c *gin.Context) (bson.M, error) {
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		return nil, err
+	}
+	return rangeFilter(from, to), nil
+}
+
+// checkQueryWindow rejects ranges wider than the MaxQueryWindow setting,
+// which protects MongoDB from huge scans; zero disables the check. A range
+// without a lower bound is unbounded and therefore rejected; an open upper
+// bound counts as now.
+func checkQueryWindow(from, to time.Time) error {
+	maxQueryWindow := cfg().MaxQueryWindow
+	if maxQueryWindow <= 0 {
+		return nil
+	}
+	if from.IsZero() {
+		return fmt.Errorf("from is required with a maximum query window of %s", maxQueryWindow)
+	}
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if to.Sub(from) > maxQueryWindow {
+		return fmt.Errorf("time range exceeds the maximum query window of %s; "+
+			"narrow the range or use an aggregated endpoint instead", maxQueryWindow)
+	}
+	return nil
+}
+
+// thresholdParams maps the numeric threshold query parameters to the
+// measurement field and comparison operator they filter on.
+var thresholdParams = []struct {
+	param, field, op string
+}{
+	{"cpu_gt", "cpu", "$gt"},
+	{"cpu_lt", "cpu", "$lt"},
+	{"ram_gt", "ram", "$gt"},
+	{"ram_lt", "ram", "$lt"},
+}
+
+// labelParamPrefix prefixes label filters, e.g. ?label.rack=r1.
+const labelParamPrefix = "label."
+
+// metricParamPrefix prefixes additional metrics given as parameters, e.g.
+// ?metric.temperature=21.5 on /ingest.
+const metricParamPrefix = "metric."
+
+// isValidMetricName reports whether name can be used as the key of a
+// metric; MongoDB would interpret dots and a leading $ as paths and
+// operators.
+func isValidMetricName(name string) bool {
+	return name != "" && !strings.HasPrefix(name, "$") && !strings.Contains(name, ".")
+}
+
+// measurementFilter builds the MongoDB filter for a measurement query. The
+// filterable parameters are the from/to time range, host, the cpu_gt,
+// cpu_lt, ram_gt and ram_lt thresholds, the metric named by metric with the
+// metric_gt and metric_lt thresholds, and label.<name> equality. The
+// conditions are combined with AND unless match=any is given, which
+// combines them with OR instead. Soft-deleted measurements are excluded
+// unless include_deleted=true is given, and the measurements of this
+// process unless source=self is given, which selects only those.
+func measurementFilter(c *gin.Context) (bson.M, error) {
+	filter, err := measurementConditions(c)
+	if err != nil {
+		return nil, err
+	}
+	source, err := querySource(c)
+	if err != nil {
+		return nil, err
+	}
+	filter = fromSource(filter, source)
+	if !includeDeleted(c) {
+		filter = notDeleted(filter)
+	}
+	return filter, nil
+}
+
+// measurementConditions builds the filter of measurementFilter from the
+// query parameters alone. It is empty when no filter parameter is given.
+func measurementConditions(c *gin.Context) (bson.M, error) {
+	match := c.DefaultQuery("match", "all")
+	if match != "all" && match != "any" {
+		return nil, fmt.Errorf("invalid match: expected all or any")
+	}
+
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkQueryWindow(from, to); err != nil {
+		return nil, err
+	}
+
+	var clauses []bson.M
+	if timeRange := rangeFilter(from, to); len(timeRange) > 0 {
+		clauses = append(clauses, timeRange)
+	}
+	if host := c.Query("host"); host != "" {
+		clauses = append(clauses, bson.M{"host": host})
+	}
+
+	bounds := map[string]float64{}
+	for _, t := range thresholdParams {
+		value := c.Query(t.param)
+		if value == "" {
+			continue
+		}
+		threshold, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: expected a number", t.param)
+		}
+		bounds[t.param] = threshold
+		clauses = append(clauses, bson.M{t.field: bson.M{t.op: threshold}})
+	}
+
+	if name := c.Query("metric"); name != "" {
+		if !isValidMetricName(name) {
+			return nil, fmt.Errorf("invalid metric: %q is not a valid metric name", name)
+		}
+		field := "metrics." + name
+		condition := bson.M{}
+		for _, t := range []struct{ param, op string }{{"metric_gt", "$gt"}, {"metric_lt", "$lt"}} {
+			value := c.Query(t.param)
+			if value == "" {
+				continue
+			}
+			threshold, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: expected a number", t.param)
+			}
+			bounds[t.param] = threshold
+			condition[t.op] = threshold
+		}
+		// Without a threshold the filter matches measurements having the metric.
+		if len(condition) == 0 {
+			condition["$exists"] = true
+		}
+		clauses = append(clauses, bson.M{field: condition})
+	} else if c.Query("metric_gt") != "" || c.Query("metric_lt") != "" {
+		return nil, fmt.Errorf("metric_gt and metric_lt require metric")
+	}
+
+	var labelKeys []string
+	for key := range c.Request.URL.Query() {
+		if strings.HasPrefix(key, labelParamPrefix) {
+			labelKeys = append(labelKeys, key)
+		}
+	}
+	sort.Strings(labelKeys)
+	for _, key := range labelKeys {
+		name := strings.TrimPrefix(key, labelParamPrefix)
+		if name == "" {
+			return nil, fmt.Errorf("invalid label filter: missing label name")
+		}
+		clauses = append(clauses, bson.M{"labels." + name: c.Query(key)})
+	}
+
+	if match == "all" {
+		for _, field := range []string{"cpu", "ram", "metric"} {
+			gt, hasGt := bounds[field+"_gt"]
+			lt, hasLt := bounds[field+"_lt"]
+			if hasGt && hasLt && gt >= lt {
+				return nil, fmt.Errorf("%s_gt must be less than %s_lt when match=all", field, field)
+			}
+		}
+	} else if cfg().MaxQueryWindow > 0 && (!from.IsZero() || !to.IsZero()) && len(clauses) > 1 {
+		return nil, fmt.Errorf("a time range cannot be combined with other filters " +
+			"when match=any because it would no longer bound the query")
+	}
+
+	switch {
+	case len(clauses) == 0:
+		return bson.M{}, nil
+	case len(clauses) == 1:
+		return clauses[0], nil
+	case match == "any":
+		return bson.M{"$or": clauses}, nil
+	default:
+		return bson.M{"$and": clauses}, nil
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// queryContext returns a context for a GET request with the query params.
+func queryContext(params url.Values) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/measurements?"+params.Encode(), nil)
+	return c
+}
+
+func TestTimeRangeFilterSubSecond(t *testing.T) {
+	base := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	// Stored timestamps have millisecond precision.
+	stored := []time.Duration{0, 249 * time.Millisecond, 250 * time.Millisecond, 251 * time.Millisecond, time.Second}
+
+	tests := []struct {
+		name     string
+		from, to string
+		want     []time.Duration
+		wantErr  bool
+	}{
+		{name: "whole seconds", from: "2026-01-02T03:04:05Z", to: "2026-01-02T03:04:06Z", want: stored},
+		{name: "inclusive millisecond bounds", from: "2026-01-02T03:04:05.249Z", to: "2026-01-02T03:04:05.251Z",
+			want: []time.Duration{249 * time.Millisecond, 250 * time.Millisecond, 251 * time.Millisecond}},
+		{name: "single millisecond", from: "2026-01-02T03:04:05.250Z", to: "2026-01-02T03:04:05.250Z",
+			want: []time.Duration{250 * time.Millisecond}},
+		{name: "from within a millisecond", from: "2026-01-02T03:04:05.2490001Z", to: "2026-01-02T03:04:06Z",
+			want: []time.Duration{250 * time.Millisecond, 251 * time.Millisecond, time.Second}},
+		{name: "to within a millisecond", from: "2026-01-02T03:04:05Z", to: "2026-01-02T03:04:05.250999999Z",
+			want: []time.Duration{0, 249 * time.Millisecond, 250 * time.Millisecond}},
+		{name: "offset", from: "2026-01-02T04:04:05.25+01:00", want: []time.Duration{250 * time.Millisecond, 251 * time.Millisecond, time.Second}},
+		{name: "to before from", from: "2026-01-02T03:04:05.251Z", to: "2026-01-02T03:04:05.25Z", wantErr: true},
+		{name: "not RFC3339", from: "2026-01-02 03:04:05", wantErr: true},
+	}
+
+	testConfig(t)
+	collection := testCollection(t)
+	for _, offset := range stored {
+		if _, err := collection.InsertOne(context.Background(), Measurement{Timestamp: base.Add(offset)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := url.Values{}
+			if tt.from != "" {
+				params.Set("from", tt.from)
+			}
+			if tt.to != "" {
+				params.Set("to", tt.to)
+			}
+			filter, err := timeRangeFilter(queryContext(params))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error: %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			cur, err := collection.Find(context.Background(), filter,
+				options.Find().SetSort(bson.D{{Key: "timestamp", Value: 1}}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var found []Measurement
+			if err := cur.All(context.Background(), &found); err != nil {
+				t.Fatal(err)
+			}
+			var got []time.Duration
+			for _, m := range found {
+				got = append(got, m.Timestamp.Sub(base))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("matched %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRangeFilter(t *testing.T) {
+	at := time.Date(2026, 1, 2, 3, 4, 5, 250_000_000, time.UTC)
+	tests := []struct {
+		name     string
+		from, to time.Time
+		want     bson.M
+	}{
+		{name: "unbounded", want: bson.M{}},
+		{name: "exact milliseconds", from: at, to: at,
+			want: bson.M{"timestamp": bson.M{"$gte": at, "$lte": at}}},
+		{name: "from rounded up", from: at.Add(time.Nanosecond),
+			want: bson.M{"timestamp": bson.M{"$gte": at.Add(time.Millisecond)}}},
+		{name: "to truncated", to: at.Add(time.Millisecond - time.Nanosecond),
+			want: bson.M{"timestamp": bson.M{"$lte": at}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rangeFilter(tt.from, tt.to); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rangeFilter = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
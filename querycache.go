@@ -0,0 +1,258 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxQueryCacheEntries bounds the number of cached responses; once
+	// reached, new responses are only cached after others expired.
+	maxQueryCacheEntries = 1000
+	// maxQueryCacheBody is the largest response that is cached.
+	maxQueryCacheBody = 1 << 20
+	// maxQueryCacheWrites is how many inserts are remembered for requests
+	// still running; a request that saw more is not cached.
+	maxQueryCacheWrites = 256
+)
+
+var (
+	queryCacheHits   = newCounter("query_cache_hits_total", "Number of responses served from the query cache.")
+	queryCacheMisses = newCounter("query_cache_misses_total", "Number of cacheable requests not found in the query cache.")
+)
+
+// cachedResponse is a response kept by the query cache.
+type cachedResponse struct {
+	// header holds the headers set by the handler, such as Content-Type
+	// and X-Next-Token.
+	header     http.Header
+	body       []byte
+	scope      cacheScope
+	generation uint64
+	expires    time.Time
+}
+
+// cacheScope is the part of the measurements a cached response was computed
+// from: those of host, if set, taken between from and to. Zero bounds are
+// open.
+type cacheScope struct {
+	host     string
+	from, to time.Time
+}
+
+// requestScope returns the scope of a request from its host, from and to
+// parameters. Endpoints with other filters only ever read less.
+func requestScope(c *gin.Context) cacheScope {
+	from, to, _ := parseTimeRange(c)
+	return cacheScope{c.Query("host"), from, to}
+}
+
+// covers reports whether storing m may change a response of scope s. A
+// measurement without timestamp may belong anywhere. Timestamps are
+// compared as stored, in milliseconds.
+func (s cacheScope) covers(m Measurement) bool {
+	if s.host != "" && s.host != m.Host {
+		return false
+	}
+	ts := m.Timestamp.Truncate(time.Millisecond)
+	return ts.IsZero() ||
+		(s.from.IsZero() || !ts.Before(s.from)) && (s.to.IsZero() || !ts.After(s.to))
+}
+
+// queryCache holds the responses of the QUERY_CACHE_ENDPOINTS. An insert
+// drops the entries whose scope covers the measurement, so that polling a
+// past range or another host keeps hitting the cache under a steady stream
+// of writes. Any other write starts a new generation, which makes every
+// older entry stale. Either way a response never outlives the data it was
+// computed from.
+var queryCache struct {
+	mu         sync.Mutex
+	entries    map[string]cachedResponse
+	generation atomic.Uint64
+	// writes holds the latest inserts, the one numbered n at
+	// (n-1) % maxQueryCacheWrites, for the requests running meanwhile.
+	writes [maxQueryCacheWrites]Measurement
+	seq    uint64
+}
+
+// invalidateQueryCache marks every cached response stale. It is called on
+// writes that may change any measurement, such as updates and compaction.
+func invalidateQueryCache() {
+	queryCache.generation.Add(1)
+}
+
+// invalidateQueryCacheFor drops the cached responses that the insert of m
+// may change.
+func invalidateQueryCacheFor(m Measurement) {
+	queryCache.mu.Lock()
+	defer queryCache.mu.Unlock()
+	queryCache.writes[queryCache.seq%maxQueryCacheWrites] = m
+	queryCache.seq++
+	for key, entry := range queryCache.entries {
+		if entry.scope.covers(m) {
+			delete(queryCache.entries, key)
+		}
+	}
+}
+
+// writeSeq returns the number of inserts so far.
+func writeSeq() uint64 {
+	queryCache.mu.Lock()
+	defer queryCache.mu.Unlock()
+	return queryCache.seq
+}
+
+// lookupQueryCache returns the fresh response cached under key, if any.
+func lookupQueryCache(key string, now time.Time) (cachedResponse, bool) {
+	queryCache.mu.Lock()
+	defer queryCache.mu.Unlock()
+	entry, ok := queryCache.entries[key]
+	if !ok || now.After(entry.expires) || entry.generation != queryCache.generation.Load() {
+		return cachedResponse{}, false
+	}
+	return entry, true
+}
+
+// storeQueryCache caches entry under key, first dropping stale entries when
+// the cache is full. The response is not cached if an insert since seq,
+// made while it was computed, may have changed it.
+func storeQueryCache(key string, entry cachedResponse, seq uint64, now time.Time) {
+	queryCache.mu.Lock()
+	defer queryCache.mu.Unlock()
+	if queryCache.seq-seq > maxQueryCacheWrites {
+		return
+	}
+	for n := seq; n < queryCache.seq; n++ {
+		if entry.scope.covers(queryCache.writes[n%maxQueryCacheWrites]) {
+			return
+		}
+	}
+	if queryCache.entries == nil {
+		queryCache.entries = map[string]cachedResponse{}
+	}
+	if len(queryCache.entries) >= maxQueryCacheEntries {
+		generation := queryCache.generation.Load()
+		for k, e := range queryCache.entries {
+			if now.After(e.expires) || e.generation != generation {
+				delete(queryCache.entries, k)
+			}
+		}
+		if len(queryCache.entries) >= maxQueryCacheEntries {
+			return
+		}
+	}
+	queryCache.entries[key] = entry
+}
+
+// queryRoutes are the routes that only read although they are not GET,
+// typically because their queries are sent in the body. They do not
+// invalidate the cache.
+var queryRoutes = map[string]bool{
+	"/api/v1/query_range":           true,
+	"/measurements/import/validate": true,
+	"/grafana/search":               true,
+	"/grafana/query":                true,
+}
+
+// insertRoutes are the routes that only insert measurements. Their inserts
+// drop the cached responses they affect, so they do not invalidate the
+// whole cache.
+var insertRoutes = map[string]bool{
+	"POST /measurements": true,
+	"GET /ingest":        true,
+	"POST /ingest":       true,
+}
+
+// cacheQueries answers GET requests to the QUERY_CACHE_ENDPOINTS, given as
+// route paths such as /measurements/latest, from the query cache for
+// QUERY_CACHE_TTL. Entries are keyed by the path, the query string and the
+// Accept header, and only successful responses are cached. Any other
+// request that succeeds, except to the queryRoutes and insertRoutes, is
+// taken as a write and invalidates the cache.
+func cacheQueries() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if insertRoutes[c.Request.Method+" "+c.FullPath()] {
+			c.Next()
+			return
+		}
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			c.Next()
+			if c.Writer.Status() < http.StatusBadRequest && !queryRoutes[c.FullPath()] {
+				invalidateQueryCache()
+			}
+			return
+		}
+		ttl := cfg().QueryCacheTTL
+		if c.Request.Method != http.MethodGet || ttl <= 0 || !queryCacheEnabled(c.FullPath()) {
+			c.Next()
+			return
+		}
+
+		key := c.Request.URL.Path + "?" + c.Request.URL.RawQuery + "\n" + c.GetHeader("Accept")
+		now := time.Now()
+		if entry, ok := lookupQueryCache(key, now); ok {
+			queryCacheHits.Inc()
+			for name, values := range entry.header {
+				c.Writer.Header()[name] = values
+			}
+			c.Header(cacheHeader, "true")
+			c.Data(http.StatusOK, entry.header.Get("Content-Type"), entry.body)
+			c.Abort()
+			return
+		}
+		queryCacheMisses.Inc()
+
+		// A write while the request runs may not be reflected in its
+		// response, so the response belongs to the generation and the
+		// inserts it started with.
+		generation := queryCache.generation.Load()
+		seq := writeSeq()
+		before := c.Writer.Header().Clone()
+		recorder := &bodyRecorder{ResponseWriter: c.Writer, limit: maxQueryCacheBody + 1}
+		c.Writer = recorder
+		c.Next()
+
+		if recorder.Status() != http.StatusOK || recorder.Header().Get(cacheHeader) != "" ||
+			recorder.body.Len() > maxQueryCacheBody {
+			return
+		}
+		header := http.Header{}
+		for name, values := range recorder.Header() {
+			if _, ok := before[name]; !ok {
+				header[name] = values
+			}
+		}
+		storeQueryCache(key, cachedResponse{
+			header:     header,
+			body:       recorder.body.Bytes(),
+			scope:      requestScope(c),
+			generation: generation,
+			expires:    now.Add(ttl),
+		}, seq, now)
+	}
+}
+
+func queryCacheEnabled(path string) bool {
+	for _, endpoint := range cfg().QueryCacheEndpoints {
+		if endpoint == path {
+			return true
+		}
+	}
+	return false
+}
+
+// validRoutePaths reports whether every QUERY_CACHE_ENDPOINTS entry is a
+// route path.
+func validRoutePaths(paths []string) bool {
+	for _, path := range paths {
+		if !strings.HasPrefix(path, "/") {
+			return false
+		}
+	}
+	return true
+}
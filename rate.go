@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	defaultRateInterval = time.Minute
+	defaultRateWindow   = time.Hour
+	maxRateBuckets      = 10000
+)
+
+// IngestRate counts the measurements stored in each interval of a range.
+type IngestRate struct {
+	From     time.Time    `json:"from"`
+	To       time.Time    `json:"to"`
+	Interval string       `json:"interval"`
+	Buckets  []RateBucket `json:"buckets"`
+}
+
+// RateBucket is the number of measurements in the interval starting at
+// Start; intervals without measurements have a zero count.
+type RateBucket struct {
+	Start time.Time `json:"start"`
+	Count int       `json:"count"`
+}
+
+// truncUnits are the units of $dateTrunc with a fixed length, longest
+// first.
+var truncUnits = []struct {
+	name   string
+	length time.Duration
+}{{"day", 24 * time.Hour}, {"hour", time.Hour}, {"minute", time.Minute}, {"second", time.Second}}
+
+// truncUnit expresses interval as a $dateTrunc unit and bin size, using the
+// longest unit it is a multiple of.
+func truncUnit(interval time.Duration) (string, int64, bool) {
+	for _, unit := range truncUnits {
+		if interval%unit.length == 0 {
+			return unit.name, int64(interval / unit.length), true
+		}
+	}
+	return "", 0, false
+}
+
+// truncEpoch is the reference $dateTrunc aligns bins of fixed-length units
+// to.
+var truncEpoch = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// rateBuckets returns a zero bucket for every interval overlapping [from,
+// to], aligned the way $dateTrunc aligns them.
+func rateBuckets(from, to time.Time, interval time.Duration) []RateBucket {
+	start := truncEpoch.Add(from.Sub(truncEpoch) / interval * interval)
+	if start.After(from) {
+		start = start.Add(-interval)
+	}
+	buckets := []RateBucket{}
+	for ; !start.After(to); start = start.Add(interval) {
+		buckets = append(buckets, RateBucket{Start: start})
+	}
+	return buckets
+}
+
+// @Summary Ingest rate
+// @Description Counts the measurements per interval of the time range, e.g. per minute, for a sparkline of the ingest rate that shows gaps in data collection. Requires MongoDB 5.0.
+// @Tags Measurements
+// @Produce json
+// @Param interval query string false "Bucket length as a Go duration in whole seconds (default 1m)"
+// @Param from query string false "Start of the range as an RFC3339 timestamp (default 1 hour before to)"
+// @Param to query string false "End of the range as an RFC3339 timestamp (default now)"
+// @Param host query string false "Only measurements from this host"
+// @Success 200 {object} IngestRate
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 503 {object} ErrorResponse "MongoDB unavailable"
+// @Router /measurements/rate [get]
+func getIngestRate(c *gin.Context) {
+	interval := defaultRateInterval
+	if raw := c.Query("interval"); raw != "" {
+		var err error
+		interval, err = time.ParseDuration(raw)
+		if err != nil || interval <= 0 {
+			respondError(c, validationError(errors.New("invalid interval: expected a positive duration such as 1m")))
+			return
+		}
+	}
+	unit, binSize, ok := truncUnit(interval)
+	if !ok {
+		respondError(c, validationError(errors.New("invalid interval: expected whole seconds")))
+		return
+	}
+	from, to, err := parseTimeRange(c)
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if from.IsZero() {
+		from = to.Add(-defaultRateWindow)
+	}
+	if err == nil && !to.After(from) {
+		err = errors.New("invalid range: to must be after from")
+	}
+	if err == nil && to.Sub(from)/interval >= maxRateBuckets {
+		err = fmt.Errorf("too many buckets: at most %d intervals per range", maxRateBuckets)
+	}
+	if err == nil {
+		err = checkQueryWindow(from, to)
+	}
+	if err != nil {
+		respondError(c, validationError(err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	collection, err := getMongoCollection()
+	if err != nil {
+		respondError(c, errDBUnavailable)
+		return
+	}
+
+	filter := rangeFilter(from, to)
+	if host := c.Query("host"); host != "" {
+		filter["host"] = host
+	}
+	cur, err := collection.Aggregate(ctx, []bson.M{
+		{"$match": notDeleted(fromSource(filter, hostSource))},
+		{"$group": bson.M{
+			"_id": bson.M{"$dateTrunc": bson.M{
+				"date":    "$timestamp",
+				"unit":    unit,
+				"binSize": binSize,
+			}},
+			"count": bson.M{"$count": bson.M{}},
+		}},
+	})
+	if err != nil {
+		respondError(c, internalError("Failed to count measurements"))
+		return
+	}
+	defer cur.Close(ctx)
+
+	var counts []struct {
+		Start time.Time `bson:"_id"`
+		Count int       `bson:"count"`
+	}
+	if err := cur.All(ctx, &counts); err != nil {
+		respondError(c, internalError("Failed to decode measurement counts"))
+		return
+	}
+
+	result := IngestRate{From: from, To: to, Interval: interval.String(), Buckets: rateBuckets(from, to, interval)}
+	bucketStart := result.Buckets[0].Start
+	for _, count := range counts {
+		if i := int(count.Start.Sub(bucketStart) / interval); i >= 0 && i < len(result.Buckets) {
+			result.Buckets[i].Count = count.Count
+		}
+	}
+
+	c.JSON(http.StatusOK, result)
+}
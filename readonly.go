@@ -0,0 +1,23 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errReadOnly = &APIError{http.StatusForbidden, codeReadOnly,
+	"The service is read-only, writes are disabled by READ_ONLY", nil}
+
+// rejectWrites guards the write endpoints: with READ_ONLY on they answer
+// 403, and during maintenance 503 with Retry-After.
+func rejectWrites() gin.HandlerFunc {
+	duringMaintenance := rejectDuringMaintenance()
+	return func(c *gin.Context) {
+		if cfg().ReadOnly {
+			respondError(c, errReadOnly)
+			return
+		}
+		duringMaintenance(c)
+	}
+}
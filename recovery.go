@@ -0,0 +1,30 @@
+package main
+
+import (
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+)
+
+var panicsTotal = newCounter("panics_total", "Number of panics recovered in HTTP handlers.")
+
+// recoverPanics replaces gin's Recovery: a panicking handler is logged with
+// its stack trace, counted in panics_total and answered with the usual
+// error body instead of an empty 500.
+func recoverPanics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			if err := recover(); err != nil {
+				panicsTotal.Inc()
+				logf(c.Request.Context(), "Panic handling %s %s: %v\n%s", c.Request.Method, c.Request.URL.Path, err, debug.Stack())
+				if c.Writer.Written() {
+					// The response is already underway and cannot be replaced.
+					c.Abort()
+					return
+				}
+				respondError(c, internalError("Internal server error"))
+			}
+		}()
+		c.Next()
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Replay states.
+const (
+	replayRunning   = "running"
+	replayCompleted = "completed"
+	replayCancelled = "cancelled"
+	replayFailed    = "failed"
+)
+
+// ReplayStatus describes the current or last replay of stored measurements.
+type ReplayStatus struct {
+	State      string     `json:"state"`
+	Topic      string     `json:"topic"`
+	Speed      string     `json:"speed"`
+	Published  int        `json:"published"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+var (
+	errMQTTUnavailable = &APIError{http.StatusServiceUnavailable, codeMQTTUnavailable, "Not connected to the MQTT broker", nil}
+	errReplayRunning   = &APIError{http.StatusConflict, codeConflict, "A replay is already running", nil}
+	errNoReplay        = &APIError{http.StatusNotFound, codeNotFound, "No replay is running", nil}
+)
+
+// replay is the current or last replay; only one runs at a time.
+var replay struct {
+	mu     sync.Mutex
+	status *ReplayStatus
+	cancel context.CancelFunc
+	// done is closed once the replay finished.
+	done chan struct{}
+}
+
+// replayStopTimeout bounds how long shutdown waits for a cancelled replay to
+// finish its last publish.
+const replayStopTimeout = 5 * time.Second
+
+func init() {
+	onShutdown("replay", replayStopTimeout, stopReplay)
+}
+
+// stopReplay cancels the running replay, if any, and waits until it
+// finished, so that it does not publish while the broker is disconnected.
+func stopReplay(ctx context.Context) error {
+	replay.mu.Lock()
+	if replay.status == nil || replay.status.State != replayRunning {
+		replay.mu.Unlock()
+		return nil
+	}
+	replay.cancel()
+	done := replay.done
+	replay.mu.Unlock()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// parseReplaySpeed parses a speed such as 1x or 10x into its multiplier.
+// "max" publishes without waiting and yields 0.
+func parseReplaySpeed(raw string) (float64, error) {
+	if raw == "max" {
+		return 0, nil
+	}
+	speed, err := strconv.ParseFloat(strings.TrimSuffix(raw, "x"), 64)
+	if err != nil || speed <= 0 {
+		return 0, errors.New("invalid speed: expected a positive multiplier such as 1x or 10x, or max")
+	}
+	return speed, nil
+}
+
+// updateReplay applies update to the status of the running replay.
+func updateReplay(update func(status *ReplayStatus)) {
+	replay.mu.Lock()
+	defer replay.mu.Unlock()
+	update(replay.status)
+}
+
+// replayBatchSize is how many measurements a replay reads per query.
+const replayBatchSize = 100
+
+// runReplay publishes the measurements matching filter in timestamp order
+// to topic. With a non-zero speed, it waits between two measurements for
+// the time between their timestamps divided by speed.
+func runReplay(ctx context.Context, client MQTTClient, filter bson.M, topic string, speed float64) error {
+	collection, err := getMongoCollection()
+	if err != nil {
+		return err
+	}
+
+	qos := byte(cfg().MQTTPublishQoS)
+	var previous time.Time
+	var last *Measurement
+	for {
+		batch, err := nextReplayBatch(ctx, collection, filter, last)
+		if err != nil || len(batch) == 0 {
+			return err
+		}
+		for i := range batch {
+			measurement := batch[i]
+			if speed > 0 && !previous.IsZero() {
+				delay := time.Duration(float64(measurement.Timestamp.Sub(previous)) / speed)
+				timer := time.NewTimer(delay)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+					return ctx.Err()
+				}
+			}
+			previous = measurement.Timestamp
+
+			payload, err := json.Marshal(measurement)
+			if err != nil {
+				return err
+			}
+			if err := client.Publish(topic, qos, false, payload); err != nil {
+				return fmt.Errorf("publishing measurement %s: %w", measurement.ID.Hex(), err)
+			}
+			updateReplay(func(status *ReplayStatus) { status.Published++ })
+		}
+		last = &batch[len(batch)-1]
+	}
+}
+
+// nextReplayBatch returns the measurements matching filter that follow last,
+// or the first ones if last is nil, in (timestamp, _id) order. Each batch is
+// a short query of its own: a cursor kept open across the pauses of a slow
+// replay would be closed by the server once idle for 10 minutes.
+func nextReplayBatch(ctx context.Context, collection *mongo.Collection, filter bson.M, last *Measurement) ([]Measurement, error) {
+	if last != nil {
+		filter = bson.M{"$and": bson.A{filter, bson.M{"$or": bson.A{
+			bson.M{"timestamp": bson.M{"$gt": last.Timestamp}},
+			bson.M{"timestamp": last.Timestamp, "_id": bson.M{"$gt": last.ID}},
+		}}}}
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "timestamp", Value: 1}, {Key: "_id", Value: 1}}).
+		SetLimit(replayBatchSize)
+	cur, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var batch []Measurement
+	err = cur.All(ctx, &batch)
+	return batch, err
+}
+
+// @Summary Start a replay
+// @Description Re-publishes the stored measurements matching the usual filters to an MQTT topic in timestamp order, for testing downstream consumers. With a speed multiplier the original spacing is kept, scaled down by the multiplier; max publishes as fast as possible. The replay runs in the background; only one runs at a time.
+// @Tags Broker
+// @Produce json
+// @Param topic query string true "Topic to publish to; must not match MQTT_TOPIC"
+// @Param speed query string false "Playback speed such as 1x or 10x, or max (default 1x)"
+// @Param from query string false "Only measurements at or after this RFC3339 timestamp"
+// @Param to query string false "Only measurements at or before this RFC3339 timestamp"
+// @Param host query string false "Only measurements from this host"
+// @Success 202 {object} ReplayStatus
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 409 {object} ErrorResponse "A replay is already running"
+// @Failure 503 {object} ErrorResponse "Not connected to the MQTT broker"
+// @Router /measurements/replay [post]
+func startReplay(c *gin.Context) {
+	topic := c.Query("topic")
+	if topic == "" || strings.ContainsAny(topic, "+#") {
+		respondError(c, validationError(errors.New("invalid topic: expected a topic name without wildcards")))
+		return
+	}
+	// Replaying onto the subscription would store every measurement again.
+	if topicMatches(subscriptionFilter(cfg().MQTTTopic), topic) {
+		respondError(c, validationError(fmt.Errorf("invalid topic: %q matches MQTT_TOPIC", topic)))
+		return
+	}
+	rawSpeed := c.DefaultQuery("speed", "1x")
+	speed, err := parseReplaySpeed(rawSpeed)
+	if err != nil {
+		respondError(c, validationError(err))
+		return
+	}
+	filter, err := measurementFilter(c)
+	if err != nil {
+		respondError(c, validationError(err))
+		return
+	}
+	client := currentMQTTClient()
+	if client == nil || !client.IsConnectionOpen() {
+		respondError(c, errMQTTUnavailable)
+		return
+	}
+
+	replay.mu.Lock()
+	defer replay.mu.Unlock()
+	if replay.status != nil && replay.status.State == replayRunning {
+		respondError(c, errReplayRunning)
+		return
+	}
+	// The replay outlives the request but keeps its ID for the logs.
+	ctx, cancel := context.WithCancel(detachLogID(c.Request.Context()))
+	status := &ReplayStatus{State: replayRunning, Topic: topic, Speed: rawSpeed, StartedAt: time.Now()}
+	done := make(chan struct{})
+	replay.status, replay.cancel, replay.done = status, cancel, done
+
+	go func() {
+		defer close(done)
+		defer cancel()
+		err := runReplay(ctx, client, filter, topic, speed)
+		updateReplay(func(status *ReplayStatus) {
+			finished := time.Now()
+			status.FinishedAt = &finished
+			switch {
+			case errors.Is(err, context.Canceled):
+				status.State = replayCancelled
+			case err != nil:
+				status.State, status.Error = replayFailed, toAPIError(ctx, err).Message
+			default:
+				status.State = replayCompleted
+			}
+		})
+	}()
+
+	c.JSON(http.StatusAccepted, *status)
+}
+
+// @Summary Get the replay status
+// @Description Reports the progress of the running replay, or the outcome of the last one
+// @Tags Broker
+// @Produce json
+// @Success 200 {object} ReplayStatus
+// @Failure 404 {object} ErrorResponse "No replay was started"
+// @Router /measurements/replay [get]
+func getReplayStatus(c *gin.Context) {
+	replay.mu.Lock()
+	defer replay.mu.Unlock()
+	if replay.status == nil {
+		respondError(c, &APIError{http.StatusNotFound, codeNotFound, "No replay was started", nil})
+		return
+	}
+	c.JSON(http.StatusOK, *replay.status)
+}
+
+// @Summary Cancel the replay
+// @Description Stops the running replay; the measurements published so far are not withdrawn
+// @Tags Broker
+// @Produce json
+// @Success 200 {object} ReplayStatus
+// @Failure 404 {object} ErrorResponse "No replay is running"
+// @Router /measurements/replay [delete]
+func cancelReplay(c *gin.Context) {
+	replay.mu.Lock()
+	defer replay.mu.Unlock()
+	if replay.status == nil || replay.status.State != replayRunning {
+		respondError(c, errNoReplay)
+		return
+	}
+	replay.cancel()
+	c.JSON(http.StatusOK, *replay.status)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// maxRequestIDLength bounds the length of a request ID taken from a client.
+const maxRequestIDLength = 128
+
+// logIDKey is the context key of the ID the log lines of a request or an
+// MQTT message carry.
+type logIDKey struct{}
+
+// logID is such an ID with the name it is logged under, request_id for
+// HTTP requests and ingest_id for MQTT messages.
+type logID struct {
+	name, value string
+}
+
+func withLogID(ctx context.Context, name, value string) context.Context {
+	return context.WithValue(ctx, logIDKey{}, logID{name, value})
+}
+
+// detachLogID returns a background context carrying the ID of ctx, for work
+// that outlives a request.
+func detachLogID(ctx context.Context) context.Context {
+	if id, ok := ctx.Value(logIDKey{}).(logID); ok {
+		return context.WithValue(context.Background(), logIDKey{}, id)
+	}
+	return context.Background()
+}
+
+// logf logs like log.Printf, prefixed with the ID carried by ctx, if any.
+func logf(ctx context.Context, format string, args ...interface{}) {
+	if id, ok := ctx.Value(logIDKey{}).(logID); ok {
+		format = id.name + "=" + id.value + " " + format
+	}
+	log.Printf(format, args...)
+}
+
+// validRequestID reports whether a request ID sent by a client can be used
+// as is: it must be short and printable, so that it cannot forge log lines.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// assignRequestID takes the request ID from the header, or generates a UUID
+// when the client sent none or an unusable one, stores it in the request
+// context for logf and echoes it back in the same header.
+func assignRequestID(header string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(header)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		c.Request = c.Request.WithContext(withLogID(c.Request.Context(), "request_id", id))
+		c.Header(header, id)
+		c.Next()
+	}
+}
+
+// requestLogFormatter formats the access log like gin's default formatter,
+// without colors and with the request ID.
+func requestLogFormatter(param gin.LogFormatterParams) string {
+	var id string
+	if value, ok := param.Request.Context().Value(logIDKey{}).(logID); ok {
+		id = value.value
+	}
+	return fmt.Sprintf("[GIN] %v | %3d | %13v | %15s | %-7s %#v | request_id=%s\n%s",
+		param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		param.StatusCode,
+		param.Latency,
+		param.ClientIP,
+		param.Method,
+		param.Path,
+		id,
+		param.ErrorMessage,
+	)
+}
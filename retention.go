@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RetentionPreview describes the raw host measurements the next compaction
+// run would roll up and delete.
+type RetentionPreview struct {
+	// Enabled is false while ROLLUP_AGE is unset and no older_than was
+	// given; nothing is deleted then.
+	Enabled   bool       `json:"enabled"`
+	OlderThan string     `json:"older_than,omitempty"`
+	NextRun   *time.Time `json:"next_run,omitempty"`
+	Cutoff    *time.Time `json:"cutoff,omitempty"`
+	Count     int64      `json:"count"`
+	Oldest    *time.Time `json:"oldest,omitempty"`
+	Newest    *time.Time `json:"newest,omitempty"`
+}
+
+// @Summary Preview retention
+// @Description Reports how many raw measurements, and from which time span, the next compaction run would roll up and delete with the current ROLLUP_AGE, or with older_than if given. Nothing is deleted.
+// @Tags Measurements
+// @Produce json
+// @Param older_than query string false "Age to preview instead of ROLLUP_AGE, e.g. 720h"
+// @Success 200 {object} RetentionPreview
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 503 {object} ErrorResponse "MongoDB unavailable"
+// @Router /measurements/delete-older-than [get]
+func previewRetention(c *gin.Context) {
+	age := cfg().RollupAge
+	if raw := c.Query("older_than"); raw != "" {
+		var err error
+		if age, err = time.ParseDuration(raw); err != nil || age <= 0 {
+			respondError(c, validationError(errors.New("invalid older_than: expected a positive duration such as 720h")))
+			return
+		}
+	}
+	if age <= 0 {
+		c.JSON(http.StatusOK, RetentionPreview{})
+		return
+	}
+
+	nextRun := time.Unix(0, nextRollup.Load())
+	if nextRun.Before(time.Now()) {
+		nextRun = time.Now()
+	}
+	cutoff := rollupCutoff(nextRun, age)
+	preview := RetentionPreview{Enabled: true, OlderThan: age.String(), NextRun: &nextRun, Cutoff: &cutoff}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	collection, err := getMongoCollection()
+	if err != nil {
+		respondError(c, errDBUnavailable)
+		return
+	}
+
+	// Compaction leaves process measurements raw.
+	filter := fromSource(bson.M{"timestamp": bson.M{"$lt": cutoff}}, hostSource)
+	if preview.Count, err = collection.CountDocuments(ctx, filter); err != nil {
+		respondError(c, internalError("Failed to count measurements"))
+		return
+	}
+	if preview.Count > 0 {
+		if preview.Oldest, err = boundaryTimestamp(ctx, collection, filter, 1); err == nil {
+			preview.Newest, err = boundaryTimestamp(ctx, collection, filter, -1)
+		}
+		if err != nil {
+			respondError(c, internalError("Failed to retrieve measurements"))
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, preview)
+}
+
+// boundaryTimestamp returns the oldest (order 1) or newest (order -1)
+// timestamp of the measurements matching filter.
+func boundaryTimestamp(ctx context.Context, collection *mongo.Collection, filter bson.M, order int) (*time.Time, error) {
+	var measurement Measurement
+	opts := options.FindOne().SetSort(bson.M{"timestamp": order}).SetProjection(bson.M{"timestamp": 1})
+	if err := collection.FindOne(ctx, filter, opts).Decode(&measurement); err != nil {
+		return nil, err
+	}
+	return &measurement.Timestamp, nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+)
+
+// isTransientMongoError reports whether err is a network blip or server-side
+// condition that may succeed on retry. Validation and other command errors
+// are not transient.
+func isTransientMongoError(err error) bool {
+	if mongo.IsNetworkError(err) || mongo.IsTimeout(err) {
+		return true
+	}
+
+	var selectionErr topology.ServerSelectionError
+	if errors.As(err, &selectionErr) {
+		return true
+	}
+
+	var serverErr mongo.ServerError
+	if errors.As(err, &serverErr) {
+		return serverErr.HasErrorLabel("RetryableWriteError") ||
+			serverErr.HasErrorLabel("TransientTransactionError")
+	}
+	return false
+}
+
+// retryTransient runs op until it succeeds, returns a non-transient error,
+// MongoWriteAttempts attempts were made or ctx is done. The delay between
+// attempts starts at MongoWriteBackoff and doubles after each retry.
+func retryTransient(ctx context.Context, name string, op func() error) error {
+	writeRetryAttempts := cfg().MongoWriteAttempts
+	backoff := cfg().MongoWriteBackoff
+	var err error
+	for attempt := 1; attempt <= writeRetryAttempts; attempt++ {
+		if err = op(); err == nil || !isTransientMongoError(err) || ctx.Err() != nil {
+			return err
+		}
+		if attempt < writeRetryAttempts {
+			log.Printf("Warning: %s failed (attempt %d/%d), retrying in %s: %s\n",
+				name, attempt, writeRetryAttempts, backoff, err)
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return err
+			}
+			backoff *= 2
+		}
+	}
+	log.Printf("Error: %s failed after %d attempts: %s\n", name, writeRetryAttempts, err)
+	return err
+}
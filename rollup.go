@@ -0,0 +1,378 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// rollupCollection holds the hourly averages of the raw measurements that
+// were compacted out of collection. Rollups use the field names of raw
+// measurements and keep their labels, so the measurement filters apply to
+// them unchanged.
+func rollupCollection(collection *mongo.Collection) *mongo.Collection {
+	return collection.Database().Collection(collection.Name() + "-rollups")
+}
+
+// runRollups periodically compacts raw measurements older than ROLLUP_AGE
+// into hourly averages per host and label set. Both settings are read on
+// every run so that a reload applies without a restart; a zero age disables
+// the job. On shutdown a running compaction is completed, as an interrupted
+// one could later roll up the same measurements twice.
+func runRollups(stopping <-chan struct{}) {
+	for {
+		next := time.Now().Add(cfg().RollupInterval)
+		nextRollup.Store(next.UnixNano())
+		if sleepOrStop(stopping, time.Until(next)) {
+			return
+		}
+		age := cfg().RollupAge
+		if age <= 0 {
+			continue
+		}
+		cutoff := rollupCutoff(time.Now(), age)
+		if n, err := compactMeasurements(cutoff); err != nil {
+			log.Println("Error compacting measurements:", err)
+		} else if n > 0 {
+			log.Printf("Compacted %d measurements older than %s into hourly rollups\n",
+				n, cutoff.Format(time.RFC3339))
+		}
+	}
+}
+
+// nextRollup is the time of the next compaction run in Unix nanoseconds.
+var nextRollup atomic.Int64
+
+// rollupCutoff returns the time before which a compaction run at now
+// compacts measurements. Only whole hours are compacted, so no hour is split
+// between a rollup and raw measurements.
+func rollupCutoff(now time.Time, age time.Duration) time.Time {
+	return now.Add(-age).Truncate(time.Hour)
+}
+
+// compactMeasurements rolls up the measurements before cutoff and deletes
+// them, returning how many were deleted. Rolling up an hour that already
+// has a rollup, e.g. for late measurements, adds to the existing sums
+// instead of replacing them.
+func compactMeasurements(cutoff time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	collection, err := getMongoCollection()
+	if err != nil {
+		return 0, err
+	}
+	rollups := rollupCollection(collection)
+	if err := ensureRollupIndex(ctx, rollups); err != nil {
+		return 0, err
+	}
+
+	// Measurements inserted while the job runs may carry old timestamps,
+	// e.g. when the observer buffer is replayed. Bounding both steps by
+	// the newest ID seen up front keeps them from being deleted without
+	// having been rolled up.
+	var newest Measurement
+	opts := options.FindOne().SetSort(bson.M{"_id": -1}).SetProjection(bson.M{"_id": 1})
+	err = collection.FindOne(ctx, bson.M{}, opts).Decode(&newest)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	// Process measurements are left raw, so that they do not blend into
+	// the averages of their host.
+	filter := fromSource(bson.M{"timestamp": bson.M{"$lt": cutoff}, "_id": bson.M{"$lte": newest.ID}}, hostSource)
+
+	// The measurements are read in time order and each hour is stored and
+	// deleted before the next, so that only one hour is held in memory and
+	// a failed run leaves few measurements both rolled up and raw.
+	cur, err := collection.Find(ctx, notDeleted(filter),
+		options.Find().SetSort(bson.M{"timestamp": 1}).SetAllowDiskUse(true))
+	if err != nil {
+		return 0, err
+	}
+	defer cur.Close(ctx)
+
+	var deleted int64
+	var hour time.Time
+	groups := map[string]*rollup{}
+	flush := func() error {
+		n, err := storeRollups(ctx, collection, filter, hour, groups)
+		deleted += n
+		groups = map[string]*rollup{}
+		return err
+	}
+	for cur.Next(ctx) {
+		var m Measurement
+		if err := cur.Decode(&m); err != nil {
+			return deleted, err
+		}
+		if at := m.Timestamp.Truncate(time.Hour); !at.Equal(hour) {
+			if err := flush(); err != nil {
+				return deleted, err
+			}
+			hour = at
+		}
+		r := newRollup(hour, m)
+		key := r.groupKey()
+		if groups[key] == nil {
+			groups[key] = r
+		}
+		groups[key].add(m)
+	}
+	if err := cur.Err(); err != nil {
+		return deleted, err
+	}
+	if err := flush(); err != nil {
+		return deleted, err
+	}
+
+	// Soft-deleted measurements before the cutoff are not rolled up but
+	// go as well.
+	result, err := collection.DeleteMany(ctx, filter)
+	invalidateQueryCache()
+	if err != nil {
+		return deleted, err
+	}
+	return deleted + result.DeletedCount, nil
+}
+
+// ensureRollupIndex creates the unique index on the group of a rollup,
+// replacing the one on host and hour alone of rollups without labels.
+func ensureRollupIndex(ctx context.Context, rollups *mongo.Collection) error {
+	_, err := rollups.Indexes().DropOne(ctx, "host_1_timestamp_1")
+	var cmdErr mongo.CommandError
+	if err != nil && !(errors.As(err, &cmdErr) && (cmdErr.Name == "IndexNotFound" || cmdErr.Name == "NamespaceNotFound")) {
+		return err
+	}
+	_, err = rollups.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "host", Value: 1}, {Key: "timestamp", Value: 1}, {Key: "label_key", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// storeRollups adds the rollups of an hour to those stored and deletes the
+// measurements of that hour matching filter, returning how many were
+// deleted.
+func storeRollups(ctx context.Context, collection *mongo.Collection, filter bson.M, hour time.Time, groups map[string]*rollup) (int64, error) {
+	if len(groups) == 0 {
+		return 0, nil
+	}
+	rollups := rollupCollection(collection)
+	for _, r := range groups {
+		var stored rollup
+		err := rollups.FindOne(ctx, r.storedKey()).Decode(&stored)
+		switch {
+		case err == mongo.ErrNoDocuments:
+			stored = *r
+		case err != nil:
+			return 0, err
+		default:
+			stored.merge(*r)
+		}
+		_, err = rollups.ReplaceOne(ctx, r.storedKey(), stored, options.Replace().SetUpsert(true))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	inHour := bson.M{"timestamp": bson.M{"$gte": hour, "$lt": hour.Add(time.Hour)}}
+	result, err := collection.DeleteMany(ctx, bson.M{"$and": bson.A{filter, inHour}})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+// rollup is an hourly rollup as stored: the averages of the measurements of
+// a host and hour with the same labels, as a measurement, along with the
+// sums they are computed from, so that late measurements can be added.
+// Disks and metrics are averaged over the measurements that have them.
+type rollup struct {
+	Measurement `bson:",inline"`
+
+	// LabelKey identifies the label set, which cannot be compared as a
+	// document as its keys are stored in no particular order.
+	LabelKey      string             `bson:"label_key,omitempty"`
+	CPUSum        float64            `bson:"cpu_sum"`
+	RAMSum        float64            `bson:"ram_sum"`
+	DiskSums      map[string]float64 `bson:"disk_sums,omitempty"`
+	DiskSamples   map[string]int     `bson:"disk_samples,omitempty"`
+	MetricSums    map[string]float64 `bson:"metric_sums,omitempty"`
+	MetricSamples map[string]int     `bson:"metric_samples,omitempty"`
+}
+
+// newRollup returns an empty rollup of the hour for the host and labels of
+// m.
+func newRollup(hour time.Time, m Measurement) *rollup {
+	r := &rollup{Measurement: Measurement{Timestamp: hour, Host: m.Host, Labels: m.Labels}}
+	if len(m.Labels) > 0 {
+		// Unlike BSON, JSON encodes map keys sorted.
+		key, _ := json.Marshal(m.Labels)
+		r.LabelKey = string(key)
+	}
+	return r
+}
+
+// groupKey identifies the host and label set of the rollup within its hour.
+func (r *rollup) groupKey() string {
+	return r.Host + "\x00" + r.LabelKey
+}
+
+// storedKey is the filter matching the stored rollup of the same group.
+// Rollups of measurements without a host or labels lack the field, which
+// null matches.
+func (r *rollup) storedKey() bson.M {
+	key := bson.M{"timestamp": r.Timestamp, "host": bson.M{"$in": bson.A{nil, ""}}, "label_key": nil}
+	if r.Host != "" {
+		key["host"] = r.Host
+	}
+	if r.LabelKey != "" {
+		key["label_key"] = r.LabelKey
+	}
+	return key
+}
+
+// add adds a measurement to the sums and updates the averages.
+func (r *rollup) add(m Measurement) {
+	r.merge(rollup{
+		Measurement:   Measurement{Samples: 1},
+		CPUSum:        m.CPU,
+		RAMSum:        m.RAM,
+		DiskSums:      m.Disks,
+		DiskSamples:   countKeys(m.Disks),
+		MetricSums:    m.Metrics,
+		MetricSamples: countKeys(m.Metrics),
+	})
+}
+
+// merge adds the sums of other to those of r and updates the averages.
+func (r *rollup) merge(other rollup) {
+	r.Samples += other.Samples
+	r.CPUSum += other.CPUSum
+	r.RAMSum += other.RAMSum
+	r.CPU = r.CPUSum / float64(r.Samples)
+	r.RAM = r.RAMSum / float64(r.Samples)
+	r.Disks = mergeAverages(&r.DiskSums, &r.DiskSamples, other.DiskSums, other.DiskSamples)
+	r.Metrics = mergeAverages(&r.MetricSums, &r.MetricSamples, other.MetricSums, other.MetricSamples)
+}
+
+// mergeAverages adds the sums and sample counts by key of other to those
+// of sums and samples and returns the averages by key.
+func mergeAverages(sums *map[string]float64, samples *map[string]int, otherSums map[string]float64, otherSamples map[string]int) map[string]float64 {
+	for key, sum := range otherSums {
+		if *sums == nil {
+			*sums, *samples = map[string]float64{}, map[string]int{}
+		}
+		(*sums)[key] += sum
+		(*samples)[key] += otherSamples[key]
+	}
+	if len(*sums) == 0 {
+		return nil
+	}
+	averages := make(map[string]float64, len(*sums))
+	for key, sum := range *sums {
+		averages[key] = sum / float64((*samples)[key])
+	}
+	return averages
+}
+
+func countKeys(values map[string]float64) map[string]int {
+	if len(values) == 0 {
+		return nil
+	}
+	counts := make(map[string]int, len(values))
+	for key := range values {
+		counts[key] = 1
+	}
+	return counts
+}
+
+// findRollups returns the rollups matching filter as measurements.
+func findRollups(ctx context.Context, collection *mongo.Collection, filter bson.M) ([]Measurement, error) {
+	opts := options.Find().SetSort(bson.M{"timestamp": 1})
+	cur, err := rollupCollection(collection).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var rollups []Measurement
+	err = cur.All(ctx, &rollups)
+	return rollups, err
+}
+
+// dataSourceHeader lists the collections a response was read from: raw for
+// the measurements, rollups for the hourly averages of compacted ones.
+const dataSourceHeader = "X-Data-Source"
+
+// includeRollups reports whether GET /measurements also returns rollups:
+// as given by the rollups query parameter, or else when the range starts
+// before the compaction cutoff, where raw measurements may already be
+// gone. Paginated queries only include them on request, which is rejected.
+func includeRollups(c *gin.Context, paginated bool) (bool, error) {
+	if raw := c.Query("rollups"); raw != "" {
+		include, err := strconv.ParseBool(raw)
+		if err != nil {
+			return false, errors.New("invalid rollups: expected true or false")
+		}
+		return include, nil
+	}
+	age := cfg().RollupAge
+	if paginated || age <= 0 {
+		return false, nil
+	}
+	from, _, err := parseTimeRange(c)
+	return err == nil && !from.IsZero() && from.Before(rollupCutoff(time.Now(), age)), nil
+}
+
+// @Summary List rollups
+// @Description Returns the hourly averages per host and label set of the measurements compacted after ROLLUP_AGE, oldest first. Each carries the number of raw measurements it averages in Samples. Accept: application/x-protobuf returns a MeasurementList message of proto/measurement.proto.
+// @Tags Measurements
+// @Produce json
+// @Produce application/x-protobuf
+// @Param from query string false "Only rollups of hours starting at or after this RFC3339 timestamp"
+// @Param to query string false "Only rollups of hours starting at or before this RFC3339 timestamp"
+// @Param host query string false "Only rollups of this host"
+// @Success 200 {array} Measurement
+// @Header 200 {string} X-Data-Source "Always rollups"
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 503 {object} ErrorResponse "MongoDB unavailable"
+// @Router /rollups [get]
+func getRollups(c *gin.Context) {
+	filter, err := timeRangeFilter(c)
+	if err != nil {
+		respondError(c, validationError(err))
+		return
+	}
+	if host := c.Query("host"); host != "" {
+		filter["host"] = host
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	collection, err := getMongoCollection()
+	if err != nil {
+		respondError(c, errDBUnavailable)
+		return
+	}
+
+	rollups, err := findRollups(ctx, collection, filter)
+	if err != nil {
+		respondError(c, internalError("Failed to retrieve rollups"))
+		return
+	}
+	c.Header(dataSourceHeader, "rollups")
+	respondMeasurements(c, rollups)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestRollupCutoff(t *testing.T) {
+	hour := time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		now  time.Time
+		age  time.Duration
+		want time.Time
+	}{
+		{name: "on the hour", now: hour.Add(24 * time.Hour), age: 24 * time.Hour, want: hour},
+		{name: "within the hour", now: hour.Add(24*time.Hour + 59*time.Minute), age: 24 * time.Hour, want: hour},
+		{name: "just before the hour", now: hour.Add(24*time.Hour - time.Nanosecond), age: 24 * time.Hour, want: hour.Add(-time.Hour)},
+		{name: "age of minutes", now: hour.Add(30 * time.Minute), age: 45 * time.Minute, want: hour.Add(-time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rollupCutoff(tt.now, tt.age); !got.Equal(tt.want) {
+				t.Errorf("rollupCutoff = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompactMeasurements(t *testing.T) {
+	testConfig(t)
+	collection := testCollection(t)
+	rollups := rollupCollection(collection)
+	t.Cleanup(func() { _ = rollups.Drop(context.Background()) })
+	// Rollups used to be unique by host and hour alone.
+	_, err := rollups.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "host", Value: 1}, {Key: "timestamp", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hour := time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)
+	cutoff := hour.Add(time.Hour)
+	insert := func(m Measurement) {
+		t.Helper()
+		m.RAM = m.CPU / 2
+		if _, err := collection.InsertOne(context.Background(), m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	self := map[string]string{sourceLabel: selfSource}
+	// Every bucket boundary is exercised: the last millisecond before an
+	// hour, its first millisecond and the last one before the cutoff.
+	insert(Measurement{Host: "web-1", Timestamp: hour.Add(-time.Millisecond), CPU: 10})
+	insert(Measurement{Host: "web-1", Timestamp: hour, CPU: 20})
+	insert(Measurement{Host: "web-1", Timestamp: cutoff.Add(-time.Millisecond), CPU: 40})
+	insert(Measurement{Host: "web-2", Timestamp: hour.Add(30 * time.Minute), CPU: 50})
+	insert(Measurement{Host: "web-1", Timestamp: cutoff, CPU: 90})
+	insert(Measurement{Host: "web-1", Timestamp: hour.Add(time.Minute), CPU: 99, Labels: self})
+	// Labelled measurements are rolled up per label set, whatever the
+	// order of their labels, with disks and metrics averaged over those
+	// having them.
+	insert(Measurement{Host: "web-1", Timestamp: hour.Add(10 * time.Minute), CPU: 60,
+		Labels:  map[string]string{"environment": "prod", "rack": "r1"},
+		Disks:   map[string]float64{"/": 40},
+		Metrics: map[string]float64{"temp": 20}})
+	insert(Measurement{Host: "web-1", Timestamp: hour.Add(20 * time.Minute), CPU: 80,
+		Labels:  map[string]string{"rack": "r1", "environment": "prod"},
+		Metrics: map[string]float64{"temp": 30, "humidity": 50}})
+
+	n, err := compactMeasurements(cutoff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 6 {
+		t.Errorf("compacted %d measurements, want 6", n)
+	}
+
+	// Late measurements of a compacted hour are added to its rollups.
+	insert(Measurement{Host: "web-2", Timestamp: hour.Add(45 * time.Minute), CPU: 70})
+	insert(Measurement{Host: "web-1", Timestamp: hour.Add(50 * time.Minute), CPU: 10,
+		Labels:  map[string]string{"environment": "prod", "rack": "r1"},
+		Metrics: map[string]float64{"temp": 40}})
+	if n, err := compactMeasurements(cutoff); err != nil || n != 2 {
+		t.Fatalf("second run compacted %d measurements, err = %v, want 2", n, err)
+	}
+
+	found, err := findRollups(context.Background(), collection, bson.M{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	prod := map[string]string{"environment": "prod", "rack": "r1"}
+	want := []Measurement{
+		{Host: "web-1", Timestamp: hour.Add(-time.Hour), CPU: 10, RAM: 5, Samples: 1},
+		{Host: "web-1", Timestamp: hour, CPU: 30, RAM: 15, Samples: 2},
+		{Host: "web-1", Timestamp: hour, CPU: 50, RAM: 25, Samples: 3, Labels: prod,
+			Disks: map[string]float64{"/": 40}, Metrics: map[string]float64{"temp": 30, "humidity": 50}},
+		{Host: "web-2", Timestamp: hour, CPU: 60, RAM: 30, Samples: 2},
+	}
+	if len(found) != len(want) {
+		t.Fatalf("got %d rollups, want %d: %+v", len(found), len(want), found)
+	}
+	for _, w := range want {
+		matched := false
+		for _, r := range found {
+			if r.Host != w.Host || !r.Timestamp.Equal(w.Timestamp) || !reflect.DeepEqual(r.Labels, w.Labels) {
+				continue
+			}
+			matched = true
+			if r.CPU != w.CPU || r.RAM != w.RAM || r.Samples != w.Samples ||
+				!reflect.DeepEqual(r.Disks, w.Disks) || !reflect.DeepEqual(r.Metrics, w.Metrics) {
+				t.Errorf("rollup of %s at %s with labels %v: %+v, want %+v", w.Host, w.Timestamp, w.Labels, r, w)
+			}
+		}
+		if !matched {
+			t.Errorf("no rollup of %s at %s with labels %v", w.Host, w.Timestamp, w.Labels)
+		}
+	}
+
+	// Measurements from the cutoff on and process samples stay raw.
+	cur, err := collection.Find(context.Background(), bson.M{}, options.Find().SetSort(bson.M{"timestamp": 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw []Measurement
+	if err := cur.All(context.Background(), &raw); err != nil {
+		t.Fatal(err)
+	}
+	if len(raw) != 2 || !isSelfMeasurement(raw[0]) || !raw[1].Timestamp.Equal(cutoff) {
+		t.Errorf("raw measurements left: %+v, want the process sample and the one at the cutoff", raw)
+	}
+}
+
+func TestGetMeasurementsRollupFilters(t *testing.T) {
+	testConfig(t)
+	collection := testCollection(t)
+	t.Cleanup(func() { _ = rollupCollection(collection).Drop(context.Background()) })
+	hour := time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)
+	for _, m := range []Measurement{
+		{Host: "web-1", Timestamp: hour, CPU: 10, Labels: map[string]string{"environment": "prod"}, Metrics: map[string]float64{"temp": 20}},
+		{Host: "web-1", Timestamp: hour.Add(time.Minute), CPU: 30, Labels: map[string]string{"environment": "prod"}, Metrics: map[string]float64{"temp": 40}},
+		{Host: "web-1", Timestamp: hour, CPU: 50, Labels: map[string]string{"environment": "staging"}},
+	} {
+		if _, err := collection.InsertOne(context.Background(), m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := compactMeasurements(hour.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	// A raw measurement that is not compacted yet.
+	if _, err := collection.InsertOne(context.Background(), Measurement{Host: "web-1", Timestamp: time.Now(), CPU: 70,
+		Labels: map[string]string{"environment": "prod"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.GET("/measurements", getMeasurements)
+	tests := []struct {
+		query   string
+		wantCPU []float64
+	}{
+		{query: "rollups=true", wantCPU: []float64{20, 50, 70}},
+		{query: "rollups=true&label.environment=prod", wantCPU: []float64{20, 70}},
+		{query: "rollups=true&label.environment=staging", wantCPU: []float64{50}},
+		// Metric filters apply to the hourly averages.
+		{query: "rollups=true&metric=temp&metric_gt=25", wantCPU: []float64{20}},
+		{query: "rollups=true&metric=temp&metric_gt=35", wantCPU: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", "/measurements?"+tt.query, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			var found []Measurement
+			if err := json.Unmarshal(w.Body.Bytes(), &found); err != nil {
+				t.Fatal(err)
+			}
+			var cpu []float64
+			for _, m := range found {
+				cpu = append(cpu, m.CPU)
+			}
+			sort.Float64s(cpu)
+			if !reflect.DeepEqual(cpu, tt.wantCPU) {
+				t.Errorf("CPU of the measurements = %v, want %v", cpu, tt.wantCPU)
+			}
+		})
+	}
+}
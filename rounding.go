@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+)
+
+// roundPercent rounds a percentage to PERCENT_DECIMALS decimals, or leaves
+// it as is when that is negative. Aggregations compute with full precision
+// and only round their results.
+func roundPercent(v float64) float64 {
+	decimals := cfg().PercentDecimals
+	if decimals < 0 {
+		return v
+	}
+	scale := math.Pow10(decimals)
+	return math.Round(v*scale) / scale
+}
+
+// roundPercentPtr rounds a percentage that may be null.
+func roundPercentPtr(v *float64) *float64 {
+	if v == nil {
+		return nil
+	}
+	rounded := roundPercent(*v)
+	return &rounded
+}
+
+// roundedPercents returns m with CPU, RAM and disk usage rounded. The disks
+// are copied, as the caller may still use them.
+func (m Measurement) roundedPercents() Measurement {
+	m.CPU, m.RAM = roundPercent(m.CPU), roundPercent(m.RAM)
+	if m.Disks != nil {
+		disks := make(map[string]float64, len(m.Disks))
+		for path, usage := range m.Disks {
+			disks[path] = roundPercent(usage)
+		}
+		m.Disks = disks
+	}
+	return m
+}
+
+// MarshalJSON encodes a measurement as usual, with its percentages rounded.
+func (m Measurement) MarshalJSON() ([]byte, error) {
+	type plain Measurement
+	return json.Marshal(plain(m.roundedPercents()))
+}
@@ -0,0 +1,15 @@
+package main
+
+// Sampler takes the CPU and RAM usage samples the resource observer stores,
+// both in percent.
+type Sampler interface {
+	Sample() (cpu float64, ram float64, err error)
+}
+
+// gopsutilSampler samples this machine through gopsutil, measuring the CPU
+// usage over CPU_SAMPLE_WINDOW.
+type gopsutilSampler struct{}
+
+func (gopsutilSampler) Sample() (float64, float64, error) {
+	return getCPURAMUsage(cfg().CPUSampleWindow)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/shirou/gopsutil/process"
+)
+
+// scriptedSample is a sample returned by a scriptedSampler.
+type scriptedSample struct {
+	CPU float64
+	RAM float64
+	Err error
+}
+
+// errSamplesExhausted is returned by a scriptedSampler once all of its
+// samples were taken.
+var errSamplesExhausted = errors.New("no scripted samples left")
+
+// scriptedSampler returns fixed samples in order, so that the observer can be
+// driven deterministically without depending on the load of the machine.
+type scriptedSampler struct {
+	samples []scriptedSample
+	next    int
+}
+
+func (s *scriptedSampler) Sample() (float64, float64, error) {
+	if s.next >= len(s.samples) {
+		return 0, 0, errSamplesExhausted
+	}
+	sample := s.samples[s.next]
+	s.next++
+	return sample.CPU, sample.RAM, sample.Err
+}
+
+// burnCPU keeps one core busy until the returned function is called.
+func burnCPU() (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// The first sample after startup must already be a real reading, not the
+// zero or since-boot value of an unprimed counter.
+func TestGopsutilSamplerFirstSample(t *testing.T) {
+	config := defaultConfig()
+	config.CPUSampleWindow = 200 * time.Millisecond
+	useConfig(t, config)
+
+	stop := burnCPU()
+	defer stop()
+	cpu, ram, err := gopsutilSampler{}.Sample()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cpu <= 0 || cpu > 100 {
+		t.Errorf("first cpu sample = %v, want a usage in (0, 100] while a core is busy", cpu)
+	}
+	if ram <= 0 || ram > 100 {
+		t.Errorf("first ram sample = %v, want a usage in (0, 100]", ram)
+	}
+}
+
+// Process samples compare against the previous reading, which the self
+// observer takes right away so that its first stored sample is a real one.
+func TestSampleSelfPrimed(t *testing.T) {
+	proc, err := process.NewProcess(int32(os.Getpid()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := proc.Percent(0); err != nil {
+		t.Fatal(err)
+	}
+
+	stop := burnCPU()
+	time.Sleep(300 * time.Millisecond)
+	stop()
+	m, err := sampleSelf(proc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.CPU <= 0 || m.CPU > 100 {
+		t.Errorf("first cpu sample = %v, want a usage in (0, 100] after burning a core", m.CPU)
+	}
+	if m.RAM <= 0 || m.RAM > 100 {
+		t.Errorf("first ram sample = %v, want a usage in (0, 100]", m.RAM)
+	}
+	if m.Metrics["rss_bytes"] <= 0 {
+		t.Errorf("rss_bytes = %v, want the resident memory", m.Metrics["rss_bytes"])
+	}
+	if !isSelfMeasurement(m) {
+		t.Errorf("labels = %v, want it marked as a self measurement", m.Labels)
+	}
+}
+
+func TestScriptedSampler(t *testing.T) {
+	failed := errors.New("failed")
+	sampler := &scriptedSampler{samples: []scriptedSample{{CPU: 1, RAM: 2}, {Err: failed}}}
+	tests := []struct {
+		cpu, ram float64
+		err      error
+	}{
+		{1, 2, nil},
+		{0, 0, failed},
+		{0, 0, errSamplesExhausted},
+		{0, 0, errSamplesExhausted},
+	}
+	for i, tt := range tests {
+		cpu, ram, err := sampler.Sample()
+		if cpu != tt.cpu || ram != tt.ram || !errors.Is(err, tt.err) {
+			t.Errorf("sample %d = %v, %v, %v, want %v, %v, %v", i, cpu, ram, err, tt.cpu, tt.ram, tt.err)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// FieldSchema describes one field of a Measurement.
+type FieldSchema struct {
+	// Name is the key of the field in API responses.
+	Name string `json:"name"`
+	// Stored is the key of the field in MongoDB and in query parameters.
+	Stored string `json:"stored"`
+	Type   string `json:"type"`
+	Unit   string `json:"unit,omitempty"`
+}
+
+// measurementSchema is derived from the Measurement struct once, so it
+// cannot drift from the actual fields.
+var measurementSchema = describeFields(reflect.TypeOf(Measurement{}))
+
+func describeFields(t reflect.Type) []FieldSchema {
+	fields := make([]FieldSchema, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Name
+		if tag := strings.Split(field.Tag.Get("json"), ",")[0]; tag != "" {
+			name = tag
+		}
+		fields = append(fields, FieldSchema{
+			Name:   name,
+			Stored: strings.Split(field.Tag.Get("bson"), ",")[0],
+			Type:   schemaType(field.Type),
+			Unit:   field.Tag.Get("unit"),
+		})
+	}
+	return fields
+}
+
+// schemaType maps a Go type to the JSON type clients see. Pointers, which
+// mark optional fields, have the type they point to.
+func schemaType(t reflect.Type) string {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t {
+	case reflect.TypeOf(time.Time{}):
+		return "timestamp"
+	case reflect.TypeOf(primitive.ObjectID{}):
+		return "id"
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Float32, reflect.Float64, reflect.Int, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return "number"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// @Summary Get the measurement schema
+// @Description Lists the fields of a measurement with their types and units
+// @Tags Measurements
+// @Produce json
+// @Success 200 {array} FieldSchema
+// @Router /measurements/schema [get]
+func getMeasurementSchema(c *gin.Context) {
+	c.JSON(http.StatusOK, measurementSchema)
+}
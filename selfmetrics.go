@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shirou/gopsutil/process"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// sourceLabel tells the measurements of this process, labelled selfSource,
+// apart from the host measurements, which do not carry it.
+const (
+	sourceLabel = "source"
+	selfSource  = "self"
+	hostSource  = "host"
+)
+
+// fromSource restricts filter to the measurements of source, selfSource or
+// hostSource.
+func fromSource(filter bson.M, source string) bson.M {
+	condition := bson.M{"labels." + sourceLabel: bson.M{"$ne": selfSource}}
+	if source == selfSource {
+		condition = bson.M{"labels." + sourceLabel: selfSource}
+	}
+	if len(filter) == 0 {
+		return condition
+	}
+	return bson.M{"$and": []bson.M{filter, condition}}
+}
+
+// querySource returns the source selected by the source query parameter,
+// hostSource by default.
+func querySource(c *gin.Context) (string, error) {
+	source := c.DefaultQuery("source", hostSource)
+	if source != hostSource && source != selfSource {
+		return "", fmt.Errorf("invalid source: expected host or self")
+	}
+	return source, nil
+}
+
+// isSelfMeasurement reports whether m was sampled from this process.
+func isSelfMeasurement(m Measurement) bool {
+	return m.Labels[sourceLabel] == selfSource
+}
+
+// sampleSelf takes a measurement of this process: CPU is its share of the
+// CPU time of the whole machine since the previous call, RAM its share of
+// the machine's memory, and the rss_bytes and open_fds metrics its resident
+// memory and open file descriptors.
+func sampleSelf(proc *process.Process) (Measurement, error) {
+	cpu, err := proc.Percent(0)
+	if err != nil {
+		return Measurement{}, err
+	}
+	ram, err := proc.MemoryPercent()
+	if err != nil {
+		return Measurement{}, err
+	}
+	memory, err := proc.MemoryInfo()
+	if err != nil {
+		return Measurement{}, err
+	}
+	metrics := map[string]float64{"rss_bytes": float64(memory.RSS)}
+	// Not every platform can count the descriptors of a process.
+	if fds, err := proc.NumFDs(); err == nil {
+		metrics["open_fds"] = float64(fds)
+	}
+	return Measurement{
+		// Percent reports 100 per fully used core. Its CPU times only
+		// have clock tick precision, so a busy process can come out
+		// slightly above 100, which would fail validation.
+		CPU:     math.Min(cpu/float64(runtime.NumCPU()), 100),
+		RAM:     float64(ram),
+		Metrics: metrics,
+		Labels:  map[string]string{sourceLabel: selfSource},
+	}, nil
+}
+
+// runSelfObserver stores a measurement of this process every
+// OBSERVER_INTERVAL while SELF_METRICS is on, to tell whether the monitor
+// itself is the problem. Unlike host samples, they are neither published
+// nor buffered.
+func runSelfObserver(stopping <-chan struct{}) {
+	proc, err := process.NewProcess(int32(os.Getpid()))
+	if err != nil {
+		log.Println("Error watching this process:", err)
+		return
+	}
+	// The first CPU reading only starts the measurement. It is taken right
+	// away, so that the sample an interval later is already stored.
+	primed := false
+	for {
+		if !primed && cfg().SelfMetrics {
+			_, err := proc.Percent(0)
+			primed = err == nil
+		}
+		if sleepOrStop(stopping, cfg().ObserverInterval) {
+			return
+		}
+		if !cfg().SelfMetrics {
+			primed = false
+			continue
+		}
+		measurement, err := sampleSelf(proc)
+		if err != nil {
+			log.Println("Error sampling this process:", err)
+			continue
+		}
+		if !primed {
+			primed = true
+			continue
+		}
+		measurement.Timestamp = time.Now()
+		measurement.Host = hostname
+		if _, err := insertMeasurement(context.Background(), measurement); err != nil {
+			log.Println("Error storing process measurement:", err)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestFromSource(t *testing.T) {
+	testConfig(t)
+	collection := testCollection(t)
+	for _, m := range []Measurement{
+		{Host: "plain"},
+		{Host: "labeled", Labels: map[string]string{"rack": "r1"}},
+		{Host: "other-source", Labels: map[string]string{sourceLabel: "device"}},
+		{Host: "self", Labels: map[string]string{sourceLabel: selfSource}},
+		{Host: "self-busy", CPU: 90, Labels: map[string]string{sourceLabel: selfSource}},
+	} {
+		m.Timestamp = time.Now()
+		if _, err := collection.InsertOne(context.Background(), m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter bson.M
+		source string
+		want   []string
+	}{
+		{name: "host", source: hostSource, want: []string{"labeled", "other-source", "plain"}},
+		{name: "self", source: selfSource, want: []string{"self", "self-busy"}},
+		{name: "host with a filter", filter: bson.M{"host": bson.M{"$in": bson.A{"plain", "self"}}}, source: hostSource, want: []string{"plain"}},
+		{name: "self with a filter", filter: bson.M{"cpu": bson.M{"$gt": 50}}, source: selfSource, want: []string{"self-busy"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cur, err := collection.Find(context.Background(), fromSource(tt.filter, tt.source))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var found []Measurement
+			if err := cur.All(context.Background(), &found); err != nil {
+				t.Fatal(err)
+			}
+			var hosts []string
+			for _, m := range found {
+				hosts = append(hosts, m.Host)
+				if isSelfMeasurement(m) != (tt.source == selfSource) {
+					t.Errorf("%s: isSelfMeasurement = %v for source %s", m.Host, isSelfMeasurement(m), tt.source)
+				}
+			}
+			sort.Strings(hosts)
+			if len(hosts) != len(tt.want) {
+				t.Fatalf("matched %v, want %v", hosts, tt.want)
+			}
+			for i := range hosts {
+				if hosts[i] != tt.want[i] {
+					t.Fatalf("matched %v, want %v", hosts, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestQuerySource(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    string
+		wantErr bool
+	}{
+		{query: "", want: hostSource},
+		{query: "source=host", want: hostSource},
+		{query: "source=self", want: selfSource},
+		{query: "source=device", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			c := queryContext(nil)
+			c.Request.URL.RawQuery = tt.query
+			source, err := querySource(c)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error: %v", err, tt.wantErr)
+			}
+			if source != tt.want {
+				t.Errorf("source = %q, want %q", source, tt.want)
+			}
+		})
+	}
+}
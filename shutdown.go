@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// shutdownStep is a component stopped on shutdown. A non-zero timeout
+// bounds the step on its own, within the overall SHUTDOWN_TIMEOUT.
+type shutdownStep struct {
+	name    string
+	timeout time.Duration
+	stop    func(ctx context.Context) error
+}
+
+// shutdownHooks are the steps registered by the components started so far,
+// in registration order.
+var shutdownHooks struct {
+	sync.Mutex
+	steps []shutdownStep
+}
+
+// onShutdown registers stop to be called on shutdown, after the HTTP server
+// stopped and before the broker is disconnected, and after the hooks
+// registered before it. A zero timeout leaves the step bounded by
+// SHUTDOWN_TIMEOUT alone.
+func onShutdown(name string, timeout time.Duration, stop func(ctx context.Context) error) {
+	shutdownHooks.Lock()
+	defer shutdownHooks.Unlock()
+	shutdownHooks.steps = append(shutdownHooks.steps, shutdownStep{name, timeout, stop})
+}
+
+// startTask runs loop in the background, the resource observer or the
+// rollup job for example, and registers a shutdown step that closes
+// stopping and waits for loop to return. loop should return once stopping
+// is closed, but finish the work it is in the middle of first, so that a
+// shutdown does not leave it half done.
+func startTask(name string, loop func(stopping <-chan struct{})) {
+	stopping, done := make(chan struct{}), make(chan struct{})
+	onShutdown(name, 0, func(ctx context.Context) error {
+		close(stopping)
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	go func() {
+		defer close(done)
+		loop(stopping)
+	}()
+}
+
+// sleepOrStop waits for d and reports whether stopping was closed first.
+func sleepOrStop(stopping <-chan struct{}, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return false
+	case <-stopping:
+		return true
+	}
+}
+
+// awaitShutdown blocks until SIGINT or SIGTERM, then lets server finish its
+// requests, runs the registered hooks and disconnects from the broker and
+// MongoDB. All steps together may take SHUTDOWN_TIMEOUT, so a hung
+// dependency cannot block a rescheduling of the container indefinitely. It
+// returns the process exit code: non-zero when a component did not stop
+// cleanly.
+func awaitShutdown(server *http.Server) int {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	log.Printf("received %s, shutting down\n", <-signals)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg().ShutdownTimeout)
+	defer cancel()
+
+	// The server goes first: requests still in flight may use MQTT, as may
+	// the components stopped by the hooks.
+	shutdownHooks.Lock()
+	steps := append([]shutdownStep{{"HTTP server", 0, server.Shutdown}}, shutdownHooks.steps...)
+	shutdownHooks.Unlock()
+	// MongoDB goes last: messages delivered until the broker disconnects
+	// are still stored.
+	steps = append(steps, shutdownStep{"MQTT client", 0, disconnectMQTT}, shutdownStep{"MongoDB client", 0, disconnectMongo})
+	return runShutdownSteps(ctx, steps)
+}
+
+// runShutdownSteps stops the components in order and logs each one that did
+// not stop cleanly. Once ctx is done, the remaining steps are not started.
+func runShutdownSteps(ctx context.Context, steps []shutdownStep) int {
+	code := 0
+	for _, step := range steps {
+		err := ctx.Err()
+		if err == nil {
+			err = runShutdownStep(ctx, step)
+		}
+		if err != nil {
+			log.Printf("Shutdown: %s did not stop cleanly: %s\n", step.name, err)
+			code = 1
+		}
+	}
+	if code == 0 {
+		log.Println("shutdown complete")
+	}
+	return code
+}
+
+func runShutdownStep(ctx context.Context, step shutdownStep) error {
+	if step.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, step.timeout)
+		defer cancel()
+	}
+	return step.stop(ctx)
+}
+
+// disconnectMQTT disconnects the ingest client, if it is connected, unless
+// ctx is done first.
+func disconnectMQTT(ctx context.Context) error {
+	client := currentMQTTClient()
+	if client == nil {
+		return nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		client.Disconnect()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
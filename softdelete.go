@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// errNotDeleted is returned when restoring a measurement that exists but is
+// not soft-deleted.
+var errNotDeleted = &APIError{http.StatusNotFound, codeNotFound, "No soft-deleted measurement with this ID", nil}
+
+// notDeleted restricts filter to measurements that are not soft-deleted.
+// The condition is checked on the documents the other conditions select
+// through their indexes, so it does not widen the scan of a normal read.
+func notDeleted(filter bson.M) bson.M {
+	live := bson.M{"deleted_at": bson.M{"$exists": false}}
+	if len(filter) == 0 {
+		return live
+	}
+	return bson.M{"$and": []bson.M{filter, live}}
+}
+
+// includeDeleted reports whether the request asks for soft-deleted
+// measurements with include_deleted=true.
+func includeDeleted(c *gin.Context) bool {
+	return c.Query("include_deleted") == "true"
+}
+
+// softDeleteMeasurement marks the measurement with the given ID as deleted
+// and returns it.
+func softDeleteMeasurement(c *gin.Context, id primitive.ObjectID) (Measurement, error) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	collection, err := getMongoCollection()
+	if err != nil {
+		return Measurement{}, errDBUnavailable
+	}
+
+	var measurement Measurement
+	err = collection.FindOneAndUpdate(ctx, notDeleted(bson.M{"_id": id}),
+		bson.M{"$set": bson.M{"deleted_at": time.Now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&measurement)
+	return measurement, err
+}
+
+// @Summary Restore a measurement
+// @Description Undoes the soft delete of a measurement, which makes it visible to queries again
+// @Tags Measurements
+// @Produce json
+// @Param id path string true "Measurement ID"
+// @Success 200 {object} Measurement
+// @Failure 400 {object} ErrorResponse "Invalid ID"
+// @Failure 404 {object} ErrorResponse "No soft-deleted measurement with this ID"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 503 {object} ErrorResponse "MongoDB unavailable"
+// @Router /measurements/{id}/restore [post]
+func restoreMeasurement(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		respondError(c, errInvalidID)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	collection, err := getMongoCollection()
+	if err != nil {
+		respondError(c, errDBUnavailable)
+		return
+	}
+
+	var measurement Measurement
+	filter := bson.M{"_id": objectID, "deleted_at": bson.M{"$exists": true}}
+	err = collection.FindOneAndUpdate(ctx, filter, bson.M{"$unset": bson.M{"deleted_at": ""}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&measurement)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			err = errNotDeleted
+		}
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, responseMeasurement(measurement))
+}
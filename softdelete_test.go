@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSoftDeleteRestore(t *testing.T) {
+	config := testConfig(t)
+	config.SoftDelete = true
+	useConfig(t, config)
+
+	stored, err := insertMeasurement(context.Background(), Measurement{Timestamp: time.Now(), Host: "web-1", CPU: 1, RAM: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := stored.ID.Hex()
+
+	router := gin.New()
+	router.GET("/measurements", getMeasurements)
+	router.GET("/measurements/:id", getMeasurement)
+	router.DELETE("/measurements/:id", deleteMeasurement)
+	router.POST("/measurements/:id/restore", restoreMeasurement)
+
+	// Each step runs on the state the previous ones left.
+	steps := []struct {
+		name        string
+		method      string
+		path        string
+		wantStatus  int
+		wantDeleted bool
+		// wantListed is the number of measurements GET /measurements
+		// returns after the step.
+		wantListed int
+	}{
+		{"get", "GET", "/measurements/" + id, http.StatusOK, false, 1},
+		{"delete", "DELETE", "/measurements/" + id, http.StatusOK, true, 0},
+		{"get deleted", "GET", "/measurements/" + id, http.StatusNotFound, false, 0},
+		{"get with include_deleted", "GET", "/measurements/" + id + "?include_deleted=true", http.StatusOK, true, 0},
+		{"delete again", "DELETE", "/measurements/" + id, http.StatusNotFound, false, 0},
+		{"restore", "POST", "/measurements/" + id + "/restore", http.StatusOK, false, 1},
+		{"get restored", "GET", "/measurements/" + id, http.StatusOK, false, 1},
+		{"restore again", "POST", "/measurements/" + id + "/restore", http.StatusNotFound, false, 1},
+		{"restore invalid id", "POST", "/measurements/nope/restore", http.StatusBadRequest, false, 1},
+	}
+	for _, step := range steps {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(step.method, step.path, nil))
+		if w.Code != step.wantStatus {
+			t.Fatalf("%s: status = %d, want %d: %s", step.name, w.Code, step.wantStatus, w.Body)
+		}
+		if w.Code == http.StatusOK {
+			var m Measurement
+			if err := json.Unmarshal(w.Body.Bytes(), &m); err != nil {
+				t.Fatalf("%s: %v", step.name, err)
+			}
+			if m.ID != stored.ID || m.CPU != stored.CPU {
+				t.Errorf("%s: returned %+v, want the stored measurement", step.name, m)
+			}
+			if (m.DeletedAt != nil) != step.wantDeleted {
+				t.Errorf("%s: DeletedAt = %v, want set: %v", step.name, m.DeletedAt, step.wantDeleted)
+			}
+		}
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/measurements", nil))
+		var listed []Measurement
+		if err := json.Unmarshal(w.Body.Bytes(), &listed); err != nil {
+			t.Fatalf("%s: listing: %v: %s", step.name, err, w.Body)
+		}
+		if len(listed) != step.wantListed {
+			t.Errorf("%s: listed %d measurements, want %d", step.name, len(listed), step.wantListed)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// RecentAverage is the average load over a trailing window.
+type RecentAverage struct {
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	AvgCPU  *float64  `bson:"avg_cpu" json:"avg_cpu"`
+	AvgRAM  *float64  `bson:"avg_ram" json:"avg_ram"`
+	Samples int       `bson:"samples" json:"samples"`
+}
+
+// averagePipeline averages CPU and RAM over the measurements matching filter
+// into a single document.
+func averagePipeline(filter bson.M) []bson.M {
+	return []bson.M{
+		{"$match": notDeleted(fromSource(filter, hostSource))},
+		{"$group": bson.M{
+			"_id":     nil,
+			"avg_cpu": bson.M{"$avg": "$cpu"},
+			"avg_ram": bson.M{"$avg": "$ram"},
+			"samples": bson.M{"$sum": 1},
+		}},
+	}
+}
+
+// @Summary Average over a trailing window
+// @Description Returns the average CPU and RAM usage over the window ending now, e.g. for an "average CPU in the last 5 minutes" widget. The averages are null when there are no measurements in the window.
+// @Tags Measurements
+// @Produce json
+// @Param window query string false "Length of the window as a Go duration (default 5m)"
+// @Param host query string false "Only measurements from this host"
+// @Success 200 {object} RecentAverage
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 503 {object} ErrorResponse "MongoDB unavailable"
+// @Router /measurements/recent-avg [get]
+func getRecentAverage(c *gin.Context) {
+	window, err := time.ParseDuration(c.DefaultQuery("window", "5m"))
+	if err != nil || window <= 0 {
+		respondError(c, validationError(errors.New("invalid window: expected a positive duration such as 5m")))
+		return
+	}
+	to := time.Now()
+	from := to.Add(-window)
+	if err := checkQueryWindow(from, to); err != nil {
+		respondError(c, validationError(err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	collection, err := getMongoCollection()
+	if err != nil {
+		respondError(c, errDBUnavailable)
+		return
+	}
+
+	filter := rangeFilter(from, to)
+	if host := c.Query("host"); host != "" {
+		filter["host"] = host
+	}
+	cur, err := collection.Aggregate(ctx, averagePipeline(filter))
+	if err != nil {
+		respondError(c, internalError("Failed to compute the average"))
+		return
+	}
+	defer cur.Close(ctx)
+
+	result := RecentAverage{}
+	if cur.Next(ctx) {
+		if err := cur.Decode(&result); err != nil {
+			respondError(c, internalError("Failed to decode the average"))
+			return
+		}
+	}
+	if err := cur.Err(); err != nil {
+		respondError(c, internalError("Failed to compute the average"))
+		return
+	}
+	result.From, result.To = from, to
+	result.AvgCPU, result.AvgRAM = roundPercentPtr(result.AvgCPU), roundPercentPtr(result.AvgRAM)
+
+	c.JSON(http.StatusOK, result)
+}
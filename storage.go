@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// StorageStats describes how much space the measurement collection takes.
+// Sizes are in bytes; Size is the uncompressed size of the documents and
+// StorageSize the space allocated on disk for them.
+type StorageStats struct {
+	Collection      string           `json:"collection"`
+	Documents       int64            `json:"documents"`
+	Size            int64            `json:"size_bytes"`
+	StorageSize     int64            `json:"storage_size_bytes"`
+	AvgDocumentSize int64            `json:"avg_document_size_bytes"`
+	TotalIndexSize  int64            `json:"total_index_size_bytes"`
+	IndexSizes      map[string]int64 `json:"index_sizes_bytes"`
+}
+
+// codeNamespaceNotFound is returned by collStats on servers that do not
+// report missing collections as empty.
+const codeNamespaceNotFound = 26
+
+// statInt reads a size or count of a collStats result, which servers report
+// as int32, int64 or double depending on the magnitude.
+func statInt(value interface{}) int64 {
+	switch v := value.(type) {
+	case int32:
+		return int64(v)
+	case int64:
+		return v
+	case float64:
+		return int64(v)
+	}
+	return 0
+}
+
+// add sums the storage statistics of stats, a collStats result or the
+// storageStats of one shard, into s.
+func (s *StorageStats) add(stats bson.M) {
+	s.Documents += statInt(stats["count"])
+	s.Size += statInt(stats["size"])
+	s.StorageSize += statInt(stats["storageSize"])
+	s.TotalIndexSize += statInt(stats["totalIndexSize"])
+	indexSizes, _ := stats["indexSizes"].(bson.M)
+	for name, size := range indexSizes {
+		s.IndexSizes[name] += statInt(size)
+	}
+}
+
+// collectionStats collects the storage statistics of collection with the
+// $collStats stage, falling back to the collStats command, deprecated since
+// MongoDB 6.2, on servers that predate the stage.
+func collectionStats(ctx context.Context, collection *mongo.Collection) (StorageStats, error) {
+	stats := StorageStats{Collection: collection.Name(), IndexSizes: map[string]int64{}}
+
+	cur, err := collection.Aggregate(ctx, []bson.M{{"$collStats": bson.M{"storageStats": bson.M{}}}})
+	if err == nil {
+		// A sharded collection yields one document per shard.
+		var shards []struct {
+			StorageStats bson.M `bson:"storageStats"`
+		}
+		if err := cur.All(ctx, &shards); err != nil {
+			return stats, err
+		}
+		for _, shard := range shards {
+			stats.add(shard.StorageStats)
+		}
+	} else {
+		var serverErr mongo.ServerError
+		if !errors.As(err, &serverErr) {
+			return stats, err
+		}
+		var result bson.M
+		err = collection.Database().RunCommand(ctx, bson.D{{Key: "collStats", Value: collection.Name()}}).Decode(&result)
+		if errors.As(err, &serverErr) && serverErr.HasErrorCode(codeNamespaceNotFound) {
+			return stats, nil
+		}
+		if err != nil {
+			return stats, err
+		}
+		stats.add(result)
+	}
+
+	if stats.Documents > 0 {
+		stats.AvgDocumentSize = stats.Size / stats.Documents
+	}
+	return stats, nil
+}
+
+// @Summary Get storage statistics
+// @Description Reports the document count, data, storage and index sizes and the average document size of the measurement collection, to judge when to tighten retention
+// @Tags Admin
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} StorageStats
+// @Failure 401 {object} ErrorResponse "Invalid API key"
+// @Failure 403 {object} ErrorResponse "Admin API disabled"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 503 {object} ErrorResponse "MongoDB unavailable"
+// @Router /admin/storage [get]
+func getStorageStats(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	collection, err := getMongoCollection()
+	if err != nil {
+		respondError(c, errDBUnavailable)
+		return
+	}
+
+	stats, err := collectionStats(ctx, collection)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	defaultTail = 20
+	maxTail     = 1000
+	// tailBuffer is how many measurements a tail stream may fall behind
+	// before it is closed.
+	tailBuffer = 256
+	// tailKeepAlive is how often an idle tail stream sends a comment, so
+	// that proxies do not time out the connection.
+	tailKeepAlive = 15 * time.Second
+)
+
+// tailStreams fans the stored measurements out to the open tail streams.
+// Once the server shuts down, closed is set and no stream is opened.
+var tailStreams struct {
+	sync.Mutex
+	subscribers map[chan Measurement]struct{}
+	closed      bool
+}
+
+// subscribeTail returns a channel receiving every host measurement stored
+// from now on. It is closed when the subscriber falls more than tailBuffer
+// measurements behind, so that a stream never silently skips any, and when
+// the server shuts down.
+func subscribeTail() chan Measurement {
+	tailStreams.Lock()
+	defer tailStreams.Unlock()
+	ch := make(chan Measurement, tailBuffer)
+	if tailStreams.closed {
+		close(ch)
+		return ch
+	}
+	if tailStreams.subscribers == nil {
+		tailStreams.subscribers = map[chan Measurement]struct{}{}
+	}
+	tailStreams.subscribers[ch] = struct{}{}
+	return ch
+}
+
+func unsubscribeTail(ch chan Measurement) {
+	tailStreams.Lock()
+	defer tailStreams.Unlock()
+	if _, ok := tailStreams.subscribers[ch]; ok {
+		delete(tailStreams.subscribers, ch)
+		close(ch)
+	}
+}
+
+// broadcastMeasurement sends a stored measurement to the tail streams. It
+// never blocks: a stream too far behind is closed instead.
+func broadcastMeasurement(m Measurement) {
+	if isSelfMeasurement(m) {
+		return
+	}
+	tailStreams.Lock()
+	defer tailStreams.Unlock()
+	for ch := range tailStreams.subscribers {
+		select {
+		case ch <- m:
+		default:
+			delete(tailStreams.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// closeTailStreams ends every tail stream, which would otherwise keep a
+// graceful shutdown waiting until SHUTDOWN_TIMEOUT.
+func closeTailStreams() {
+	tailStreams.Lock()
+	defer tailStreams.Unlock()
+	tailStreams.closed = true
+	for ch := range tailStreams.subscribers {
+		close(ch)
+	}
+	tailStreams.subscribers = nil
+}
+
+// @Summary Tail measurements
+// @Description Streams measurements as server-sent events, like tail -f: first the latest n measurements, oldest first, then each measurement as it is stored, without a gap or a duplicate in between. Every event is named measurement and carries one measurement as JSON. A client too slow to keep up has its stream closed and should reconnect.
+// @Tags Measurements
+// @Produce text/event-stream
+// @Param n query int false "Number of latest measurements sent first (default 20, max 1000)"
+// @Param host query string false "Only measurements from this host"
+// @Success 200 {object} Measurement
+// @Failure 400 {object} ErrorResponse "Bad request"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 503 {object} ErrorResponse "MongoDB unavailable"
+// @Router /measurements/tail [get]
+func tailMeasurements(c *gin.Context) {
+	n := int64(defaultTail)
+	if raw := c.Query("n"); raw != "" {
+		var err error
+		n, err = strconv.ParseInt(raw, 10, 64)
+		if err != nil || n < 0 || n > maxTail {
+			respondError(c, validationError(fmt.Errorf("invalid n: expected a number between 0 and %d", maxTail)))
+			return
+		}
+	}
+	host := c.Query("host")
+
+	collection, err := getMongoCollection()
+	if err != nil {
+		respondError(c, errDBUnavailable)
+		return
+	}
+
+	// Subscribing before the backfill query means that a measurement stored
+	// in between is both queried and streamed rather than neither; the
+	// streamed copy is skipped by its ID.
+	live := subscribeTail()
+	defer unsubscribeTail(live)
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	filter := bson.M{}
+	if host != "" {
+		filter["host"] = host
+	}
+	backfill, err := findAround(ctx, collection, notDeleted(fromSource(filter, hostSource)), -1, n)
+	cancel()
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	// Keeps nginx from buffering the stream.
+	c.Header("X-Accel-Buffering", "no")
+	backfilled := make(map[primitive.ObjectID]bool, len(backfill))
+	for i := len(backfill) - 1; i >= 0; i-- {
+		backfilled[backfill[i].ID] = true
+		c.SSEvent("measurement", responseMeasurement(backfill[i]))
+	}
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(tailKeepAlive)
+	defer keepAlive.Stop()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case m, ok := <-live:
+			switch {
+			case !ok:
+				return false
+			case backfilled[m.ID]:
+				delete(backfilled, m.ID)
+			case host == "" || m.Host == host:
+				c.SSEvent("measurement", responseMeasurement(m))
+			}
+		case <-keepAlive.C:
+			io.WriteString(w, ": keep-alive\n\n")
+		case <-c.Request.Context().Done():
+			return false
+		}
+		return true
+	})
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errRequestTimeout is reported for requests that ran out of the time their
+// route class allows.
+var errRequestTimeout = &APIError{http.StatusGatewayTimeout, codeTimeout, "Request timed out", nil}
+
+// requestTimeout cancels the request context once the timeout that setting
+// selects from the configuration in effect has elapsed, so that handlers
+// abandon their database work and respond 504. The setting is read per
+// request, so a reload applies right away. Zero leaves the handlers' own
+// limits in place; a timeout can only shorten them.
+func requestTimeout(setting func(*Config) time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		timeout := setting(cfg())
+		if timeout <= 0 {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// requestTimedOut reports whether the request ran out of its configured
+// time.
+func requestTimedOut(c *gin.Context) bool {
+	return c.Request.Context().Err() == context.DeadlineExceeded
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+)
+
+// epochTime is a timestamp decoded from either an RFC3339 string or a
+// numeric Unix epoch. Whether an epoch is in seconds, milliseconds,
+// microseconds or nanoseconds is told by its magnitude, which is
+// unambiguous for any date between 1973 and 5138.
+type epochTime time.Time
+
+func (t *epochTime) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		parsed, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return fmt.Errorf("invalid timestamp %q: expected RFC3339 or a Unix epoch", s)
+		}
+		*t = epochTime(parsed)
+		return nil
+	}
+
+	var epoch float64
+	if err := json.Unmarshal(data, &epoch); err != nil {
+		return fmt.Errorf("invalid timestamp %s: expected RFC3339 or a Unix epoch", data)
+	}
+	*t = epochTime(fromEpoch(epoch))
+	return nil
+}
+
+// fromEpoch converts a Unix epoch in seconds, milliseconds, microseconds or
+// nanoseconds to a time.
+func fromEpoch(epoch float64) time.Time {
+	scale := 1e9 // nanoseconds per unit
+	switch abs := math.Abs(epoch); {
+	case abs >= 1e17:
+		scale = 1
+	case abs >= 1e14:
+		scale = 1e3
+	case abs >= 1e11:
+		scale = 1e6
+	}
+	return time.Unix(0, int64(epoch*scale))
+}
+
+// UnmarshalJSON decodes a measurement as usual, except that the timestamp
+// may also be given as a Unix epoch.
+func (m *Measurement) UnmarshalJSON(data []byte) error {
+	type plain Measurement
+	aux := struct {
+		*plain
+		Timestamp *epochTime
+	}{plain: (*plain)(m)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	if aux.Timestamp != nil {
+		m.Timestamp = time.Time(*aux.Timestamp)
+	}
+	return nil
+}
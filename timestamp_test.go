@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestMeasurementTimestampJSON(t *testing.T) {
+	want := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	wantMillis := want.Add(123 * time.Millisecond)
+	wantMicros := wantMillis.Add(456 * time.Microsecond)
+	wantNanos := wantMicros.Add(789 * time.Nanosecond)
+
+	tests := []struct {
+		name      string
+		timestamp string
+		want      time.Time
+		wantErr   bool
+	}{
+		{name: "RFC3339", timestamp: `"2026-01-02T03:04:05Z"`, want: want},
+		{name: "RFC3339 with offset", timestamp: `"2026-01-02T04:04:05+01:00"`, want: want},
+		{name: "RFC3339 with fraction", timestamp: `"2026-01-02T03:04:05.123456789Z"`, want: wantNanos},
+		{name: "epoch seconds", timestamp: `1767323045`, want: want},
+		{name: "epoch seconds with fraction", timestamp: `1767323045.5`, want: want.Add(500 * time.Millisecond)},
+		{name: "epoch milliseconds", timestamp: `1767323045123`, want: wantMillis},
+		{name: "epoch microseconds", timestamp: `1767323045123456`, want: wantMicros},
+		{name: "epoch nanoseconds", timestamp: `1767323045123456789`, want: wantNanos},
+		{name: "null", timestamp: `null`},
+		{name: "not a timestamp", timestamp: `"yesterday"`, wantErr: true},
+		{name: "date only", timestamp: `"2026-01-02"`, wantErr: true},
+		{name: "boolean", timestamp: `true`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m Measurement
+			err := json.Unmarshal([]byte(`{"CPU": 1, "Timestamp": `+tt.timestamp+`}`), &m)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error: %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			// Float epochs lose precision beyond microseconds.
+			if diff := m.Timestamp.Sub(tt.want); diff < -time.Microsecond || diff > time.Microsecond {
+				t.Errorf("timestamp = %s, want %s", m.Timestamp.UTC().Format(time.RFC3339Nano), tt.want.Format(time.RFC3339Nano))
+			}
+			if m.CPU != 1 {
+				t.Errorf("cpu = %v, want the other fields decoded too", m.CPU)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// serveHTTP serves on LISTEN_ADDR until server is shut down. Plain HTTP is
+// used unless TLS_CERT_FILE and TLS_KEY_FILE are set; with
+// TLS_CLIENT_CA_FILE as well, clients must present a certificate signed by
+// that CA.
+func serveHTTP(server *http.Server) error {
+	server.Addr = cfg().ListenAddr
+	if cfg().TLSCertFile == "" {
+		return server.ListenAndServe()
+	}
+
+	tlsConfig, err := serverTLSConfig(cfg().TLSClientCAFile)
+	if err != nil {
+		return err
+	}
+	server.TLSConfig = tlsConfig
+	return server.ListenAndServeTLS(cfg().TLSCertFile, cfg().TLSKeyFile)
+}
+
+// serverTLSConfig returns the TLS configuration of the API server, which
+// requires and verifies client certificates when clientCAFile is set.
+func serverTLSConfig(clientCAFile string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if clientCAFile == "" {
+		return tlsConfig, nil
+	}
+
+	pem, err := os.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("client CA: %w", err)
+	}
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("client CA: no certificates found in %s", clientCAFile)
+	}
+	tlsConfig.ClientCAs = clientCAs
+	tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	return tlsConfig, nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"container/list"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TopicInfo describes an MQTT topic measurements were received on.
+type TopicInfo struct {
+	Topic    string    `json:"topic"`
+	Messages int64     `json:"messages"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// maxSeenTopics bounds the topics GET /topics keeps track of, since a
+// wildcard subscription with a topic per device can see any number of them.
+const maxSeenTopics = 1000
+
+var seenTopicsEvicted = newCounter("mqtt_topics_evicted_total",
+	"Number of topics dropped from GET /topics, least recently seen first, to stay within its limit.")
+
+// seenTopics counts the messages received per topic on the measurement
+// subscription, which may be a wildcard such as sensors/#. order holds the
+// *TopicInfo of the topics, most recently seen first, so that the least
+// recently seen one is dropped once maxSeenTopics is reached.
+var seenTopics = struct {
+	sync.Mutex
+	topics map[string]*list.Element
+	order  *list.List
+}{topics: map[string]*list.Element{}, order: list.New()}
+
+// recordTopic counts a message received on topic.
+func recordTopic(topic string) {
+	seenTopics.Lock()
+	defer seenTopics.Unlock()
+
+	element, ok := seenTopics.topics[topic]
+	if ok {
+		seenTopics.order.MoveToFront(element)
+	} else {
+		if seenTopics.order.Len() >= maxSeenTopics {
+			oldest := seenTopics.order.Back()
+			delete(seenTopics.topics, oldest.Value.(*TopicInfo).Topic)
+			seenTopics.order.Remove(oldest)
+			seenTopicsEvicted.Inc()
+		}
+		element = seenTopics.order.PushFront(&TopicInfo{Topic: topic})
+		seenTopics.topics[topic] = element
+	}
+	info := element.Value.(*TopicInfo)
+	info.Messages++
+	info.LastSeen = time.Now()
+}
+
+// @Summary List MQTT topics
+// @Description Lists the topics measurements were received on since startup, with their message counts and when they were last seen. At most 1000 topics are kept; beyond that the least recently seen ones are dropped and counted in mqtt_topics_evicted_total on GET /metrics.
+// @Tags Broker
+// @Produce json
+// @Success 200 {array} TopicInfo
+// @Router /topics [get]
+func getTopics(c *gin.Context) {
+	seenTopics.Lock()
+	topics := make([]TopicInfo, 0, seenTopics.order.Len())
+	for element := seenTopics.order.Front(); element != nil; element = element.Next() {
+		topics = append(topics, *element.Value.(*TopicInfo))
+	}
+	seenTopics.Unlock()
+
+	sort.Slice(topics, func(i, j int) bool { return topics[i].Topic < topics[j].Topic })
+	c.JSON(http.StatusOK, topics)
+}
+
+// hostTopicPlaceholder is the topic level of MQTT_HOST_TOPIC that names the
+// host.
+const hostTopicPlaceholder = "{host}"
+
+// hostFromTopic extracts the host from topic using template, a topic filter
+// in which one level is {host}, e.g. metrics/{host}/#. ok is false when the
+// template is empty or topic does not match it.
+func hostFromTopic(template, topic string) (host string, ok bool) {
+	levels := strings.Split(template, "/")
+	index := -1
+	for i, level := range levels {
+		if level == hostTopicPlaceholder {
+			index = i
+			levels[i] = "+"
+		}
+	}
+	if index < 0 || !topicMatches(strings.Join(levels, "/"), topic) {
+		return "", false
+	}
+	host = strings.Split(topic, "/")[index]
+	return host, host != ""
+}
+
+// validHostTopic reports whether template is empty or a topic filter with
+// exactly one {host} level ahead of any multi-level wildcard.
+func validHostTopic(template string) bool {
+	if template == "" {
+		return true
+	}
+	placeholders := 0
+	for _, level := range strings.Split(template, "/") {
+		switch level {
+		case hostTopicPlaceholder:
+			placeholders++
+		case "#":
+			return placeholders == 1 && strings.HasSuffix(template, "/#")
+		}
+	}
+	return placeholders == 1
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// maxDatagramSize is the largest UDP payload read; longer datagrams are
+// truncated by the kernel.
+const maxDatagramSize = 64 << 10
+
+// parseLine parses a line of the UDP line protocol,
+//
+//	<host>[,<label>=<value>...] cpu=<number>,ram=<number>[,<metric>=<number>...] [<epoch>]
+//
+// e.g. "web-1,rack=r1 cpu=12.3,ram=45.6,temperature=41 1767323045". Fields
+// other than cpu and ram are stored as metrics. The epoch may be in
+// seconds, milliseconds, microseconds or nanoseconds and defaults to
+// receivedAt.
+func parseLine(line string, receivedAt time.Time) (Measurement, error) {
+	parts := strings.Fields(line)
+	if len(parts) < 2 || len(parts) > 3 {
+		return Measurement{}, errors.New("expected host, fields and an optional timestamp separated by spaces")
+	}
+
+	tags := strings.Split(parts[0], ",")
+	measurement := Measurement{Host: tags[0], Timestamp: receivedAt}
+	for _, tag := range tags[1:] {
+		name, value, ok := strings.Cut(tag, "=")
+		if !ok || !isValidMetricName(name) {
+			return Measurement{}, fmt.Errorf("invalid label %q: expected <name>=<value>", tag)
+		}
+		if measurement.Labels == nil {
+			measurement.Labels = map[string]string{}
+		}
+		measurement.Labels[name] = value
+	}
+
+	seen := map[string]bool{}
+	for _, field := range strings.Split(parts[1], ",") {
+		name, raw, ok := strings.Cut(field, "=")
+		value, err := strconv.ParseFloat(raw, 64)
+		if !ok || err != nil {
+			return Measurement{}, fmt.Errorf("invalid field %q: expected <name>=<number>", field)
+		}
+		seen[name] = true
+		switch name {
+		case "cpu":
+			measurement.CPU = value
+		case "ram":
+			measurement.RAM = value
+		default:
+			if !isValidMetricName(name) {
+				return Measurement{}, fmt.Errorf("invalid metric name %q", name)
+			}
+			if measurement.Metrics == nil {
+				measurement.Metrics = map[string]float64{}
+			}
+			measurement.Metrics[name] = value
+		}
+	}
+	for _, required := range []string{"cpu", "ram"} {
+		if !seen[required] {
+			return Measurement{}, fmt.Errorf("missing %s", required)
+		}
+	}
+
+	if len(parts) == 3 {
+		epoch, err := strconv.ParseFloat(parts[2], 64)
+		if err != nil {
+			return Measurement{}, errors.New("invalid timestamp: expected a Unix epoch")
+		}
+		measurement.Timestamp = fromEpoch(epoch)
+	}
+
+	if details := measurement.validate(); len(details) > 0 {
+		return Measurement{}, fmt.Errorf("invalid %s: %s", details[0].Field, details[0].Message)
+	}
+	return measurement, nil
+}
+
+// listenUDP opens the UDP_LISTEN_ADDR socket, which is closed on shutdown,
+// or returns nil when it is not set.
+func listenUDP() (*net.UDPConn, error) {
+	if cfg().UDPListenAddr == "" {
+		return nil, nil
+	}
+	addr, err := net.ResolveUDPAddr("udp", cfg().UDPListenAddr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	onShutdown("UDP listener", 0, closeUDP(conn))
+	return conn, nil
+}
+
+// serveUDP stores the measurements of every line of the datagrams received
+// on conn until it is closed. Invalid lines are logged and skipped; UDP
+// gives no way to tell the sender.
+func serveUDP(conn *net.UDPConn) {
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			log.Println("Error reading UDP datagram:", err)
+			continue
+		}
+		receivedAt := time.Now()
+
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			// Like an MQTT message, each line gets its own ingest ID.
+			ctx := withLogID(context.Background(), "ingest_id", uuid.NewString())
+			logf(ctx, "Received line: %s from %s\n", line, from)
+			measurement, err := parseLine(line, receivedAt)
+			if err != nil {
+				logf(ctx, "Error parsing line: %s\n", err)
+				continue
+			}
+			if _, err := insertMeasurement(ctx, measurement); err != nil {
+				logf(ctx, "Error storing measurement: %s\n", err)
+				continue
+			}
+			logf(ctx, "Measurement stored successfully: %v\n", measurement)
+		}
+	}
+}
+
+// closeUDP stops serveUDP.
+func closeUDP(conn *net.UDPConn) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		return conn.Close()
+	}
+}
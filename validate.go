@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// FieldError is an invalid field of a request body. Field is the path of
+// the field in the JSON body, e.g. CPU, Disks[/] or [3].RAM in a batch.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// invalidMeasurement reports every invalid field of a measurement body at
+// once, so that clients can fix them in one go.
+func invalidMeasurement(details []FieldError) *APIError {
+	return &APIError{http.StatusBadRequest, codeValidation, "Invalid measurement, see details", details}
+}
+
+// fieldErrorMessage describes the failed check of a binding tag.
+func fieldErrorMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "gte":
+		return "must be at least " + fe.Param()
+	case "lte":
+		return "must be at most " + fe.Param()
+	}
+	return "failed the " + fe.Tag() + " check"
+}
+
+// notFiniteMessage describes a NaN or infinite reading, which strconv
+// accepts but responses cannot encode as JSON.
+const notFiniteMessage = "must be a finite number"
+
+func isFinite(value float64) bool {
+	return !math.IsNaN(value) && !math.IsInf(value, 0)
+}
+
+// validate checks the binding tags of the measurement fields and the names
+// of its metrics and labels, which are stored as document keys, and that
+// every reading is finite. It returns all invalid fields, in field order.
+func (m Measurement) validate() []FieldError {
+	var details []FieldError
+	var fieldErrs validator.ValidationErrors
+	if err := binding.Validator.ValidateStruct(m); errors.As(err, &fieldErrs) {
+		for _, fe := range fieldErrs {
+			// The namespace starts with the struct name, e.g. Measurement.CPU.
+			_, field, _ := strings.Cut(fe.Namespace(), ".")
+			message := fieldErrorMessage(fe)
+			// NaN fails every range check, which would read as out of range.
+			if value, ok := fe.Value().(float64); ok && !isFinite(value) {
+				message = notFiniteMessage
+			}
+			details = append(details, FieldError{field, message})
+		}
+	}
+
+	for _, keys := range []struct {
+		field string
+		names []string
+	}{{"Labels", labelNames(m.Labels)}, {"Metrics", metricNames(m.Metrics)}} {
+		sort.Strings(keys.names)
+		for _, name := range keys.names {
+			if !isValidMetricName(name) {
+				details = append(details, FieldError{fmt.Sprintf("%s[%s]", keys.field, name),
+					"names must not be empty, start with $ or contain dots"})
+			}
+		}
+	}
+	// Metrics have no range, so nothing above rejects NaN or infinity.
+	names := metricNames(m.Metrics)
+	sort.Strings(names)
+	for _, name := range names {
+		if !isFinite(m.Metrics[name]) {
+			details = append(details, FieldError{fmt.Sprintf("Metrics[%s]", name), notFiniteMessage})
+		}
+	}
+	return append(details, cardinalityErrors(m)...)
+}
+
+func labelNames(labels map[string]string) []string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	return names
+}
+
+func metricNames(metrics map[string]float64) []string {
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"math"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateFinite(t *testing.T) {
+	tests := []struct {
+		name string
+		m    Measurement
+		want []FieldError
+	}{
+		{name: "finite", m: Measurement{Disks: map[string]float64{"/": 50}, Metrics: map[string]float64{"x": -1e300}}},
+		{name: "NaN cpu", m: Measurement{CPU: math.NaN()}, want: []FieldError{{"CPU", notFiniteMessage}}},
+		{name: "infinite ram", m: Measurement{RAM: math.Inf(1)}, want: []FieldError{{"RAM", notFiniteMessage}}},
+		{name: "disks", m: Measurement{Disks: map[string]float64{"/": math.NaN()}},
+			want: []FieldError{{"Disks[/]", notFiniteMessage}}},
+		{name: "out of range disk", m: Measurement{Disks: map[string]float64{"/": 101}},
+			want: []FieldError{{"Disks[/]", "must be at most 100"}}},
+		{name: "metrics", m: Measurement{Metrics: map[string]float64{"x": math.NaN(), "y": math.Inf(-1), "z": 1}},
+			want: []FieldError{{"Metrics[x]", notFiniteMessage}, {"Metrics[y]", notFiniteMessage}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.m.validate(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validate = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestIngestNotFinite checks that the text formats, in which strconv
+// accepts NaN and Inf, reject them as readings.
+func TestIngestNotFinite(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		input   string
+		wantErr string
+	}{
+		{name: "ingest", path: "ingest", input: "cpu=1&ram=2&metric.x=1.5"},
+		{name: "ingest NaN metric", path: "ingest", input: "cpu=1&ram=2&metric.x=NaN", wantErr: "Metrics[x]: " + notFiniteMessage},
+		{name: "ingest infinite metric", path: "ingest", input: "cpu=1&ram=2&metric.x=-Inf", wantErr: "Metrics[x]: " + notFiniteMessage},
+		{name: "ingest NaN cpu", path: "ingest", input: "cpu=NaN&ram=2", wantErr: "CPU: " + notFiniteMessage},
+		{name: "csv", path: "csv", input: "cpu,ram,metric.x\n1,2,1.5\n"},
+		{name: "csv NaN metric", path: "csv", input: "cpu,ram,metric.x\n1,2,NaN\n", wantErr: "Metrics[x]: " + notFiniteMessage},
+		{name: "csv infinite metric", path: "csv", input: "cpu,ram,metric.x\n1,2,+Inf\n", wantErr: "Metrics[x]: " + notFiniteMessage},
+		{name: "udp", path: "udp", input: "web-1 cpu=1,ram=2,x=1.5"},
+		{name: "udp NaN metric", path: "udp", input: "web-1 cpu=1,ram=2,x=NaN", wantErr: "Metrics[x]: " + notFiniteMessage},
+		{name: "udp infinite metric", path: "udp", input: "web-1 cpu=1,ram=2,x=Inf", wantErr: "Metrics[x]: " + notFiniteMessage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			switch tt.path {
+			case "ingest":
+				values, err := url.ParseQuery(tt.input)
+				if err != nil {
+					t.Fatal(err)
+				}
+				m, err := measurementFromValues(values)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, fe := range m.validate() {
+					got = append(got, fe.Field+": "+fe.Message)
+				}
+			case "csv":
+				_, invalid, err := parseImport(mimeCSV, []byte(tt.input))
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, row := range invalid {
+					for _, fe := range row.Errors {
+						got = append(got, fe.Field+": "+fe.Message)
+					}
+				}
+			case "udp":
+				if _, err := parseLine(tt.input, time.Now()); err != nil {
+					got = append(got, strings.TrimPrefix(err.Error(), "invalid "))
+				}
+			}
+			var want []string
+			if tt.wantErr != "" {
+				want = []string{tt.wantErr}
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("errors = %q, want %q", got, want)
+			}
+		})
+	}
+}
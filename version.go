@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+)
+
+// version is the release, set at build time with
+// -ldflags "-X main.version=1.2.3". Without it, the version of the main
+// module from the build info is reported.
+var version string
+
+// VersionInfo is the body of the /version response.
+type VersionInfo struct {
+	Version string `json:"version"`
+	// Revision is the VCS commit the binary was built from, if known.
+	Revision  string `json:"revision,omitempty"`
+	GoVersion string `json:"go_version"`
+	// ReadOnly is true when READ_ONLY disables every write.
+	ReadOnly bool `json:"read_only"`
+}
+
+// @Summary Version
+// @Description Reports the version and commit of the running binary and whether the service is read-only
+// @Tags Health
+// @Produce json
+// @Success 200 {object} VersionInfo
+// @Router /version [get]
+func getVersion(c *gin.Context) {
+	info := VersionInfo{Version: version, GoVersion: runtime.Version(), ReadOnly: cfg().ReadOnly}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" {
+			info.Version = build.Main.Version
+		}
+		for _, setting := range build.Settings {
+			if setting.Key == "vcs.revision" {
+				info.Revision = setting.Value
+			}
+		}
+	}
+	c.JSON(http.StatusOK, info)
+}
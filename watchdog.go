@@ -0,0 +1,64 @@
+package main
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// mqttClient is the ingest client, set once it is connected.
+	mqttClient atomic.Value
+
+	// lastMQTTMessage is the UnixNano time the last measurement message was
+	// received, or zero if none arrived yet.
+	lastMQTTMessage atomic.Int64
+)
+
+// currentMQTTClient returns the ingest client, or nil before it connected.
+func currentMQTTClient() MQTTClient {
+	client, _ := mqttClient.Load().(MQTTClient)
+	return client
+}
+
+// lastMQTTMessageAge returns the time since the last measurement message and
+// false if none was received yet.
+func lastMQTTMessageAge() (time.Duration, bool) {
+	last := lastMQTTMessage.Load()
+	if last == 0 {
+		return 0, false
+	}
+	return time.Since(time.Unix(0, last)), true
+}
+
+// runMQTTWatchdog re-subscribes to the measurement topic when no message
+// arrived for MQTT_WATCHDOG_TIMEOUT while the client still reports a live
+// connection, which happens when the broker drops a subscription without
+// disconnecting. A zero timeout disables the watchdog.
+func runMQTTWatchdog(client MQTTClient) {
+	timeout := cfg().MQTTWatchdogTimeout
+	if timeout <= 0 {
+		return
+	}
+
+	// Until the first message arrives, measure silence from startup; after a
+	// re-subscription, from that moment, so a quiet topic is not hammered.
+	since := time.Now()
+	ticker := time.NewTicker(timeout / 2)
+	defer ticker.Stop()
+	for range ticker.C {
+		if last := lastMQTTMessage.Load(); last != 0 && time.Unix(0, last).After(since) {
+			since = time.Unix(0, last)
+		}
+		if time.Since(since) < timeout || !client.IsConnectionOpen() {
+			continue
+		}
+
+		log.Printf("Warning: no MQTT message received for %s while connected, re-subscribing to %s\n",
+			time.Since(since).Round(time.Second), cfg().MQTTTopic)
+		if err := subscribeMeasurements(client); err != nil {
+			log.Printf("Error re-subscribing to %s: %s\n", cfg().MQTTTopic, err)
+		}
+		since = time.Now()
+	}
+}
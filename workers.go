@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+var mqttMessagesDropped = newCounter("mqtt_messages_dropped_total",
+	"Number of QoS 0 MQTT messages dropped because the MQTT_QUEUE_SIZE queue was full.")
+
+func init() {
+	newGauge("mqtt_queue_length", "Number of MQTT messages waiting for a worker.",
+		func() float64 {
+			mqttQueue.RLock()
+			defer mqttQueue.RUnlock()
+			return float64(len(mqttQueue.messages))
+		})
+	onShutdown("MQTT workers", 0, stopMQTTWorkers)
+}
+
+// queuedMessage is a message waiting for a worker, with the time it arrived.
+type queuedMessage struct {
+	msg        mqttMessage
+	receivedAt time.Time
+}
+
+// mqttQueue holds the messages waiting for the MQTT_WORKERS. messages is nil
+// while there are no workers, in which case each message is handled as it
+// is delivered.
+var mqttQueue struct {
+	sync.RWMutex
+	messages chan queuedMessage
+	workers  sync.WaitGroup
+}
+
+// startMQTTWorkers starts n workers handling the measurement messages from
+// a queue of size messages, which bounds both the messages held in memory
+// and the concurrent MongoDB writes of a burst. Zero workers leave the
+// handling on the client's delivery goroutine, one message at a time.
+func startMQTTWorkers(n, size int) {
+	if n <= 0 {
+		return
+	}
+	messages := make(chan queuedMessage, size)
+	for i := 0; i < n; i++ {
+		mqttQueue.workers.Add(1)
+		go func() {
+			defer mqttQueue.workers.Done()
+			for queued := range messages {
+				handleMessage(queued.msg, queued.receivedAt)
+			}
+		}()
+	}
+	mqttQueue.Lock()
+	mqttQueue.messages = messages
+	mqttQueue.Unlock()
+}
+
+// queueMessage hands msg to the workers and reports whether it did, or
+// dropped it. When the queue is full, QoS 0 messages, which the publisher
+// accepts to lose, are dropped and counted, while QoS 1 and 2 messages wait
+// for room, which holds up the delivery of further messages until the
+// workers catch up.
+func queueMessage(msg mqttMessage, receivedAt time.Time) bool {
+	mqttQueue.RLock()
+	defer mqttQueue.RUnlock()
+	if mqttQueue.messages == nil {
+		return false
+	}
+	queued := queuedMessage{msg, receivedAt}
+	if msg.QoS > 0 {
+		mqttQueue.messages <- queued
+		return true
+	}
+	select {
+	case mqttQueue.messages <- queued:
+	default:
+		mqttMessagesDropped.Inc()
+		log.Printf("Dropping message from topic %s: the MQTT queue is full\n", msg.Topic)
+	}
+	return true
+}
+
+// stopMQTTWorkers lets the workers finish the queued messages. Messages
+// delivered afterwards, until the client disconnects, are handled
+// directly.
+func stopMQTTWorkers(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		mqttQueue.Lock()
+		if mqttQueue.messages != nil {
+			close(mqttQueue.messages)
+			mqttQueue.messages = nil
+		}
+		mqttQueue.Unlock()
+		mqttQueue.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// errWriteRateExceeded rejects measurements beyond MAX_WRITE_RATE.
+var errWriteRateExceeded = &APIError{http.StatusServiceUnavailable, codeOverloaded,
+	"Write rate limit reached, retry later", nil}
+
+var writesRateLimited = newCounter("measurements_rate_limited_total",
+	"Number of measurements rejected because MAX_WRITE_RATE was reached.")
+
+// tokenBucket admits events at a rate per second, with bursts of up to one
+// second's worth.
+type tokenBucket struct {
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// take admits n events at now if a token is left. A batch may overdraw the
+// bucket, which then admits nothing until it refilled, so the rate holds
+// on average however the events are grouped.
+func (b *tokenBucket) take(n int, rate float64, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	burst := math.Max(rate, 1)
+	if b.last.IsZero() {
+		b.tokens = burst
+	} else {
+		b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens -= float64(n)
+	return true
+}
+
+// writeBucket is shared by every path that stores measurements.
+var writeBucket tokenBucket
+
+// allowWrites reports whether n measurements may be stored now under
+// MAX_WRITE_RATE, counting them as rate limited otherwise. A zero rate
+// admits everything.
+func allowWrites(n int) bool {
+	rate := cfg().MaxWriteRate
+	if rate <= 0 || writeBucket.take(n, rate, time.Now()) {
+		return true
+	}
+	writesRateLimited.Add(n)
+	return false
+}